@@ -0,0 +1,32 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Sort mode constants
+const (
+	SortModeName = "name"
+	SortModeAge  = "age" // Youngest series first
+)
+
+// sortByAge orders series by the time they appeared, youngest first. The sort
+// is stable, so series of the same age stay in signature order.
+func sortByAge(series []*MetricSeries) {
+	slices.SortStableFunc(series, func(a, b *MetricSeries) int {
+		return cmp.Compare(b.firstSeen, a.firstSeen)
+	})
+}
+
+// formatAge formats the time since a series appeared, e.g. 45s, 12m30s or
+// 3h05m.
+func formatAge(firstSeen time.Time) string {
+	age := time.Since(firstSeen).Round(time.Second)
+	if age >= time.Hour {
+		return fmt.Sprintf("%dh%02dm", int(age.Hours()), int(age.Minutes())%60)
+	}
+	return age.String()
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"strings"
+)
+
+// Aggregations of the series of several targets for the -aggregate flag
+const (
+	AggregateOff = "off"
+	AggregateSum = "sum"
+	AggregateAvg = "avg"
+)
+
+// nextAggregate returns the aggregation following agg, for cycling with f.
+func nextAggregate(agg string) string {
+	switch agg {
+	case AggregateOff:
+		return AggregateSum
+	case AggregateSum:
+		return AggregateAvg
+	}
+	return AggregateOff
+}
+
+// aggregateCache holds the synthetic rows aggregating the series which only
+// differ by their target labels, e.g. the replicas of a service, named
+// <name>:sum or <name>:avg after the recording rule convention. They are
+// rebuilt from the whole history when the store or the aggregation changes,
+// reusing the series so cached rows stay valid.
+type aggregateCache struct {
+	key     aggregateKey
+	series  map[string]*MetricSeries // By signature
+	members map[string]bool          // Signatures of the aggregated series
+}
+
+type aggregateKey struct {
+	mode    string
+	scrapes uint64
+	stored  int // Series in the store, which drop with evictions
+	history int
+	targets string // Target label names
+}
+
+func newAggregateCache() *aggregateCache {
+	return &aggregateCache{series: make(map[string]*MetricSeries), members: make(map[string]bool)}
+}
+
+// targetLabelNames returns the names of the labels the Scraper adds to the
+// series of its targets.
+func (s *Scraper) targetLabelNames() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, t := range s.targets {
+		for name := range t.Labels {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// aggregates returns the aggregate rows of the series in the store, and the
+// signatures of the series they aggregate. Only series of two or more
+// targets are aggregated.
+func (m model) aggregates() (map[string]*MetricSeries, map[string]bool) {
+	c := m.aggregateCache
+	if c == nil {
+		return nil, nil
+	}
+	targetLabels := m.fetcher.targetLabelNames()
+	key := aggregateKey{
+		mode:    m.cfg.Aggregate,
+		scrapes: m.store.scrapes,
+		stored:  len(m.store.Metrics),
+		history: m.store.HistoryLimit,
+		targets: strings.Join(targetLabels, ","),
+	}
+	if key == c.key {
+		return c.series, c.members
+	}
+	c.key = key
+	clear(c.members)
+	if m.cfg.Aggregate == AggregateOff || len(targetLabels) == 0 {
+		clear(c.series)
+		return c.series, c.members
+	}
+
+	groups := make(map[string][]string) // Member signatures by aggregate signature
+	labelsOf := make(map[string]map[string]string)
+	for sig, series := range m.store.Metrics {
+		labels := make(map[string]string, len(series.Labels))
+		found := false
+		for k, v := range series.Labels {
+			if slices.Contains(targetLabels, k) {
+				found = true
+				continue
+			}
+			labels[k] = v
+		}
+		if !found {
+			continue
+		}
+		aggSig := GenerateSignature(series.Name+":"+m.cfg.Aggregate, labels)
+		groups[aggSig] = append(groups[aggSig], sig)
+		labelsOf[aggSig] = labels
+	}
+
+	seen := make(map[string]bool, len(groups))
+	for aggSig, sigs := range groups {
+		if len(sigs) < 2 {
+			continue
+		}
+		seen[aggSig] = true
+		first := m.store.Metrics[sigs[0]]
+		agg, ok := c.series[aggSig]
+		if !ok {
+			agg = &MetricSeries{
+				Name:      first.Name + ":" + m.cfg.Aggregate,
+				Unit:      first.Unit,
+				Type:      first.Type,
+				Labels:    labelsOf[aggSig],
+				Derived:   true,
+				sig:       aggSig,
+				FirstSeen: first.FirstSeen,
+				firstSeen: first.firstSeen,
+			}
+			agg.sortKey = seriesSortKey(aggSig, agg)
+			c.series[aggSig] = agg
+		}
+		members := make([]*MetricSeries, len(sigs))
+		for i, sig := range sigs {
+			members[i] = m.store.Metrics[sig]
+			c.members[sig] = true
+			if members[i].firstSeen < agg.firstSeen {
+				agg.FirstSeen, agg.firstSeen = members[i].FirstSeen, members[i].firstSeen
+			}
+		}
+		values := aggregateValues(members, m.cfg.Aggregate == AggregateAvg)
+		agg.lastSeen = m.store.scrapes
+		// Only a change of the values invalidates the cached row, unless it
+		// shows the age or the new series highlight which change over time
+		if !slices.EqualFunc(values, agg.Values, sameValue) || m.cfg.ShowAge || m.store.IsNew(agg, m.cfg.HighlightNew+1) {
+			agg.Values = values
+			agg.version++
+		}
+	}
+	for sig := range c.series {
+		if !seen[sig] {
+			delete(c.series, sig)
+		}
+	}
+	return c.series, c.members
+}
+
+// aggregateValues returns the sum, or the average if avg, of the values of
+// the series at each point of the history, ignoring missing values. The
+// histories are aligned at the last scrape.
+func aggregateValues(series []*MetricSeries, avg bool) []float64 {
+	n := 0
+	for _, s := range series {
+		n = max(n, len(s.Values))
+	}
+	res := make([]float64, n)
+	for i := range res {
+		sum, count := 0.0, 0
+		for _, s := range series {
+			j := len(s.Values) - n + i
+			if j < 0 || math.IsNaN(s.Values[j]) {
+				continue
+			}
+			sum += s.Values[j]
+			count++
+		}
+		switch {
+		case count == 0:
+			res[i] = math.NaN()
+		case avg:
+			res[i] = sum / float64(count)
+		default:
+			res[i] = sum
+		}
+	}
+	return res
+}
+
+// sameValue reports whether two samples are equal, treating missing values
+// as equal.
+func sameValue(a, b float64) bool {
+	return a == b || math.IsNaN(a) && math.IsNaN(b)
+}
+
+// aggregateFamily returns the name of the family of a series for collapsing,
+// the name of the aggregated series for an aggregate row.
+func (m model) aggregateFamily(series *MetricSeries) string {
+	if series.Derived {
+		if name, ok := strings.CutSuffix(series.Name, ":"+m.cfg.Aggregate); ok {
+			return name
+		}
+	}
+	return series.Name
+}
+
+// toggleCollapsed collapses the family of the selected series to its
+// aggregate rows, hiding the rows of the targets, or expands it again.
+func (m model) toggleCollapsed() model {
+	series := m.selectedSeries()
+	if series == nil {
+		m.notice = "No series selected"
+		return m
+	}
+	if m.cfg.Aggregate == AggregateOff {
+		m.notice = "Turn on aggregate rows with f first"
+		return m
+	}
+	family := m.aggregateFamily(series)
+	if m.collapsed[family] {
+		delete(m.collapsed, family)
+		m.notice = "Expanded " + family
+	} else {
+		m.collapsed[family] = true
+		m.notice = "Collapsed " + family + " to its " + m.cfg.Aggregate + " rows"
+	}
+	m.clampCursor()
+	if m.viewportReady {
+		m.refreshTable()
+	}
+	return m
+}
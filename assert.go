@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Assertion field constants
+const (
+	AssertFieldValue = "value"
+	AssertFieldDelta = "delta"
+)
+
+// assertion is a condition which must hold for every series matching the
+// selector, e.g. `http_requests_total{code="500"} delta < 10`.
+type assertion struct {
+	expr      string
+	selector  *selector
+	field     string
+	op        string
+	threshold float64
+}
+
+// stringList is a flag.Value collecting repeated string flags.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// parseAssertion parses an assertion of the form `<selector> [value|delta] <op> <number>`.
+func parseAssertion(expr string) (*assertion, error) {
+	expr = strings.TrimSpace(expr)
+
+	// The selector ends at the closing brace, or at the first space if it
+	// has no label matchers
+	end := strings.Index(expr, "}") + 1
+	if end == 0 {
+		end = strings.IndexAny(expr, " <>=!")
+		if end == -1 {
+			return nil, fmt.Errorf("assertion %q: missing condition", expr)
+		}
+	}
+	sel, err := parseSelector(expr[:end])
+	if err != nil {
+		return nil, fmt.Errorf("assertion %q: %w", expr, err)
+	}
+
+	fields := strings.Fields(expr[end:])
+	a := &assertion{expr: expr, selector: sel, field: AssertFieldValue}
+	switch len(fields) {
+	case 2:
+		a.op = fields[0]
+		a.threshold, err = strconv.ParseFloat(fields[1], 64)
+	case 3:
+		a.field, a.op = fields[0], fields[1]
+		a.threshold, err = strconv.ParseFloat(fields[2], 64)
+	default:
+		return nil, fmt.Errorf("assertion %q: expected '[value|delta] <op> <number>' after selector", expr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("assertion %q: invalid threshold: %w", expr, err)
+	}
+
+	switch a.field {
+	case AssertFieldValue, AssertFieldDelta:
+	default:
+		return nil, fmt.Errorf("assertion %q: invalid field '%s'. Must be one of: value, delta", expr, a.field)
+	}
+	switch a.op {
+	case "<", "<=", ">", ">=", "==", "!=":
+	default:
+		return nil, fmt.Errorf("assertion %q: invalid operator '%s'", expr, a.op)
+	}
+	return a, nil
+}
+
+// holds reports whether the condition is true for a value.
+func (a *assertion) holds(v float64) bool {
+	switch a.op {
+	case "<":
+		return v < a.threshold
+	case "<=":
+		return v <= a.threshold
+	case ">":
+		return v > a.threshold
+	case ">=":
+		return v >= a.threshold
+	case "==":
+		return v == a.threshold
+	case "!=":
+		return v != a.threshold
+	}
+	return false
+}
+
+// sample returns the asserted value of a series, or false if it is not
+// available (missing, or no previous sample for deltas).
+func (a *assertion) sample(series *MetricSeries) (float64, bool) {
+	n := len(series.Values)
+	if n == 0 || math.IsNaN(series.Values[n-1]) {
+		return 0, false
+	}
+	if a.field == AssertFieldDelta {
+		if n < 2 || math.IsNaN(series.Values[n-2]) {
+			return 0, false
+		}
+		return series.Values[n-1] - series.Values[n-2], true
+	}
+	return series.Values[n-1], true
+}
+
+// runAssertions polls the endpoint for the configured duration and checks
+// the assertions after every scrape. It returns the process exit code: 0 if
+// all assertions held for the whole duration and 1 on the first violation.
+func runAssertions(m model, assertions []*assertion, w io.Writer) int {
+	deadline := time.Now().Add(m.cfg.Duration)
+	matched := make([]bool, len(assertions))
+
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		timestamp := time.Now().Format(time.RFC3339)
+		families, err := m.fetcher.Fetch()
+		if err != nil {
+			fmt.Fprintf(w, "%s error: %v\n", timestamp, err)
+		}
+		// Families are returned along with the error if only some targets failed
+		if families != nil {
+			m.store.UpdateFromFamilies(families)
+			for i, a := range assertions {
+				for _, series := range m.store.Metrics {
+					if !a.selector.matches(series) {
+						continue
+					}
+					matched[i] = true
+					v, ok := a.sample(series)
+					if ok && !a.holds(v) {
+						fmt.Fprintf(w, "%s FAIL %s: %s %s is %s\n", timestamp, a.expr,
+							formatMetricName(series, false), a.field, formatFloat(v))
+						return 1
+					}
+				}
+			}
+		}
+
+		if !time.Now().Before(deadline) {
+			break
+		}
+		<-ticker.C
+	}
+
+	for i, a := range assertions {
+		if !matched[i] {
+			fmt.Fprintf(w, "warning: %s matched no series\n", a.expr)
+		}
+	}
+	fmt.Fprintf(w, "OK: %d assertion(s) held for %s\n", len(assertions), m.cfg.Duration)
+	return 0
+}
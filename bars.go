@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// barWidth is the number of block characters of a gauge bar.
+const barWidth = 8
+
+// gaugeBound is the value range of the gauges matching a metric name regex,
+// configured with -bound.
+type gaugeBound struct {
+	re       *regexp.Regexp
+	min, max float64
+}
+
+// parseBound parses a bound of the form `<name regex>=<min>:<max>`.
+func parseBound(s string) (gaugeBound, error) {
+	i := strings.LastIndex(s, "=")
+	if i < 0 {
+		return gaugeBound{}, fmt.Errorf("invalid bound '%s'. Must be <name regex>=<min>:<max>", s)
+	}
+	lo, hi, ok := strings.Cut(s[i+1:], ":")
+	if !ok {
+		return gaugeBound{}, fmt.Errorf("invalid bound '%s'. Must be <name regex>=<min>:<max>", s)
+	}
+	var b gaugeBound
+	var err error
+	if b.re, err = regexp.Compile("^(?:" + s[:i] + ")$"); err != nil {
+		return gaugeBound{}, fmt.Errorf("bound '%s': %v", s, err)
+	}
+	if b.min, err = strconv.ParseFloat(lo, 64); err != nil {
+		return gaugeBound{}, fmt.Errorf("bound '%s': %v", s, err)
+	}
+	if b.max, err = strconv.ParseFloat(hi, 64); err != nil {
+		return gaugeBound{}, fmt.Errorf("bound '%s': %v", s, err)
+	}
+	if b.max <= b.min {
+		return gaugeBound{}, fmt.Errorf("bound '%s': max must be greater than min", s)
+	}
+	return b, nil
+}
+
+func parseBounds(specs []string) ([]gaugeBound, error) {
+	var bounds []gaugeBound
+	for _, spec := range specs {
+		b, err := parseBound(spec)
+		if err != nil {
+			return nil, err
+		}
+		bounds = append(bounds, b)
+	}
+	return bounds, nil
+}
+
+// gaugeRange returns the value range of a gauge: the first configured bound
+// matching its name, or one inferred from a _ratio or _percent suffix.
+func (m model) gaugeRange(series *MetricSeries) (float64, float64, bool) {
+	if series.Type == dto.MetricType_COUNTER {
+		return 0, 0, false
+	}
+	for _, b := range m.bounds {
+		if b.re.MatchString(series.Name) {
+			return b.min, b.max, true
+		}
+	}
+	switch {
+	case strings.HasSuffix(series.Name, "_ratio"):
+		return 0, 1, true
+	case strings.HasSuffix(series.Name, "_percent"), strings.HasSuffix(series.Name, "_percentage"):
+		return 0, 100, true
+	}
+	return 0, 0, false
+}
+
+// gaugeBar renders a value within [lo, hi] as a bar and percentage, e.g.
+// "▓▓▓▓▓░░░ 62%". Values outside the range are clamped.
+func gaugeBar(val, lo, hi float64) string {
+	fraction := math.Min(math.Max((val-lo)/(hi-lo), 0), 1)
+	filled := int(math.Round(fraction * barWidth))
+	return strings.Repeat("▓", filled) + strings.Repeat("░", barWidth-filled) + fmt.Sprintf(" %3.0f%%", fraction*100)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// loadBaseline reads a history file written with -export and returns the
+// newest value of each series by signature.
+func loadBaseline(path string) (map[string]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 || len(records[0]) < 2 || records[0][0] != "series" {
+		return nil, fmt.Errorf("%s: not a history file written with -export", path)
+	}
+
+	values := len(records[0])
+	if records[0][values-1] == "note" {
+		values--
+	}
+	baseline := make(map[string]float64, len(records)-1)
+	for _, record := range records[1:] {
+		// Values are oldest first, with empty cells for missing samples
+		for i := min(len(record), values) - 1; i > 0; i-- {
+			if record[i] == "" {
+				continue
+			}
+			v, err := strconv.ParseFloat(record[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: series %s: %w", path, record[0], err)
+			}
+			baseline[record[0]] = v
+			break
+		}
+	}
+	return baseline, nil
+}
+
+// baselineDiff returns the current value of a series minus its baseline, and
+// false if either is missing.
+func (m model) baselineDiff(series *MetricSeries) (float64, bool) {
+	if len(series.Values) == 0 {
+		return 0, false
+	}
+	base, ok := m.baseline[series.signature()]
+	current := series.Values[len(series.Values)-1]
+	if !ok || math.IsNaN(current) {
+		return 0, false
+	}
+	return current - base, true
+}
+
+// formatBaselineCell formats the "vs base" column of a series.
+func (m model) formatBaselineCell(series *MetricSeries, style lipgloss.Style) string {
+	diff, ok := m.baselineDiff(series)
+	if !ok {
+		return ""
+	}
+	return m.formatDeltaCell(series.Unit, diff, style)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// binding runs a shell command for the selected series on a key, see -bind.
+type binding struct {
+	key     string
+	command string
+}
+
+// bindingDoneMsg is sent when the command of a binding exits.
+type bindingDoneMsg struct {
+	key string
+	err error
+}
+
+// parseBindings parses bindings of the form `<key>=<command>`, e.g.
+// `f2=kubectl describe pod "$OMT_LABEL_pod" | less`. Keys are named like
+// bubbletea names them, e.g. K, ctrl+o or f2.
+func parseBindings(specs []string) ([]binding, error) {
+	var bindings []binding
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		key, command, ok := strings.Cut(spec, "=")
+		key, command = strings.TrimSpace(key), strings.TrimSpace(command)
+		if !ok || key == "" || command == "" {
+			return nil, fmt.Errorf("invalid binding '%s'. Must be <key>=<command>", spec)
+		}
+		if key == "q" || key == "ctrl+c" {
+			return nil, fmt.Errorf("invalid binding '%s': %s quits", spec, key)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("invalid binding '%s': %s is bound twice", spec, key)
+		}
+		seen[key] = true
+		bindings = append(bindings, binding{key: key, command: command})
+	}
+	return bindings, nil
+}
+
+// bindingFor returns the binding of a key.
+func (m model) bindingFor(key string) (binding, bool) {
+	for _, b := range m.bindings {
+		if b.key == key {
+			return b, true
+		}
+	}
+	return binding{}, false
+}
+
+// runBinding runs the command of a binding with sh, suspending the UI while
+// it runs so it may be interactive.
+func (m model) runBinding(b binding) (model, tea.Cmd) {
+	series := m.selectedSeries()
+	if series == nil {
+		m.notice = "No series selected"
+		return m, nil
+	}
+	c := exec.Command("sh", "-c", b.command)
+	c.Env = append(os.Environ(), bindingEnv(series)...)
+	return m, tea.ExecProcess(c, func(err error) tea.Msg {
+		return bindingDoneMsg{key: b.key, err: err}
+	})
+}
+
+// bindingEnv returns the environment describing a series to the command of
+// a binding:
+//
+//	OMT_METRIC         metric name
+//	OMT_LABELS         labels as name=value, comma separated and sorted
+//	OMT_LABEL_<name>   value of each label with a name valid in sh
+//	OMT_SERIES         series selector, e.g. up{job="node"}
+//	OMT_VALUE          current value, empty if missing
+//	OMT_PROMQL         PromQL query as copied with y
+//	OMT_PROMQL_QUERY   the same, escaped for use in a URL query
+func bindingEnv(series *MetricSeries) []string {
+	names := make([]string, 0, len(series.Labels))
+	for name := range series.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	var env []string
+	for _, name := range names {
+		pairs = append(pairs, name+"="+series.Labels[name])
+		if validEnvName(name) {
+			env = append(env, "OMT_LABEL_"+name+"="+series.Labels[name])
+		}
+	}
+
+	var value string
+	if len(series.Values) > 0 {
+		if v := series.Values[len(series.Values)-1]; !math.IsNaN(v) {
+			value = strconv.FormatFloat(v, 'g', -1, 64)
+		}
+	}
+	query := promQLFor(series)
+	return append(env,
+		"OMT_METRIC="+series.Name,
+		"OMT_LABELS="+strings.Join(pairs, ","),
+		"OMT_SERIES="+series.signature(),
+		"OMT_VALUE="+value,
+		"OMT_PROMQL="+query,
+		"OMT_PROMQL_QUERY="+url.QueryEscape(query),
+	)
+}
+
+// validEnvName reports whether name can be used in an environment variable
+// name referenced from sh.
+func validEnvName(name string) bool {
+	for _, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// Cardinality explorer sort orders
+const (
+	CardinalitySortSeries = "series" // Most series first
+	CardinalitySortName   = "name"
+)
+
+// cardinalityView is the state of the cardinality explorer, which replaces
+// the table while open.
+type cardinalityView struct {
+	sort    string
+	yOffset int // Scroll position of the table, restored on close
+}
+
+// familyCardinality is the number of series of a metric family and the
+// number of distinct values of each of its label keys.
+type familyCardinality struct {
+	name   string
+	series int
+	labels []labelCardinality // Most distinct values first
+}
+
+type labelCardinality struct {
+	name   string
+	values int
+}
+
+// familyCardinalities aggregates the series in the store by metric family.
+func (m model) familyCardinalities(sortMode string) []familyCardinality {
+	series := make(map[string]int)
+	values := make(map[string]map[string]map[string]bool) // By family and label key
+	for _, s := range m.store.Metrics {
+		series[s.Name]++
+		keys := values[s.Name]
+		if keys == nil {
+			keys = make(map[string]map[string]bool)
+			values[s.Name] = keys
+		}
+		for k, v := range s.Labels {
+			if keys[k] == nil {
+				keys[k] = make(map[string]bool)
+			}
+			keys[k][v] = true
+		}
+	}
+
+	families := make([]familyCardinality, 0, len(series))
+	for name, n := range series {
+		f := familyCardinality{name: name, series: n}
+		for k, vals := range values[name] {
+			f.labels = append(f.labels, labelCardinality{name: k, values: len(vals)})
+		}
+		slices.SortFunc(f.labels, func(a, b labelCardinality) int {
+			return cmp.Or(cmp.Compare(b.values, a.values), cmp.Compare(a.name, b.name))
+		})
+		families = append(families, f)
+	}
+	slices.SortFunc(families, func(a, b familyCardinality) int {
+		if sortMode == CardinalitySortSeries {
+			if c := cmp.Compare(b.series, a.series); c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(a.name, b.name)
+	})
+	return families
+}
+
+// toggleCardinality opens or closes the cardinality explorer.
+func (m model) toggleCardinality() model {
+	if m.cardinality != nil {
+		yOffset := m.cardinality.yOffset
+		m.cardinality = nil
+		if m.viewportReady {
+			m.refreshTable()
+			m.viewport.SetYOffset(yOffset)
+			m.ensureRendered()
+		}
+		return m
+	}
+	m.cardinality = &cardinalityView{sort: CardinalitySortSeries, yOffset: m.viewport.YOffset}
+	if m.viewportReady {
+		m.refreshTable()
+		m.viewport.GotoTop()
+	}
+	return m
+}
+
+// updateCardinality handles keys while the cardinality explorer is open.
+func (m model) updateCardinality(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return m, tea.Quit
+	case "C", "esc":
+		return m.toggleCardinality(), nil
+	case "o":
+		// Toggle between sorting by series count and by name
+		if m.cardinality.sort == CardinalitySortSeries {
+			m.cardinality.sort = CardinalitySortName
+		} else {
+			m.cardinality.sort = CardinalitySortSeries
+		}
+		m.refreshTable()
+		return m, nil
+	case "up", "k":
+		m.viewport.ScrollUp(1)
+		return m, nil
+	case "down", "j":
+		m.viewport.ScrollDown(1)
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.viewport, cmd = m.viewport.Update(msg)
+	return m, cmd
+}
+
+// refreshCardinality renders the cardinality explorer in place of the
+// table.
+func (m *model) refreshCardinality() {
+	families := m.familyCardinalities(m.cardinality.sort)
+	rows := make([][]string, 0, len(families))
+	for _, f := range families {
+		var labels []string
+		for i, l := range f.labels {
+			text := fmt.Sprintf("%s %d", displayName(l.name, true, m.cfg.EscapedNames), l.values)
+			if i == 0 {
+				// The label most likely to be exploding the family
+				text = m.currentValueStyle.Render(text)
+			}
+			labels = append(labels, text)
+		}
+		rows = append(rows, []string{
+			m.metricNameStyle.Render(displayName(f.name, false, m.cfg.EscapedNames)),
+			strconv.Itoa(f.series),
+			strings.Join(labels, ", "),
+		})
+	}
+	headers := []string{"Family", "Series", "Distinct values by label"}
+
+	// Cut off the label column, then shorten the names, to fit the terminal
+	widths := calculateColumnWidths(headers, rows)
+	borders := m.explorerBorders(len(widths))
+	nameWidth := min(widths[0], max(m.width-borders-widths[1]-widths[2], minNameWidth))
+	labelsWidth := max(m.width-borders-nameWidth-widths[1], lipgloss.Width(headers[2]))
+	for _, row := range rows {
+		row[0] = elideName(row[0], nameWidth)
+		row[2] = ansi.Truncate(row[2], labelsWidth, "…")
+	}
+
+	m.renderExplorer(headers, rows, func(col int) bool { return col == 1 })
+}
+
+// renderExplorer renders a table replacing the metrics table, such as the
+// cardinality explorer, with the header rows kept above the viewport as for
+// the metrics table. Columns for which right returns true are right aligned.
+func (m *model) renderExplorer(headers []string, rows [][]string, right func(col int) bool) {
+	t := table.New().
+		Border(lipgloss.RoundedBorder()).
+		BorderStyle(lipgloss.NewStyle().Foreground(color("240"))).
+		Headers(headers...).
+		Rows(rows...)
+	if m.cfg.Density == DensityCompact {
+		t = t.Border(lipgloss.Border{Left: " "}).
+			BorderTop(false).
+			BorderBottom(false).
+			BorderLeft(false).
+			BorderRight(false).
+			BorderHeader(false)
+	}
+	t = t.StyleFunc(func(row, col int) lipgloss.Style {
+		style := lipgloss.NewStyle()
+		if row == table.HeaderRow && m.cfg.Density == DensityCompact {
+			style = style.Underline(true)
+		}
+		if right(col) {
+			style = style.Align(lipgloss.Right)
+		}
+		return style
+	})
+
+	lines := strings.Split(t.Render(), "\n")
+	headerLines := m.tableHeaderLines()
+	m.tableHeader = strings.Join(lines[:min(headerLines, len(lines))], "\n")
+	lines = lines[min(headerLines, len(lines)):]
+	// Everything is rendered, see ensureRendered
+	m.renderedFrom, m.renderedTo = 0, math.MaxInt
+
+	m.resizeViewport()
+	m.viewport.SetContent(strings.Join(lines, "\n"))
+}
+
+// explorerBorders returns the width taken by the borders of a table of cols
+// columns rendered by renderExplorer.
+func (m model) explorerBorders(cols int) int {
+	if m.cfg.Density == DensityCompact {
+		return cols - 1
+	}
+	return cols + 1
+}
+
+// cardinalityStatus returns the footer status of the cardinality explorer.
+func (m model) cardinalityStatus() string {
+	families := make(map[string]bool)
+	for _, s := range m.store.Metrics {
+		families[s.Name] = true
+	}
+	return fmt.Sprintf("Cardinality: %d families, %d series, by %s (o to sort, C to close)", len(families), len(m.store.Metrics), m.cardinality.sort)
+}
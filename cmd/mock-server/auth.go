@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Auth protects /metrics with basic auth and/or a bearer token. A request is
+// accepted if it satisfies any of the configured methods.
+type Auth struct {
+	BasicAuth   string // "user:password"
+	BearerToken string
+}
+
+func (a Auth) enabled() bool {
+	return a.BasicAuth != "" || a.BearerToken != ""
+}
+
+func (a Auth) authorized(r *http.Request) bool {
+	if a.BasicAuth != "" {
+		if user, pass, ok := r.BasicAuth(); ok && secureEqual(user+":"+pass, a.BasicAuth) {
+			return true
+		}
+	}
+	if a.BearerToken != "" {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && secureEqual(token, a.BearerToken) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wrap returns a handler answering 401 to unauthorized requests.
+func (a Auth) Wrap(next http.HandlerFunc) http.HandlerFunc {
+	if !a.enabled() {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.authorized(r) {
+			if a.BasicAuth != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="mock-server"`)
+			} else {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
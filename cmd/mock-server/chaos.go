@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+)
+
+// Chaos injects faults into /metrics responses to exercise client timeout,
+// retry and error handling.
+type Chaos struct {
+	Latency      time.Duration // Delay before each response
+	ErrorRate    float64       // Probability of a 5xx response
+	TruncateRate float64       // Probability of a truncated/corrupt body
+}
+
+func (c Chaos) enabled() bool {
+	return c.Latency > 0 || c.ErrorRate > 0 || c.TruncateRate > 0
+}
+
+// Wrap returns a handler applying the configured faults around next.
+func (c Chaos) Wrap(next http.HandlerFunc) http.HandlerFunc {
+	if !c.enabled() {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c.Latency > 0 {
+			select {
+			case <-time.After(c.Latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if rng.Float64() < c.ErrorRate {
+			codes := []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable}
+			code := codes[rng.Intn(len(codes))]
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		if rng.Float64() >= c.TruncateRate {
+			next(w, r)
+			return
+		}
+
+		buf := &bufferedResponse{header: w.Header(), code: http.StatusOK}
+		next(buf, r)
+		body := buf.body.Bytes()
+		if len(body) > 0 {
+			body = body[:rng.Intn(len(body))]
+		}
+		if rng.Intn(2) == 0 {
+			// Corrupt rather than just cut off the last line
+			body = append(body, "\x00{{garbage"...)
+		}
+		w.WriteHeader(buf.code)
+		w.Write(body)
+	}
+}
+
+// bufferedResponse collects a response so it can be modified before sending.
+type bufferedResponse struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header         { return b.header }
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *bufferedResponse) WriteHeader(code int)        { b.code = code }
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// churnSeries is a short-lived series of a pod or batch job.
+type churnSeries struct {
+	pod   string
+	job   string
+	cpu   float64
+	items float64
+}
+
+// ChurnSource adds a pool of short-lived series to the output of another
+// source. On every update a fraction of them is replaced by new label sets,
+// like pods being rescheduled and batch jobs completing.
+type ChurnSource struct {
+	mu     sync.Mutex
+	inner  Source
+	rate   float64
+	series []*churnSeries
+	nextID int
+}
+
+func NewChurnSource(inner Source, n int, rate float64) *ChurnSource {
+	s := &ChurnSource{inner: inner, rate: rate}
+	for i := 0; i < n; i++ {
+		s.series = append(s.series, s.newSeries())
+	}
+	return s
+}
+
+func (s *ChurnSource) newSeries() *churnSeries {
+	s.nextID++
+	return &churnSeries{
+		pod: fmt.Sprintf("worker-%05x", rng.Intn(1<<20)),
+		job: fmt.Sprintf("batch-%d", s.nextID),
+	}
+}
+
+func (s *ChurnSource) Update() {
+	s.inner.Update()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, series := range s.series {
+		if rng.Float64() < s.rate {
+			s.series[i] = s.newSeries()
+			continue
+		}
+		series.cpu += rng.Float64() * 2
+		series.items += float64(rng.Intn(50))
+	}
+}
+
+func (s *ChurnSource) Write(w io.Writer) {
+	s.inner.Write(w)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintln(w, "# HELP worker_cpu_seconds_total CPU time used by short-lived workers.")
+	fmt.Fprintln(w, "# TYPE worker_cpu_seconds_total counter")
+	for _, series := range s.series {
+		fmt.Fprintf(w, "worker_cpu_seconds_total{job=%q,pod=%q} %g\n", series.job, series.pod, series.cpu)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "# HELP worker_items_processed_total Items processed by short-lived workers.")
+	fmt.Fprintln(w, "# TYPE worker_items_processed_total counter")
+	for _, series := range s.series {
+		fmt.Fprintf(w, "worker_items_processed_total{job=%q,pod=%q} %g\n", series.job, series.pod, series.items)
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// Behavior constants
+const (
+	BehaviorLinear     = "linear"
+	BehaviorSine       = "sine"
+	BehaviorRandomWalk = "random_walk"
+)
+
+// Config defines the metrics served by the mock server, e.g.
+//
+//	metrics:
+//	  - name: orders_processed_total
+//	    type: counter
+//	    help: Orders processed.
+//	    labels:
+//	      - name: region
+//	        values: [eu, us]
+//	    behavior: linear
+//	    rate: 5
+//	  - name: queue_depth
+//	    type: gauge
+//	    behavior: sine
+//	    min: 0
+//	    max: 100
+//	    period: 60s
+type Config struct {
+	Metrics []MetricConfig `yaml:"metrics"`
+}
+
+type MetricConfig struct {
+	Name     string        `yaml:"name"`
+	Type     string        `yaml:"type"` // counter or gauge
+	Help     string        `yaml:"help"`
+	Labels   []LabelConfig `yaml:"labels"`
+	Behavior string        `yaml:"behavior"`
+	Min      float64       `yaml:"min"`
+	Max      float64       `yaml:"max"`
+	Rate     float64       `yaml:"rate"`   // Increase per update for linear
+	Period   time.Duration `yaml:"period"` // Period for sine
+	Step     float64       `yaml:"step"`   // Maximum change per update for random_walk
+}
+
+type LabelConfig struct {
+	Name   string   `yaml:"name"`
+	Values []string `yaml:"values"`
+}
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, err
+	}
+	for i := range cfg.Metrics {
+		if err := cfg.Metrics[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &cfg, nil
+}
+
+func (mc *MetricConfig) validate() error {
+	if mc.Name == "" {
+		return fmt.Errorf("metric without name")
+	}
+	switch mc.Type {
+	case "counter", "gauge":
+	default:
+		return fmt.Errorf("metric %s: invalid type '%s'. Must be one of: counter, gauge", mc.Name, mc.Type)
+	}
+	switch mc.Behavior {
+	case "":
+		mc.Behavior = BehaviorRandomWalk
+	case BehaviorLinear, BehaviorSine, BehaviorRandomWalk:
+	default:
+		return fmt.Errorf("metric %s: invalid behavior '%s'. Must be one of: linear, sine, random_walk", mc.Name, mc.Behavior)
+	}
+	if mc.Max < mc.Min {
+		return fmt.Errorf("metric %s: max is less than min", mc.Name)
+	}
+	if mc.Max == mc.Min && mc.Type == "gauge" {
+		mc.Max = mc.Min + 100
+	}
+	if mc.Rate == 0 {
+		mc.Rate = 1
+	}
+	if mc.Period == 0 {
+		mc.Period = time.Minute
+	}
+	if mc.Step == 0 {
+		mc.Step = math.Max((mc.Max-mc.Min)/20, 1)
+	}
+	return nil
+}
+
+// configSeries is one label combination of a configured metric.
+type configSeries struct {
+	labels string  // Rendered label set, e.g. {region="eu"}
+	phase  float64 // Offset into the behavior cycle in [0, 1) so series differ
+	value  float64
+}
+
+// ConfigState serves metrics defined by a Config.
+type ConfigState struct {
+	mu      sync.Mutex
+	cfg     *Config
+	series  [][]*configSeries // Per metric, in config order
+	updates int
+	start   time.Time
+}
+
+func NewConfigState(cfg *Config) *ConfigState {
+	s := &ConfigState{cfg: cfg, start: clock.Now()}
+	for _, mc := range cfg.Metrics {
+		var series []*configSeries
+		combos := labelCombinations(mc.Labels)
+		for i, labels := range combos {
+			phase := float64(i) / float64(len(combos))
+			series = append(series, &configSeries{labels: labels, phase: phase, value: mc.Min})
+		}
+		s.series = append(s.series, series)
+	}
+	return s
+}
+
+// labelCombinations returns all rendered label sets of the cross product of
+// the label values.
+func labelCombinations(labels []LabelConfig) []string {
+	combos := [][]string{{}}
+	for _, l := range labels {
+		var next [][]string
+		for _, combo := range combos {
+			for _, v := range l.Values {
+				pair := fmt.Sprintf("%s=%q", l.Name, v)
+				next = append(next, append(append([]string{}, combo...), pair))
+			}
+		}
+		combos = next
+	}
+
+	res := make([]string, 0, len(combos))
+	for _, combo := range combos {
+		if len(combo) == 0 {
+			res = append(res, "")
+			continue
+		}
+		sort.Strings(combo)
+		res = append(res, "{"+strings.Join(combo, ",")+"}")
+	}
+	return res
+}
+
+func (s *ConfigState) Update() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.updates++
+	elapsed := clock.Now().Sub(s.start)
+	for i, mc := range s.cfg.Metrics {
+		for _, series := range s.series[i] {
+			series.value = mc.next(series.value, series.phase, s.updates, elapsed)
+		}
+	}
+}
+
+// next returns the value following v for the configured behavior. Counters
+// never decrease.
+func (mc *MetricConfig) next(v, phase float64, updates int, elapsed time.Duration) float64 {
+	switch mc.Behavior {
+	case BehaviorLinear:
+		if mc.Type == "counter" {
+			return v + mc.Rate
+		}
+		// Gauges ramp from min to max and wrap around
+		span := mc.Max - mc.Min
+		return mc.Min + math.Mod(float64(updates)*mc.Rate+phase*span, span)
+	case BehaviorSine:
+		angle := 2 * math.Pi * (elapsed.Seconds()/mc.Period.Seconds() + phase)
+		wave := mc.Min + (mc.Max-mc.Min)*(0.5+0.5*math.Sin(angle))
+		if mc.Type == "counter" {
+			// The sine defines the rate of increase
+			return v + wave
+		}
+		return wave
+	default:
+		if mc.Type == "counter" {
+			return v + rng.Float64()*mc.Step
+		}
+		v += (rng.Float64()*2 - 1) * mc.Step
+		return math.Min(math.Max(v, mc.Min), mc.Max)
+	}
+}
+
+func (s *ConfigState) Write(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, mc := range s.cfg.Metrics {
+		if mc.Help != "" {
+			fmt.Fprintf(w, "# HELP %s %s\n", mc.Name, mc.Help)
+		}
+		fmt.Fprintf(w, "# TYPE %s %s\n", mc.Name, mc.Type)
+		for _, series := range s.series[i] {
+			fmt.Fprintf(w, "%s%s %g\n", mc.Name, series.labels, series.value)
+		}
+		fmt.Fprintln(w)
+	}
+}
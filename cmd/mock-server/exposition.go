@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	promModel "github.com/prometheus/common/model"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Exposition format constants for the -format flag
+const (
+	FormatAuto        = "auto"
+	FormatText        = "text"
+	FormatOpenMetrics = "openmetrics"
+	FormatProtobuf    = "protobuf"
+)
+
+// startTime is reported as the creation time of all counters, histograms and
+// summaries, see seedRandom.
+var startTime = time.Now()
+
+// negotiateFormat picks the exposition format for a request. In auto mode the
+// Accept header decides, falling back to the Prometheus text format.
+func negotiateFormat(r *http.Request, format string) expfmt.Format {
+	switch format {
+	case FormatText:
+		return expfmt.NewFormat(expfmt.TypeTextPlain)
+	case FormatOpenMetrics:
+		return expfmt.NewFormat(expfmt.TypeOpenMetrics)
+	case FormatProtobuf:
+		return expfmt.NewFormat(expfmt.TypeProtoDelim)
+	}
+	return expfmt.NegotiateIncludingOpenMetrics(r.Header)
+}
+
+// writeExposition writes the current state of a source in the negotiated
+// format. The text format is written as generated by the source, other
+// formats are re-encoded from the parsed text.
+func writeExposition(w http.ResponseWriter, r *http.Request, state Source, format string) {
+	f := negotiateFormat(r, format)
+	if f.FormatType() == expfmt.TypeTextPlain {
+		w.Header().Set("Content-Type", string(f))
+		state.Write(w)
+		return
+	}
+
+	var buf bytes.Buffer
+	state.Write(&buf)
+	parser := expfmt.NewTextParser(promModel.UTF8Validation)
+	families, err := parser.TextToMetricFamilies(&buf)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("encoding metrics: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", string(f))
+	enc := expfmt.NewEncoder(w, f, expfmt.WithCreatedLines())
+	for _, name := range names {
+		family := families[name]
+		addCreatedAndExemplars(family)
+		if f.FormatType() == expfmt.TypeProtoDelim {
+			addNativeHistograms(family)
+		}
+		if err := enc.Encode(family); err != nil {
+			return
+		}
+	}
+	if closer, ok := enc.(expfmt.Closer); ok {
+		closer.Close()
+	}
+}
+
+// addCreatedAndExemplars sets the created timestamp of counters, histograms
+// and summaries, and attaches an exemplar with a random trace ID to counters
+// and histogram buckets.
+func addCreatedAndExemplars(family *dto.MetricFamily) {
+	created := timestamppb.New(startTime)
+	now := timestamppb.New(clock.Now())
+	for _, metric := range family.GetMetric() {
+		switch family.GetType() {
+		case dto.MetricType_COUNTER:
+			metric.Counter.CreatedTimestamp = created
+			metric.Counter.Exemplar = newExemplar(1, now)
+		case dto.MetricType_HISTOGRAM:
+			metric.Histogram.CreatedTimestamp = created
+			lower := 0.0
+			for _, bucket := range metric.Histogram.GetBucket() {
+				// Pick an observation inside the bucket
+				value := lower + (bucket.GetUpperBound()-lower)/2
+				if math.IsInf(bucket.GetUpperBound(), 1) {
+					value = lower * 2
+				}
+				bucket.Exemplar = newExemplar(value, now)
+				lower = bucket.GetUpperBound()
+			}
+		case dto.MetricType_SUMMARY:
+			metric.Summary.CreatedTimestamp = created
+		}
+	}
+}
+
+func newExemplar(value float64, ts *timestamppb.Timestamp) *dto.Exemplar {
+	id := make([]byte, 8)
+	readRandom(id)
+	return &dto.Exemplar{
+		Label:     []*dto.LabelPair{{Name: proto.String("trace_id"), Value: proto.String(hex.EncodeToString(id))}},
+		Value:     proto.Float64(value),
+		Timestamp: ts,
+	}
+}
+
+// addNativeHistograms adds a native histogram representation (schema 0,
+// i.e. power-of-two buckets) next to the classic buckets of each histogram.
+// Only the protobuf format can carry native histograms.
+func addNativeHistograms(family *dto.MetricFamily) {
+	if family.GetType() != dto.MetricType_HISTOGRAM {
+		return
+	}
+	for _, metric := range family.GetMetric() {
+		h := metric.Histogram
+		counts := map[int32]int64{}
+		lower := 0.0
+		var cumulative uint64
+		for _, bucket := range h.GetBucket() {
+			upper := bucket.GetUpperBound()
+			index := int32(math.Ceil(math.Log2(upper)))
+			if math.IsInf(upper, 1) {
+				// Overflow observations land in the bucket above the last bound
+				index = int32(math.Ceil(math.Log2(lower))) + 1
+			}
+			counts[index] += int64(bucket.GetCumulativeCount() - cumulative)
+			cumulative = bucket.GetCumulativeCount()
+			lower = upper
+		}
+
+		indexes := make([]int32, 0, len(counts))
+		for index := range counts {
+			indexes = append(indexes, index)
+		}
+		sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+		h.Schema = proto.Int32(0)
+		h.ZeroThreshold = proto.Float64(0)
+		h.ZeroCount = proto.Uint64(0)
+		h.PositiveSpan = nil
+		h.PositiveDelta = nil
+		var prevIndex int32
+		var prevCount int64
+		for i, index := range indexes {
+			switch {
+			case i == 0:
+				h.PositiveSpan = append(h.PositiveSpan, &dto.BucketSpan{Offset: proto.Int32(index), Length: proto.Uint32(1)})
+			case index == prevIndex+1:
+				span := h.PositiveSpan[len(h.PositiveSpan)-1]
+				span.Length = proto.Uint32(span.GetLength() + 1)
+			default:
+				h.PositiveSpan = append(h.PositiveSpan, &dto.BucketSpan{Offset: proto.Int32(index - prevIndex - 1), Length: proto.Uint32(1)})
+			}
+			h.PositiveDelta = append(h.PositiveDelta, counts[index]-prevCount)
+			prevIndex, prevCount = index, counts[index]
+		}
+	}
+}
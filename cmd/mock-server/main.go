@@ -1,11 +1,17 @@
 package main
 
 import (
+	"cmp"
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"io"
+	"maps"
 	"math"
-	"math/rand"
 	"net/http"
+	"os"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 )
@@ -107,35 +113,35 @@ func NewMetricsState() *MetricsState {
 					multiplier = 1.5
 				}
 				if code == "200" || code == "201" {
-					s.httpRequests[key] = float64(rand.Intn(5000)) * multiplier
+					s.httpRequests[key] = float64(rng.Intn(5000)) * multiplier
 				} else {
-					s.httpRequests[key] = float64(rand.Intn(100)) * multiplier
+					s.httpRequests[key] = float64(rng.Intn(100)) * multiplier
 				}
 			}
 
 			// Initialize byte counters
 			reqKey := fmt.Sprintf("%s:%s", method, endpoint)
-			s.httpRequestBytes[reqKey] = float64(rand.Intn(1000000))
+			s.httpRequestBytes[reqKey] = float64(rng.Intn(1000000))
 
 			for _, code := range codes {
 				respKey := fmt.Sprintf("%s:%s:%s", method, endpoint, code)
-				s.httpResponseBytes[respKey] = float64(rand.Intn(5000000))
+				s.httpResponseBytes[respKey] = float64(rng.Intn(5000000))
 			}
 
 			// Initialize active connections gauge
-			s.httpConnectionsActive[reqKey] = float64(rand.Intn(10))
+			s.httpConnectionsActive[reqKey] = float64(rng.Intn(10))
 
 			// Initialize request duration gauge
-			s.httpRequestDurationCurrent[reqKey] = 0.05 + rand.Float64()*0.2
+			s.httpRequestDurationCurrent[reqKey] = 0.05 + rng.Float64()*0.2
 		}
 	}
 
 	// Initialize WebSocket metrics
 	channels := []string{"chat", "notifications", "updates"}
 	for _, channel := range channels {
-		s.websocketMessages[fmt.Sprintf("sent:%s", channel)] = float64(rand.Intn(10000))
-		s.websocketMessages[fmt.Sprintf("received:%s", channel)] = float64(rand.Intn(10000))
-		s.websocketConnectionsActive[channel] = float64(20 + rand.Intn(50))
+		s.websocketMessages[fmt.Sprintf("sent:%s", channel)] = float64(rng.Intn(10000))
+		s.websocketMessages[fmt.Sprintf("received:%s", channel)] = float64(rng.Intn(10000))
+		s.websocketConnectionsActive[channel] = float64(20 + rng.Intn(50))
 	}
 
 	// Initialize API error counters
@@ -144,7 +150,7 @@ func NewMetricsState() *MetricsState {
 		for _, endpoint := range endpoints {
 			for _, errType := range errorTypes {
 				key := fmt.Sprintf("%s:%s:%s", method, endpoint, errType)
-				s.apiErrors[key] = float64(rand.Intn(50))
+				s.apiErrors[key] = float64(rng.Intn(50))
 			}
 		}
 	}
@@ -155,9 +161,9 @@ func NewMetricsState() *MetricsState {
 		for _, tier := range tiers {
 			key := fmt.Sprintf("%s:%s", endpoint, tier)
 			if tier == "premium" {
-				s.apiRateLimitRemaining[key] = float64(8000 + rand.Intn(2000))
+				s.apiRateLimitRemaining[key] = float64(8000 + rng.Intn(2000))
 			} else {
-				s.apiRateLimitRemaining[key] = float64(800 + rand.Intn(200))
+				s.apiRateLimitRemaining[key] = float64(800 + rng.Intn(200))
 			}
 		}
 	}
@@ -165,12 +171,12 @@ func NewMetricsState() *MetricsState {
 	// Initialize server goroutines
 	handlers := []string{"api", "static", "websocket"}
 	for _, handler := range handlers {
-		s.httpServerGoroutines[handler] = float64(50 + rand.Intn(50))
+		s.httpServerGoroutines[handler] = float64(50 + rng.Intn(50))
 	}
 
 	// Initialize bandwidth
-	s.bandwidthUsageMbps["inbound"] = 5 + rand.Float64()*10
-	s.bandwidthUsageMbps["outbound"] = 10 + rand.Float64()*20
+	s.bandwidthUsageMbps["inbound"] = 5 + rng.Float64()*10
+	s.bandwidthUsageMbps["outbound"] = 10 + rng.Float64()*20
 
 	return s
 }
@@ -199,7 +205,7 @@ func (s *MetricsState) Update() {
 	}
 
 	// Generate random requests
-	numRequests := rand.Intn(5) + 1
+	numRequests := rng.Intn(5) + 1
 	for i := 0; i < numRequests; i++ {
 		// Pick random method and endpoint based on weights
 		method := weightedChoice(methods, methodWeights)
@@ -207,7 +213,7 @@ func (s *MetricsState) Update() {
 
 		// Determine status code (85% success, 10% client error, 5% server error)
 		var code string
-		r := rand.Float64()
+		r := rng.Float64()
 		if r < 0.85 {
 			if method == "post" || method == "put" {
 				code = "201"
@@ -216,10 +222,10 @@ func (s *MetricsState) Update() {
 			}
 		} else if r < 0.95 {
 			codes := []string{"400", "401", "404"}
-			code = codes[rand.Intn(len(codes))]
+			code = codes[rng.Intn(len(codes))]
 		} else {
 			codes := []string{"500", "503"}
-			code = codes[rand.Intn(len(codes))]
+			code = codes[rng.Intn(len(codes))]
 		}
 
 		// Update request counter
@@ -229,30 +235,30 @@ func (s *MetricsState) Update() {
 		// Update byte counters
 		reqKey := fmt.Sprintf("%s:%s", method, endpoint)
 		if method == "post" || method == "put" || method == "patch" {
-			s.httpRequestBytes[reqKey] += float64(500 + rand.Intn(5000))
+			s.httpRequestBytes[reqKey] += float64(500 + rng.Intn(5000))
 		} else {
-			s.httpRequestBytes[reqKey] += float64(100 + rand.Intn(500))
+			s.httpRequestBytes[reqKey] += float64(100 + rng.Intn(500))
 		}
 
 		respKey := fmt.Sprintf("%s:%s:%s", method, endpoint, code)
 		if method == "get" && (code == "200" || code == "201") {
-			s.httpResponseBytes[respKey] += float64(1000 + rand.Intn(10000))
+			s.httpResponseBytes[respKey] += float64(1000 + rng.Intn(10000))
 		} else {
-			s.httpResponseBytes[respKey] += float64(200 + rand.Intn(1000))
+			s.httpResponseBytes[respKey] += float64(200 + rng.Intn(1000))
 		}
 
 		// Occasionally generate errors
-		if code == "500" || code == "503" || rand.Float64() < 0.05 {
+		if code == "500" || code == "503" || rng.Float64() < 0.05 {
 			errorTypes := []string{"timeout", "validation", "internal"}
-			errType := errorTypes[rand.Intn(len(errorTypes))]
+			errType := errorTypes[rng.Intn(len(errorTypes))]
 			errKey := fmt.Sprintf("%s:%s:%s", method, endpoint, errType)
 			s.apiErrors[errKey]++
 		}
 	}
 
 	// Update active connections gauge (fluctuate)
-	for key := range s.httpConnectionsActive {
-		change := rand.Intn(5) - 2 // -2 to +2
+	for _, key := range sortedKeys(s.httpConnectionsActive) {
+		change := rng.Intn(5) - 2 // -2 to +2
 		s.httpConnectionsActive[key] += float64(change)
 		if s.httpConnectionsActive[key] < 0 {
 			s.httpConnectionsActive[key] = 0
@@ -263,8 +269,8 @@ func (s *MetricsState) Update() {
 	}
 
 	// Update request duration gauge (wave pattern)
-	for key := range s.httpRequestDurationCurrent {
-		s.httpRequestDurationCurrent[key] = 0.01 + 0.3*math.Sin(float64(time.Now().Unix()%60)/10.0) + rand.Float64()*0.1
+	for _, key := range sortedKeys(s.httpRequestDurationCurrent) {
+		s.httpRequestDurationCurrent[key] = 0.01 + 0.3*math.Sin(float64(clock.Now().Unix()%60)/10.0) + rng.Float64()*0.1
 		if s.httpRequestDurationCurrent[key] < 0.01 {
 			s.httpRequestDurationCurrent[key] = 0.01
 		}
@@ -278,13 +284,13 @@ func (s *MetricsState) Update() {
 		if channel == "chat" {
 			multiplier = 5
 		}
-		s.websocketMessages[fmt.Sprintf("sent:%s", channel)] += float64(rand.Intn(10) * multiplier)
-		s.websocketMessages[fmt.Sprintf("received:%s", channel)] += float64(rand.Intn(10) * multiplier)
+		s.websocketMessages[fmt.Sprintf("sent:%s", channel)] += float64(rng.Intn(10) * multiplier)
+		s.websocketMessages[fmt.Sprintf("received:%s", channel)] += float64(rng.Intn(10) * multiplier)
 	}
 
 	// Update WebSocket connections (slowly vary)
-	for channel := range s.websocketConnectionsActive {
-		change := rand.Intn(5) - 2
+	for _, channel := range sortedKeys(s.websocketConnectionsActive) {
+		change := rng.Intn(5) - 2
 		s.websocketConnectionsActive[channel] += float64(change)
 		if s.websocketConnectionsActive[channel] < 10 {
 			s.websocketConnectionsActive[channel] = 10
@@ -295,18 +301,18 @@ func (s *MetricsState) Update() {
 	}
 
 	// Update rate limits (decrease then reset periodically)
-	for key := range s.apiRateLimitRemaining {
+	for _, key := range sortedKeys(s.apiRateLimitRemaining) {
 		s.rateLimitCounters[key]++
 		// Consume rate limit
-		s.apiRateLimitRemaining[key] -= float64(rand.Intn(50))
+		s.apiRateLimitRemaining[key] -= float64(rng.Intn(50))
 
 		// Reset every ~20 updates
 		if s.rateLimitCounters[key] > 20 {
 			s.rateLimitCounters[key] = 0
 			if key[len(key)-7:] == "premium" {
-				s.apiRateLimitRemaining[key] = 9000 + rand.Float64()*1000
+				s.apiRateLimitRemaining[key] = 9000 + rng.Float64()*1000
 			} else {
-				s.apiRateLimitRemaining[key] = 900 + rand.Float64()*100
+				s.apiRateLimitRemaining[key] = 900 + rng.Float64()*100
 			}
 		}
 
@@ -317,17 +323,17 @@ func (s *MetricsState) Update() {
 	}
 
 	// Update server goroutines (occasional spikes)
-	for handler := range s.httpServerGoroutines {
-		if rand.Float64() < 0.1 {
+	for _, handler := range sortedKeys(s.httpServerGoroutines) {
+		if rng.Float64() < 0.1 {
 			// Spike
-			s.httpServerGoroutines[handler] += float64(rand.Intn(50))
+			s.httpServerGoroutines[handler] += float64(rng.Intn(50))
 		} else {
 			// Gradual decrease
-			s.httpServerGoroutines[handler] -= float64(rand.Intn(5))
+			s.httpServerGoroutines[handler] -= float64(rng.Intn(5))
 		}
 
 		if s.httpServerGoroutines[handler] < 20 {
-			s.httpServerGoroutines[handler] = 20 + float64(rand.Intn(30))
+			s.httpServerGoroutines[handler] = 20 + float64(rng.Intn(30))
 		}
 		if s.httpServerGoroutines[handler] > 200 {
 			s.httpServerGoroutines[handler] = 200
@@ -335,11 +341,11 @@ func (s *MetricsState) Update() {
 	}
 
 	// Update bandwidth (wave pattern)
-	s.bandwidthUsageMbps["inbound"] = 10 + 15*math.Sin(float64(time.Now().Unix()%120)/20.0) + rand.Float64()*5
-	s.bandwidthUsageMbps["outbound"] = 20 + 20*math.Sin(float64(time.Now().Unix()%120)/20.0) + rand.Float64()*10
+	s.bandwidthUsageMbps["inbound"] = 10 + 15*math.Sin(float64(clock.Now().Unix()%120)/20.0) + rng.Float64()*5
+	s.bandwidthUsageMbps["outbound"] = 20 + 20*math.Sin(float64(clock.Now().Unix()%120)/20.0) + rng.Float64()*10
 
 	// Update existing histogram
-	duration := rand.Float64() * 1.2
+	duration := rng.Float64() * 1.2
 	s.histSum += duration
 	s.histCount++
 	thresholds := []float64{0.05, 0.1, 0.2, 0.5, 1.0}
@@ -351,15 +357,15 @@ func (s *MetricsState) Update() {
 	s.histBuckets[5]++
 
 	// Update existing summary
-	for k := range s.rpcQuantiles {
-		change := (rand.Float64() - 0.5) * 100
+	for _, k := range sortedKeys(s.rpcQuantiles) {
+		change := (rng.Float64() - 0.5) * 100
 		s.rpcQuantiles[k] += change
 	}
 	s.rpcCount++
-	s.rpcSum += 5000 + (rand.Float64()-0.5)*1000
+	s.rpcSum += 5000 + (rng.Float64()-0.5)*1000
 
 	// Update existing memory gauge
-	change := (rand.Float64() - 0.5) * 1024 * 1024 * 10
+	change := (rng.Float64() - 0.5) * 1024 * 1024 * 10
 	s.memoryUsage += change
 	if s.memoryUsage < 0 {
 		s.memoryUsage = 0
@@ -367,7 +373,7 @@ func (s *MetricsState) Update() {
 }
 
 func weightedChoice(items []string, weights map[string]float64) string {
-	r := rand.Float64()
+	r := rng.Float64()
 	cumulative := 0.0
 	for _, item := range items {
 		cumulative += weights[item]
@@ -378,16 +384,17 @@ func weightedChoice(items []string, weights map[string]float64) string {
 	return items[len(items)-1]
 }
 
-func (s *MetricsState) Write(w http.ResponseWriter) {
+func (s *MetricsState) Write(w io.Writer) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	timestamp := time.Now().UnixMilli()
+	timestamp := clock.Now().UnixMilli()
 
 	// HTTP requests counter
 	fmt.Fprintln(w, "# HELP http_requests_total The total number of HTTP requests.")
 	fmt.Fprintln(w, "# TYPE http_requests_total counter")
-	for key, value := range s.httpRequests {
+	for _, key := range sortedKeys(s.httpRequests) {
+		value := s.httpRequests[key]
 		parts := parseKey(key, 3)
 		if len(parts) == 3 {
 			fmt.Fprintf(w, "http_requests_total{method=\"%s\",endpoint=\"%s\",code=\"%s\"} %.0f %d\n",
@@ -399,7 +406,8 @@ func (s *MetricsState) Write(w http.ResponseWriter) {
 	// HTTP request bytes counter
 	fmt.Fprintln(w, "# HELP http_request_bytes_total Total bytes received in HTTP requests.")
 	fmt.Fprintln(w, "# TYPE http_request_bytes_total counter")
-	for key, value := range s.httpRequestBytes {
+	for _, key := range sortedKeys(s.httpRequestBytes) {
+		value := s.httpRequestBytes[key]
 		parts := parseKey(key, 2)
 		if len(parts) == 2 {
 			fmt.Fprintf(w, "http_request_bytes_total{method=\"%s\",endpoint=\"%s\"} %.0f %d\n",
@@ -411,7 +419,8 @@ func (s *MetricsState) Write(w http.ResponseWriter) {
 	// HTTP response bytes counter
 	fmt.Fprintln(w, "# HELP http_response_bytes_total Total bytes sent in HTTP responses.")
 	fmt.Fprintln(w, "# TYPE http_response_bytes_total counter")
-	for key, value := range s.httpResponseBytes {
+	for _, key := range sortedKeys(s.httpResponseBytes) {
+		value := s.httpResponseBytes[key]
 		parts := parseKey(key, 3)
 		if len(parts) == 3 {
 			fmt.Fprintf(w, "http_response_bytes_total{method=\"%s\",endpoint=\"%s\",code=\"%s\"} %.0f %d\n",
@@ -423,7 +432,8 @@ func (s *MetricsState) Write(w http.ResponseWriter) {
 	// WebSocket messages counter
 	fmt.Fprintln(w, "# HELP websocket_messages_total Total WebSocket messages.")
 	fmt.Fprintln(w, "# TYPE websocket_messages_total counter")
-	for key, value := range s.websocketMessages {
+	for _, key := range sortedKeys(s.websocketMessages) {
+		value := s.websocketMessages[key]
 		parts := parseKey(key, 2)
 		if len(parts) == 2 {
 			fmt.Fprintf(w, "websocket_messages_total{direction=\"%s\",channel=\"%s\"} %.0f %d\n",
@@ -435,7 +445,8 @@ func (s *MetricsState) Write(w http.ResponseWriter) {
 	// API errors counter
 	fmt.Fprintln(w, "# HELP api_errors_total Total API errors by type.")
 	fmt.Fprintln(w, "# TYPE api_errors_total counter")
-	for key, value := range s.apiErrors {
+	for _, key := range sortedKeys(s.apiErrors) {
+		value := s.apiErrors[key]
 		parts := parseKey(key, 3)
 		if len(parts) == 3 {
 			fmt.Fprintf(w, "api_errors_total{method=\"%s\",endpoint=\"%s\",error_type=\"%s\"} %.0f %d\n",
@@ -447,7 +458,8 @@ func (s *MetricsState) Write(w http.ResponseWriter) {
 	// HTTP active connections gauge
 	fmt.Fprintln(w, "# HELP http_connections_active Currently active HTTP connections.")
 	fmt.Fprintln(w, "# TYPE http_connections_active gauge")
-	for key, value := range s.httpConnectionsActive {
+	for _, key := range sortedKeys(s.httpConnectionsActive) {
+		value := s.httpConnectionsActive[key]
 		parts := parseKey(key, 2)
 		if len(parts) == 2 {
 			fmt.Fprintf(w, "http_connections_active{method=\"%s\",endpoint=\"%s\"} %.0f %d\n",
@@ -459,7 +471,8 @@ func (s *MetricsState) Write(w http.ResponseWriter) {
 	// HTTP request duration current gauge
 	fmt.Fprintln(w, "# HELP http_request_duration_current Current request duration in seconds.")
 	fmt.Fprintln(w, "# TYPE http_request_duration_current gauge")
-	for key, value := range s.httpRequestDurationCurrent {
+	for _, key := range sortedKeys(s.httpRequestDurationCurrent) {
+		value := s.httpRequestDurationCurrent[key]
 		parts := parseKey(key, 2)
 		if len(parts) == 2 {
 			fmt.Fprintf(w, "http_request_duration_current{method=\"%s\",endpoint=\"%s\"} %.3f %d\n",
@@ -471,7 +484,8 @@ func (s *MetricsState) Write(w http.ResponseWriter) {
 	// WebSocket connections gauge
 	fmt.Fprintln(w, "# HELP websocket_connections_active Currently active WebSocket connections.")
 	fmt.Fprintln(w, "# TYPE websocket_connections_active gauge")
-	for channel, value := range s.websocketConnectionsActive {
+	for _, channel := range sortedKeys(s.websocketConnectionsActive) {
+		value := s.websocketConnectionsActive[channel]
 		fmt.Fprintf(w, "websocket_connections_active{channel=\"%s\"} %.0f %d\n",
 			channel, value, timestamp)
 	}
@@ -480,7 +494,8 @@ func (s *MetricsState) Write(w http.ResponseWriter) {
 	// API rate limit gauge
 	fmt.Fprintln(w, "# HELP api_rate_limit_remaining Remaining API rate limit capacity.")
 	fmt.Fprintln(w, "# TYPE api_rate_limit_remaining gauge")
-	for key, value := range s.apiRateLimitRemaining {
+	for _, key := range sortedKeys(s.apiRateLimitRemaining) {
+		value := s.apiRateLimitRemaining[key]
 		parts := parseKey(key, 2)
 		if len(parts) == 2 {
 			fmt.Fprintf(w, "api_rate_limit_remaining{endpoint=\"%s\",client_tier=\"%s\"} %.0f %d\n",
@@ -492,7 +507,8 @@ func (s *MetricsState) Write(w http.ResponseWriter) {
 	// Server goroutines gauge
 	fmt.Fprintln(w, "# HELP http_server_goroutines Active server goroutines by handler.")
 	fmt.Fprintln(w, "# TYPE http_server_goroutines gauge")
-	for handler, value := range s.httpServerGoroutines {
+	for _, handler := range sortedKeys(s.httpServerGoroutines) {
+		value := s.httpServerGoroutines[handler]
 		fmt.Fprintf(w, "http_server_goroutines{handler=\"%s\"} %.0f %d\n",
 			handler, value, timestamp)
 	}
@@ -501,7 +517,8 @@ func (s *MetricsState) Write(w http.ResponseWriter) {
 	// Bandwidth gauge
 	fmt.Fprintln(w, "# HELP bandwidth_usage_mbps Current bandwidth usage in Mbps.")
 	fmt.Fprintln(w, "# TYPE bandwidth_usage_mbps gauge")
-	for direction, value := range s.bandwidthUsageMbps {
+	for _, direction := range sortedKeys(s.bandwidthUsageMbps) {
+		value := s.bandwidthUsageMbps[direction]
 		fmt.Fprintf(w, "bandwidth_usage_mbps{direction=\"%s\"} %.2f %d\n",
 			direction, value, timestamp)
 	}
@@ -538,6 +555,12 @@ func (s *MetricsState) Write(w http.ResponseWriter) {
 	fmt.Fprintf(w, "memory_usage_bytes %.0f %d\n", s.memoryUsage, timestamp)
 }
 
+// sortedKeys returns the keys of a map in order, keeping iteration (and with
+// it the sequence of random numbers drawn) deterministic.
+func sortedKeys[K cmp.Ordered, V any](m map[K]V) []K {
+	return slices.Sorted(maps.Keys(m))
+}
+
 func parseKey(key string, expectedParts int) []string {
 	parts := make([]string, 0, expectedParts)
 	current := ""
@@ -555,20 +578,145 @@ func parseKey(key string, expectedParts int) []string {
 	return parts
 }
 
+// Source generates the exposed metrics. Update advances the simulation by one
+// scrape and Write renders the current values in the text exposition format.
+type Source interface {
+	Update()
+	Write(w io.Writer)
+}
+
 func main() {
 	port := flag.Int("port", 8080, "Port to run mock server on")
+	configFile := flag.String("config", "", "YAML file defining the metrics to serve instead of the built-in set")
+	replayDir := flag.String("replay", "", "Directory of recorded exposition snapshots to serve in name order, or a SQLite session database recorded with -sqlite, one snapshot per scrape")
+	replayLoop := flag.Bool("replay-loop", false, "Restart from the first snapshot after the last one with -replay")
+	scenarioFile := flag.String("scenario", "", "YAML file with timed phases modifying the served metrics")
+	resetEvery := flag.Duration("reset-every", 0, "Periodically reset counters to zero, simulating process restarts")
+	resetMetric := flag.String("reset-metric", ".*_total", "Regex of the metric names reset by -reset-every")
+	series := flag.Int("series", 0, "Add this many synthetic series with unique label combinations for load testing")
+	churn := flag.Float64("churn", 0, "Fraction (0-1) of short-lived worker series replaced by new label sets on every scrape")
+	churnSeries := flag.Int("churn-series", 20, "Number of concurrently live short-lived worker series with -churn")
+	seed := flag.Int64("seed", 0, "Seed for all randomness, making the generated values reproducible (0 means random)")
+	targets := flag.Int("targets", 0, "Additionally serve this many correlated targets on /metrics/0 ... /metrics/N-1")
+	targetsInterval := flag.Duration("targets-interval", time.Second, "Advance the values shared by the -targets at most once per this interval, so scraping them all in one cycle sees one step")
+	useTLS := flag.Bool("tls", false, "Serve HTTPS with a generated self-signed certificate")
+	format := flag.String("format", FormatAuto, "Exposition format: auto (negotiated by Accept header), text, openmetrics, protobuf")
+	var chaos Chaos
+	flag.DurationVar(&chaos.Latency, "chaos-latency", 0, "Delay every response by this duration")
+	flag.Float64Var(&chaos.ErrorRate, "chaos-error-rate", 0, "Fraction of requests (0-1) answered with a 5xx error")
+	flag.Float64Var(&chaos.TruncateRate, "chaos-truncate", 0, "Fraction of responses (0-1) with a truncated or corrupt body")
+	var auth Auth
+	flag.StringVar(&auth.BasicAuth, "basic-auth", "", "Require basic auth on /metrics with credentials 'user:password'")
+	flag.StringVar(&auth.BearerToken, "bearer-token", "", "Require this bearer token on /metrics")
 	flag.Parse()
 
-	state := NewMetricsState()
+	switch *format {
+	case FormatAuto, FormatText, FormatOpenMetrics, FormatProtobuf:
+	default:
+		fmt.Printf("Error: invalid format '%s'. Must be one of: auto, text, openmetrics, protobuf\n", *format)
+		os.Exit(1)
+	}
+
+	if *churn < 0 || *churn > 1 {
+		fmt.Printf("Error: -churn must be between 0 and 1\n")
+		os.Exit(1)
+	}
+	if chaos.ErrorRate < 0 || chaos.ErrorRate > 1 || chaos.TruncateRate < 0 || chaos.TruncateRate > 1 {
+		fmt.Printf("Error: -chaos-error-rate and -chaos-truncate must be between 0 and 1\n")
+		os.Exit(1)
+	}
+
+	if auth.BasicAuth != "" && !strings.Contains(auth.BasicAuth, ":") {
+		fmt.Printf("Error: invalid basic auth '%s'. Must be 'user:password'\n", auth.BasicAuth)
+		os.Exit(1)
+	}
+
+	if *seed != 0 {
+		seedRandom(*seed)
+	}
+
+	var state Source = NewMetricsState()
+	if *configFile != "" {
+		cfg, err := LoadConfig(*configFile)
+		if err != nil {
+			fmt.Printf("Error loading config: %v\n", err)
+			os.Exit(1)
+		}
+		state = NewConfigState(cfg)
+	}
+	if *replayDir != "" {
+		if *configFile != "" {
+			fmt.Printf("Error: -replay and -config cannot be combined\n")
+			os.Exit(1)
+		}
+		replay, err := NewReplaySource(*replayDir, *replayLoop)
+		if err != nil {
+			fmt.Printf("Error loading snapshots: %v\n", err)
+			os.Exit(1)
+		}
+		state = replay
+	}
+	if *series > 0 {
+		state = NewSyntheticSource(state, *series)
+	}
+	if *churn > 0 {
+		state = NewChurnSource(state, *churnSeries, *churn)
+	}
+	if *scenarioFile != "" || *resetEvery > 0 {
+		scenario := &Scenario{}
+		if *scenarioFile != "" {
+			var err error
+			scenario, err = LoadScenario(*scenarioFile)
+			if err != nil {
+				fmt.Printf("Error loading scenario: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if *resetEvery > 0 {
+			if err := scenario.AddResetRule(*resetMetric, *resetEvery); err != nil {
+				fmt.Printf("Error: invalid reset metric regex: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		state = NewScenarioSource(state, scenario)
+	}
+
+	metricsHandler := func(src Source) http.HandlerFunc {
+		return auth.Wrap(chaos.Wrap(gzipWrap(func(w http.ResponseWriter, r *http.Request) {
+			clock.tick()
+			src.Update()
+			writeExposition(w, r, src, *format)
+		})))
+	}
+	http.HandleFunc("/metrics", metricsHandler(state))
+	for i, view := range NewTargetViews(state, *targets, *targetsInterval) {
+		http.HandleFunc(fmt.Sprintf("/metrics/%d", i), metricsHandler(view))
+	}
+	server := &http.Server{Addr: fmt.Sprintf(":%d", *port)}
+	scheme, curlFlags := "http", ""
+	if *useTLS {
+		cert, err := selfSignedCert()
+		if err != nil {
+			fmt.Printf("Error generating certificate: %v\n", err)
+			os.Exit(1)
+		}
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		scheme, curlFlags = "https", "-k "
+	}
 
-	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
-		state.Update()
-		state.Write(w)
-	})
 	fmt.Printf("Starting mock server on :%d\n", *port)
-	fmt.Printf("Try: curl http://localhost:%d/metrics\n", *port)
-	fmt.Printf("Or:  ./openmetrics-tui -url http://localhost:%d/metrics -filter-label method=get\n", *port)
-	if err := http.ListenAndServe(fmt.Sprintf(":%d", *port), nil); err != nil {
+	fmt.Printf("Try: curl %s%s://localhost:%d/metrics\n", curlFlags, scheme, *port)
+	if *targets > 0 {
+		fmt.Printf("Targets: %s://localhost:%d/metrics/0 ... /metrics/%d\n", scheme, *port, *targets-1)
+	}
+	fmt.Printf("Or:  ./openmetrics-tui -url %s://localhost:%d/metrics -filter-label method=get\n", scheme, *port)
+	var err error
+	if *useTLS {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil {
 		fmt.Printf("Error starting server: %v\n", err)
 	}
 }
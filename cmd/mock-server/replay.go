@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ReplaySource serves recorded exposition snapshots, advancing to the next
+// snapshot on every scrape.
+type ReplaySource struct {
+	mu    sync.Mutex
+	names []string // Snapshot names for progress output
+	read  func(i int) ([]byte, error)
+	loop  bool
+	next  int
+	data  []byte
+}
+
+// NewReplaySource replays a directory of snapshot files in name order, or a
+// session database recorded with the TUI's -sqlite flag.
+func NewReplaySource(path string, loop bool) (*ReplaySource, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return newSQLiteReplaySource(path, loop)
+	}
+	dir := path
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no snapshot files in %s", dir)
+	}
+	sort.Strings(files)
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = filepath.Base(file)
+	}
+	read := func(i int) ([]byte, error) { return os.ReadFile(files[i]) }
+	return &ReplaySource{names: names, read: read, loop: loop}, nil
+}
+
+func (s *ReplaySource) Update() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.next == len(s.names) {
+		if !s.loop {
+			// Keep serving the last snapshot
+			return
+		}
+		s.next = 0
+	}
+	i := s.next
+	s.next++
+	data, err := s.read(i)
+	if err != nil {
+		fmt.Printf("Error reading snapshot: %v\n", err)
+		return
+	}
+	s.data = data
+	fmt.Printf("Replaying snapshot %d/%d: %s\n", s.next, len(s.names), s.names[i])
+}
+
+func (s *ReplaySource) Write(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Write(s.data)
+}
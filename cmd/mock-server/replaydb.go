@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// newSQLiteReplaySource replays the scrapes of a session database written by
+// the TUI's SQLite sink, rendering each scrape as text exposition.
+func newSQLiteReplaySource(path string, loop bool) (*ReplaySource, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query("SELECT id, time FROM scrapes ORDER BY time, id")
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	var names []string
+	for rows.Next() {
+		var id, ms int64
+		if err := rows.Scan(&id, &ms); err != nil {
+			db.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+		names = append(names, time.UnixMilli(ms).Format(time.RFC3339))
+	}
+	if err := rows.Err(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if len(ids) == 0 {
+		db.Close()
+		return nil, fmt.Errorf("no scrapes in %s", path)
+	}
+
+	read := func(i int) ([]byte, error) { return readScrape(db, ids[i]) }
+	return &ReplaySource{names: names, read: read, loop: loop}, nil
+}
+
+// readScrape renders the samples of a recorded scrape, grouped by metric.
+func readScrape(db *sql.DB, scrapeID int64) ([]byte, error) {
+	rows, err := db.Query(`
+		SELECT series.name, series.type, series.signature, samples.value
+		FROM samples JOIN series ON series.id = samples.series_id
+		WHERE samples.scrape_id = ?
+		ORDER BY series.name, series.signature`, scrapeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buf bytes.Buffer
+	var last string
+	for rows.Next() {
+		var name, kind, sig string
+		var value sql.NullFloat64 // NaN is stored as NULL
+		if err := rows.Scan(&name, &kind, &sig, &value); err != nil {
+			return nil, err
+		}
+		if name != last {
+			fmt.Fprintf(&buf, "# TYPE %s %s\n", name, kind)
+			last = name
+		}
+		v := math.NaN()
+		if value.Valid {
+			v = value.Float64
+		}
+		fmt.Fprintf(&buf, "%s %s\n", sig, strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	return buf.Bytes(), rows.Err()
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// rng is the source of all randomness in the mock server so runs can be made
+// reproducible with -seed. It is safe for concurrent use, except for Read
+// which keeps state in the Rand itself: use readRandom instead.
+var (
+	rngSource = &lockedSource{src: rand.NewSource(time.Now().UnixNano())}
+	rng       = rand.New(rngSource)
+)
+
+// seedRandom makes the random sequence deterministic, and the time of the
+// simulation too so runs with the same seed serve the same expositions.
+func seedRandom(seed int64) {
+	rng.Seed(seed)
+	clock.fix(seedEpoch)
+	startTime = seedEpoch
+}
+
+// seedEpoch is the start of the simulated time with -seed.
+var seedEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// clock is the time of the simulation, which drives the sine waves, the
+// scenario phases and the timestamps of the expositions.
+var clock = &simClock{}
+
+// simClock is the wall clock, or once fixed a clock advancing by a second
+// per scrape.
+type simClock struct {
+	mu    sync.Mutex
+	fixed bool
+	now   time.Time
+}
+
+func (c *simClock) fix(start time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fixed, c.now = true, start
+}
+
+// Now returns the current time of the simulation.
+func (c *simClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.fixed {
+		return time.Now()
+	}
+	return c.now
+}
+
+// tick advances a fixed clock to the next scrape.
+func (c *simClock) tick() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fixed {
+		c.now = c.now.Add(time.Second)
+	}
+}
+
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
+
+// readRandom fills p with random bytes from rng, under the lock of its
+// source.
+func readRandom(p []byte) {
+	rngSource.mu.Lock()
+	defer rngSource.mu.Unlock()
+	var val int64
+	for i := range p {
+		// Each Int63 provides 7 bytes
+		if i%7 == 0 {
+			val = rngSource.src.Int63()
+		}
+		p[i] = byte(val)
+		val >>= 8
+	}
+}
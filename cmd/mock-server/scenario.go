@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// Scenario is a sequence of timed phases which modify the served metrics, e.g.
+//
+//	loop: true
+//	phases:
+//	  - name: normal
+//	    duration: 60s
+//	  - name: error spike
+//	    duration: 30s
+//	    rules:
+//	      - metric: http_requests_total
+//	        labels: {code: "500"}
+//	        rate: 20
+//	  - name: restart
+//	    duration: 10s
+//	    rules:
+//	      - metric: http_.*_total
+//	        reset: true
+//	  - name: flapping
+//	    duration: 5m
+//	    rules:
+//	      - metric: api_errors_total
+//	        reset_every: 30s
+type Scenario struct {
+	Loop   bool    `yaml:"loop"`
+	Phases []Phase `yaml:"phases"`
+}
+
+type Phase struct {
+	Name     string        `yaml:"name"`
+	Duration time.Duration `yaml:"duration"`
+	Rules    []Rule        `yaml:"rules"`
+}
+
+// Rule modifies the series matching a metric name regex and exact label
+// values while its phase is active.
+type Rule struct {
+	Metric string            `yaml:"metric"`
+	Labels map[string]string `yaml:"labels"`
+	Rate   float64           `yaml:"rate"`   // Multiplier for changes in value, 0 means unchanged
+	Offset float64           `yaml:"offset"` // Added to the value
+	Reset  bool              `yaml:"reset"`  // Reset to zero when the phase starts
+	Drop   bool              `yaml:"drop"`   // Remove the series from the output
+
+	// ResetEvery periodically resets the value to zero, simulating process
+	// restarts
+	ResetEvery time.Duration `yaml:"reset_every"`
+
+	re *regexp.Regexp
+}
+
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var sc Scenario
+	if err := yaml.UnmarshalStrict(data, &sc); err != nil {
+		return nil, err
+	}
+	if len(sc.Phases) == 0 {
+		return nil, fmt.Errorf("scenario has no phases")
+	}
+	for i := range sc.Phases {
+		phase := &sc.Phases[i]
+		if phase.Duration <= 0 {
+			return nil, fmt.Errorf("phase %q: duration must be positive", phase.Name)
+		}
+		for j := range phase.Rules {
+			rule := &phase.Rules[j]
+			if err := rule.compile(); err != nil {
+				return nil, fmt.Errorf("phase %q: %w", phase.Name, err)
+			}
+		}
+	}
+	return &sc, nil
+}
+
+// scenarioSeries tracks the value exposed for a series, which follows the
+// changes of the underlying value, scaled by the active rules.
+type scenarioSeries struct {
+	raw       float64
+	out       float64
+	lastReset time.Time
+}
+
+// ScenarioSource wraps a Source and applies the rules of the active phase to
+// its output.
+type ScenarioSource struct {
+	mu       sync.Mutex
+	inner    Source
+	scenario *Scenario
+	start    time.Time
+	phase    int
+	series   map[string]*scenarioSeries
+}
+
+func NewScenarioSource(inner Source, scenario *Scenario) *ScenarioSource {
+	return &ScenarioSource{
+		inner:    inner,
+		scenario: scenario,
+		start:    clock.Now(),
+		phase:    -1,
+		series:   make(map[string]*scenarioSeries),
+	}
+}
+
+// activePhase returns the index of the phase active at elapsed, or -1 when a
+// non-looping scenario has ended.
+func (s *ScenarioSource) activePhase(elapsed time.Duration) int {
+	var total time.Duration
+	for _, phase := range s.scenario.Phases {
+		total += phase.Duration
+	}
+	if s.scenario.Loop {
+		elapsed %= total
+	}
+	for i, phase := range s.scenario.Phases {
+		if elapsed < phase.Duration {
+			return i
+		}
+		elapsed -= phase.Duration
+	}
+	return -1
+}
+
+func (s *ScenarioSource) Update() {
+	s.inner.Update()
+}
+
+func (s *ScenarioSource) Write(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rules []Rule
+	now := clock.Now()
+	phase := s.activePhase(now.Sub(s.start))
+	if phase >= 0 {
+		rules = s.scenario.Phases[phase].Rules
+	}
+	phaseStarted := phase != s.phase
+	if phaseStarted && phase >= 0 {
+		fmt.Printf("Scenario phase: %s\n", s.scenario.Phases[phase].Name)
+	}
+	s.phase = phase
+
+	var buf bytes.Buffer
+	s.inner.Write(&buf)
+
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		line := scanner.Text()
+		key, value, rest, ok := splitSample(line)
+		if !ok {
+			fmt.Fprintln(w, line)
+			continue
+		}
+
+		series, seen := s.series[key]
+		if !seen {
+			series = &scenarioSeries{raw: value, out: value, lastReset: now}
+			s.series[key] = series
+		}
+		change := value - series.raw
+		series.raw = value
+
+		drop, offset := false, 0.0
+		for _, rule := range rules {
+			if !rule.matches(key) {
+				continue
+			}
+			if rule.Reset && phaseStarted {
+				series.out = 0
+			}
+			if rule.ResetEvery > 0 && now.Sub(series.lastReset) >= rule.ResetEvery {
+				series.out = 0
+				series.lastReset = now
+			}
+			if rule.Rate != 0 {
+				change *= rule.Rate
+			}
+			offset += rule.Offset
+			drop = drop || rule.Drop
+		}
+		if seen {
+			series.out += change
+		}
+		if !drop {
+			fmt.Fprintf(w, "%s %s%s\n", key, strconv.FormatFloat(series.out+offset, 'f', -1, 64), rest)
+		}
+	}
+}
+
+// labelPairRe matches a single name="value" label pair.
+var labelPairRe = regexp.MustCompile(`([a-zA-Z_][a-zA-Z0-9_]*)="((?:[^"\\]|\\.)*)"`)
+
+func (r *Rule) compile() error {
+	var err error
+	r.re, err = regexp.Compile("^(?:" + r.Metric + ")$")
+	return err
+}
+
+// AddResetRule makes every phase periodically reset the metrics matching a
+// name regex. A scenario without phases gets a single looping phase.
+func (sc *Scenario) AddResetRule(metric string, every time.Duration) error {
+	rule := Rule{Metric: metric, ResetEvery: every}
+	if err := rule.compile(); err != nil {
+		return err
+	}
+	if len(sc.Phases) == 0 {
+		sc.Loop = true
+		sc.Phases = []Phase{{Name: "counter resets", Duration: every}}
+	}
+	for i := range sc.Phases {
+		sc.Phases[i].Rules = append(sc.Phases[i].Rules, rule)
+	}
+	return nil
+}
+
+func (r *Rule) matches(key string) bool {
+	name, labels, _ := strings.Cut(key, "{")
+	if !r.re.MatchString(name) {
+		return false
+	}
+	if len(r.Labels) == 0 {
+		return true
+	}
+	values := make(map[string]string)
+	for _, m := range labelPairRe.FindAllStringSubmatch(labels, -1) {
+		values[m[1]] = m[2]
+	}
+	for k, v := range r.Labels {
+		if values[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// splitSample splits a sample line into the series (name and labels), its
+// value and the remainder (timestamp), returning false for comments, blank
+// lines and unparseable values.
+func splitSample(line string) (key string, value float64, rest string, ok bool) {
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", 0, "", false
+	}
+	end := strings.LastIndex(line, "}") + 1
+	if end == 0 {
+		end = strings.Index(line, " ")
+		if end == -1 {
+			return "", 0, "", false
+		}
+	}
+	key = line[:end]
+	fields := strings.Fields(line[end:])
+	if len(fields) == 0 {
+		return "", 0, "", false
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "", 0, "", false
+	}
+	if len(fields) > 1 {
+		rest = " " + strings.Join(fields[1:], " ")
+	}
+	return key, value, rest, true
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// syntheticMetrics are the metric families the synthetic series are spread
+// over, alternating counters and gauges.
+var syntheticMetrics = []struct {
+	name, typ, help string
+}{
+	{"synthetic_requests_total", "counter", "Synthetic load-test counter."},
+	{"synthetic_queue_depth", "gauge", "Synthetic load-test gauge."},
+	{"synthetic_bytes_total", "counter", "Synthetic load-test byte counter."},
+	{"synthetic_temperature_celsius", "gauge", "Synthetic load-test temperature."},
+}
+
+// SyntheticSource adds a fixed number of synthetic series with unique label
+// combinations to the output of another source, as a large workload for
+// performance testing.
+type SyntheticSource struct {
+	mu     sync.Mutex
+	inner  Source
+	labels [][]string // Rendered label sets per metric family
+	values [][]float64
+}
+
+func NewSyntheticSource(inner Source, n int) *SyntheticSource {
+	s := &SyntheticSource{
+		inner:  inner,
+		labels: make([][]string, len(syntheticMetrics)),
+		values: make([][]float64, len(syntheticMetrics)),
+	}
+	for i := 0; i < n; i++ {
+		family := i % len(syntheticMetrics)
+		id := i / len(syntheticMetrics)
+		labels := fmt.Sprintf(`{cluster="c%d",namespace="ns-%d",pod="pod-%05d",zone="zone-%c"}`,
+			id%3, id%50, id, 'a'+rune(id%4))
+		s.labels[family] = append(s.labels[family], labels)
+		s.values[family] = append(s.values[family], float64(rng.Intn(1000)))
+	}
+	return s
+}
+
+func (s *SyntheticSource) Update() {
+	s.inner.Update()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, m := range syntheticMetrics {
+		for j, v := range s.values[i] {
+			if m.typ == "counter" {
+				s.values[i][j] = v + float64(rng.Intn(100))
+			} else {
+				s.values[i][j] = max(v+float64(rng.Intn(21)-10), 0)
+			}
+		}
+	}
+}
+
+func (s *SyntheticSource) Write(w io.Writer) {
+	s.inner.Write(w)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, m := range syntheticMetrics {
+		if len(s.labels[i]) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.typ)
+		for j, labels := range s.labels[i] {
+			fmt.Fprintf(w, "%s%s %g\n", m.name, labels, s.values[i][j])
+		}
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TargetView presents the output of a shared source as one of several
+// simulated targets. Values are scaled by a per-target factor so targets are
+// correlated but distinct, and gauges get some extra per-scrape noise.
+type TargetView struct {
+	inner  Source
+	factor float64
+	clock  *sharedClock
+}
+
+// sharedClock advances the source shared by the target views at most once
+// per interval, so a client scraping every target in one cycle sees a single
+// step instead of one per target.
+type sharedClock struct {
+	mu       sync.Mutex
+	interval time.Duration
+	last     time.Time
+}
+
+// due reports whether the shared source should advance at now.
+func (c *sharedClock) due(now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Sub(c.last) < c.interval {
+		return false
+	}
+	c.last = now
+	return true
+}
+
+func NewTargetViews(inner Source, n int, interval time.Duration) []*TargetView {
+	clock := &sharedClock{interval: interval}
+	views := make([]*TargetView, n)
+	for i := range views {
+		views[i] = &TargetView{inner: inner, factor: 1 + 0.25*float64(i), clock: clock}
+	}
+	return views
+}
+
+func (t *TargetView) Update() {
+	if t.clock.due(time.Now()) {
+		t.inner.Update()
+	}
+}
+
+func (t *TargetView) Write(w io.Writer) {
+	var buf bytes.Buffer
+	t.inner.Write(&buf)
+
+	var metricType string
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if fields := strings.Fields(line); len(fields) == 4 && fields[1] == "TYPE" {
+			metricType = fields[3]
+		}
+		key, value, rest, ok := splitSample(line)
+		if !ok {
+			fmt.Fprintln(w, line)
+			continue
+		}
+
+		scaled := value * t.factor
+		if metricType == "gauge" {
+			scaled *= 1 + (rng.Float64()-0.5)*0.04
+		}
+		if value == math.Trunc(value) {
+			// Keep integral counts integral
+			scaled = math.Round(scaled)
+		}
+		fmt.Fprintf(w, "%s %s%s\n", key, strconv.FormatFloat(scaled, 'f', -1, 64), rest)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Column aggregation constants. With a -column-window above one, each
+// history column but the current one aggregates that many samples.
+const (
+	ColumnAggLast = "last"
+	ColumnAggMin  = "min"
+	ColumnAggMax  = "max"
+	ColumnAggMean = "mean"
+)
+
+// valueColumns returns the number of value columns: the current value plus
+// the older history grouped by the column window.
+func (m model) valueColumns() int {
+	window := max(m.cfg.ColumnWindow, 1)
+	return 1 + (max(m.cfg.History, 1)-2+window)/window
+}
+
+// columnValues returns the values of the value columns of a series, oldest
+// first and right-aligned so the last is the current value. Columns without
+// samples are missing from the front.
+func (m model) columnValues(series *MetricSeries) []float64 {
+	vals := series.ValuesWithDeltas(m.cfg.DeltaMode)
+	if m.cfg.DeltaMode == DeltaModeRef {
+		vals = series.ValuesFromReference(m.refAge())
+	}
+	window := max(m.cfg.ColumnWindow, 1)
+	if window == 1 || len(vals) == 0 {
+		return vals
+	}
+
+	// The current value stays a single sample, in particular in the delta
+	// modes where it differs from the history
+	hist := vals[:len(vals)-1]
+	cols := make([]float64, (len(hist)+window-1)/window+1)
+	cols[len(cols)-1] = vals[len(vals)-1]
+	for i := len(cols) - 2; i >= 0; i-- {
+		end := len(hist) - (len(cols)-2-i)*window
+		cols[i] = aggregate(hist[max(end-window, 0):end], m.cfg.ColumnAgg)
+	}
+	return cols
+}
+
+// aggregate returns the aggregate of the values, ignoring missing ones. It
+// is NaN if all are missing.
+func aggregate(vals []float64, agg string) float64 {
+	res, n := math.NaN(), 0
+	for _, v := range vals {
+		if math.IsNaN(v) {
+			continue
+		}
+		n++
+		switch {
+		case n == 1:
+			res = v
+		case agg == ColumnAggMin:
+			res = math.Min(res, v)
+		case agg == ColumnAggMax:
+			res = math.Max(res, v)
+		case agg == ColumnAggMean:
+			res += v
+		default:
+			res = v
+		}
+	}
+	if agg == ColumnAggMean && n > 0 {
+		res /= float64(n)
+	}
+	return res
+}
+
+// columnAge returns the age in scrapes of the oldest sample of the value
+// column offset columns before the current one.
+func (m model) columnAge(offset int) int {
+	return offset * max(m.cfg.ColumnWindow, 1)
+}
+
+// columnTitle returns the header of the value column offset columns before
+// the current one, the age of its oldest sample.
+func (m model) columnTitle(offset int) string {
+	if offset == 0 {
+		return "Curr"
+	}
+	return ageTitle(m.store, m.columnAge(offset), m.cfg.Interval)
+}
+
+// ageTitle returns the header of the history column age scrapes before the
+// last one, e.g. -5s. The age is measured from the scrape times, so headers
+// stay honest when scrapes are delayed. Beyond the scrapes so far, polling
+// intervals are added to the age of the oldest one.
+func ageTitle(store *Store, age int, interval time.Duration) string {
+	known := min(age, len(store.times)-1)
+	d, _ := store.ScrapeAge(known)
+	d += time.Duration(age-max(known, 0)) * interval
+	return fmt.Sprintf("-%ds", int(math.Round(d.Seconds())))
+}
+
+// columnScrapeMarker returns the header marker of the worst scrape outcome
+// among the samples of a value column.
+func (m model) columnScrapeMarker(offset int) string {
+	if offset == 0 {
+		return m.scrapeStatusMarker(0)
+	}
+	window := max(m.cfg.ColumnWindow, 1)
+	worst, worstAge := scrapeOK, -1
+	for age := (offset-1)*window + 1; age <= offset*window; age++ {
+		if status, ok := m.store.ScrapeStatus(age); ok && (worstAge < 0 || status > worst) {
+			worst, worstAge = status, age
+		}
+	}
+	if worstAge < 0 {
+		return ""
+	}
+	return m.scrapeStatusMarker(worstAge)
+}
+
+// pauseColumn reports whether a value column covers the gap of a pause, see
+// Store.RecordPause.
+func (m model) pauseColumn(offset int) bool {
+	first, last := 0, 0
+	if window := max(m.cfg.ColumnWindow, 1); offset > 0 {
+		first, last = (offset-1)*window+1, offset*window
+	}
+	for age := first; age <= last; age++ {
+		if status, _ := m.store.ScrapeStatus(age); status == scrapePaused {
+			return true
+		}
+	}
+	return false
+}
+
+// nextColumnAgg returns the aggregation following agg, for cycling with A.
+func nextColumnAgg(agg string) string {
+	switch agg {
+	case ColumnAggLast:
+		return ColumnAggMin
+	case ColumnAggMin:
+		return ColumnAggMax
+	case ColumnAggMax:
+		return ColumnAggMean
+	}
+	return ColumnAggLast
+}
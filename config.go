@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// applyConfigFile sets the flags listed in a config file, e.g.
+//
+//	# Only errors, grouped by endpoint
+//	url = http://localhost:8080/metrics
+//	filter-metric = .*_errors_total
+//	label-mode = hide-filtered
+//	assert = "http_requests_total{code=\"500\"} delta < 10"
+//
+// Values may be double-quoted. Flags set on the command line are skipped, so
+// they take precedence over the file.
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	set := make(map[string]bool)
+	fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value := line, ""
+		if i := strings.IndexAny(line, " \t="); i >= 0 {
+			name = line[:i]
+			value = strings.TrimSpace(line[i:])
+			value = strings.TrimSpace(strings.TrimPrefix(value, "="))
+		}
+		if strings.HasPrefix(value, `"`) {
+			if value, err = strconv.Unquote(value); err != nil {
+				return fmt.Errorf("%s:%d: invalid quoted value: %v", path, lineNo, err)
+			}
+		}
+		if fs.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("%s:%d: unknown setting '%s'", path, lineNo, name)
+		}
+		if set[name] {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%s:%d: %s: %v", path, lineNo, name, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// loadConfig parses the command line and config file again, as on startup.
+func loadConfig() (Config, error) {
+	var cfg Config
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	defineFlags(fs, &cfg)
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		return cfg, err
+	}
+	if cfg.ConfigFile != "" {
+		if err := applyConfigFile(fs, cfg.ConfigFile); err != nil {
+			return cfg, err
+		}
+	}
+	if err := cfg.loadPromConfig(); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.validate()
+}
+
+type reloadMsg struct{}
+
+// notifyReload returns a channel receiving SIGHUP.
+func notifyReload() chan os.Signal {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	return ch
+}
+
+func (m model) waitForReload() tea.Cmd {
+	if m.reload == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		<-m.reload
+		return reloadMsg{}
+	}
+}
+
+// reloadConfig re-reads the config file and applies the display and filter
+// settings, keeping the collected history. Settings which shape the history
+// or start servers and sinks require a restart.
+func (m model) reloadConfig() model {
+	if m.cfg.ConfigFile == "" {
+		m.notice = "No -config file to reload"
+		return m
+	}
+	cfg, err := loadConfig()
+	if err == nil && cfg.URL == "" {
+		err = fmt.Errorf("-url, -pid, -textfile-dir or -prom-config argument is required")
+	}
+	var sel *selector
+	if err == nil && cfg.Select != "" {
+		if sel, err = parseSelector(cfg.Select); err != nil {
+			err = fmt.Errorf("invalid selector: %v", err)
+		}
+	}
+	var bounds []gaugeBound
+	if err == nil {
+		bounds, err = parseBounds(cfg.Bounds)
+	}
+	var bindings []binding
+	if err == nil {
+		bindings, err = parseBindings(cfg.Bindings)
+	}
+	var baseline map[string]float64
+	if err == nil && cfg.Baseline != "" {
+		baseline, err = loadBaseline(cfg.Baseline)
+	}
+	var views []viewPreset
+	if err == nil {
+		views, err = loadViews(cfg)
+	}
+	var drop *regexp.Regexp
+	if err == nil {
+		drop, err = parseDrop(cfg.Drop)
+	}
+	var slos []*slo
+	if err == nil {
+		slos, err = parseSLOs(cfg.SLOs)
+	}
+	if err != nil {
+		m.notice = "Reload failed: " + err.Error()
+		return m
+	}
+
+	// Targets edited with T are kept unless the file changes them too, and
+	// the health of the targets is carried over to the new scraper
+	notice := "Reloaded " + m.cfg.ConfigFile
+	fileTargets := !slices.Equal(cfg.URLs, m.baseCfg.URLs)
+	if fileTargets || cfg.Stagger != m.cfg.Stagger || cfg.Interval != m.cfg.Interval || cfg.Format != m.cfg.Format ||
+		!slices.Equal(cfg.Transforms, m.cfg.Transforms) || !slices.Equal(cfg.Drop, m.cfg.Drop) {
+		targets := m.fetcher.targets
+		if fileTargets {
+			if !slices.Equal(m.cfg.URLs, m.baseCfg.URLs) {
+				notice += ", discarding the targets edited with T"
+			}
+			targets, _ = parseTargets(cfg.URLs) // Validated by loadConfig
+			targets = withAuth(targets, cfg.targetAuth)
+			m.cfg.URL = cfg.URL
+			m.cfg.URLs = cfg.URLs
+			m.targetErr = nil
+		}
+		fetcher := NewScraper(targets)
+		fetcher.SetFormat(cfg.Format)
+		fetcher.SetTransforms(cfg.Transforms)
+		fetcher.SetDrop(drop)
+		if cfg.Stagger {
+			fetcher.Stagger = cfg.Interval / 2
+		}
+		fetcher.keepHealth(m.fetcher)
+		m.fetcher = fetcher
+	}
+	m.cfg.Format = cfg.Format
+	m.cfg.Transforms = cfg.Transforms
+	m.cfg.Stagger = cfg.Stagger
+	m.cfg.Interval = cfg.Interval
+	m.applyViewSettings(cfg, sel)
+	m.cfg.Density = cfg.Density
+	m.cfg.HumanUnits = cfg.HumanUnits
+	m.cfg.UnitRow = cfg.UnitRow
+	m.cfg.StripeMode = cfg.StripeMode
+	m.cfg.EscapedNames = cfg.EscapedNames
+	m.cfg.HighlightNew = cfg.HighlightNew
+	m.cfg.Drop = cfg.Drop
+	m.store.DropSeries(drop)
+	m.cfg.SLOs = cfg.SLOs
+	m.cfg.SLOWindow = cfg.SLOWindow
+	m.slos = slos
+	m.evaluateSLOs()
+	m.cfg.Bounds = cfg.Bounds
+	m.bounds = bounds
+	m.cfg.Bindings = cfg.Bindings
+	m.bindings = bindings
+	m.cfg.Views = cfg.Views
+	m.views = views
+	m.baseCfg = cfg
+	m.view = 0
+	m.cfg.Baseline = cfg.Baseline
+	m.baseline = baseline
+	// The bounds and the baseline are not part of the cache keys
+	m.rowCache = newRowCache()
+	m.missingCache = &missingCache{}
+	m.clampCursor()
+	if m.viewportReady {
+		m.refreshTable()
+	}
+	m.notice = notice
+	return m
+}
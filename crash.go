@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// crashGuard wraps the model to record the panics in Update and View, which
+// bubbletea recovers from to restore the terminal, for the crash report.
+type crashGuard struct {
+	m     model
+	crash *crashState
+}
+
+// crashState is shared by all copies of a crashGuard.
+type crashState struct {
+	last  model // As of the last completed update
+	value any   // Recovered panic, nil if it occurred in a command
+	stack []byte
+}
+
+func newCrashGuard(m model) crashGuard {
+	return crashGuard{m: m, crash: &crashState{last: m}}
+}
+
+func (g crashGuard) Init() tea.Cmd {
+	return g.m.Init()
+}
+
+func (g crashGuard) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	defer g.recordPanic()
+	updated, cmd := g.m.Update(msg)
+	g.m = updated.(model)
+	g.crash.last = g.m
+	return g, cmd
+}
+
+// View also streams the view to the clients attached to -share, as the
+// outermost model sees every frame bubbletea draws.
+func (g crashGuard) View() string {
+	defer g.recordPanic()
+	view := g.m.View()
+	if g.m.share != nil {
+		g.m.share.publish(view)
+	}
+	return view
+}
+
+// recordPanic records a panic and panics again for bubbletea to restore the
+// terminal.
+func (g crashGuard) recordPanic() {
+	if r := recover(); r != nil {
+		g.crash.value, g.crash.stack = r, debug.Stack()
+		panic(r)
+	}
+}
+
+// writeCrashReport writes the panic, the settings differing from the
+// defaults, as a -config file, and the scrape statistics to stderr and a
+// file in the temp directory.
+func writeCrashReport(c *crashState) {
+	path := filepath.Join(os.TempDir(), "openmetrics-tui-crash-"+time.Now().Format("20060102-150405")+".log")
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing crash report: %v\n", err)
+		renderCrashReport(os.Stderr, c)
+		return
+	}
+	defer f.Close()
+	renderCrashReport(io.MultiWriter(os.Stderr, f), c)
+	fmt.Fprintf(os.Stderr, "Crash report written to %s\n", path)
+}
+
+func renderCrashReport(w io.Writer, c *crashState) {
+	m := c.last
+	if c.value != nil {
+		fmt.Fprintf(w, "Panic: %v\n\n%s\n", c.value, c.stack)
+	} else {
+		fmt.Fprintln(w, "Panic in a background command, see the stack trace above")
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintln(w, "Settings:")
+	var cfg Config
+	fs := flag.NewFlagSet("crash", flag.ContinueOnError)
+	defineFlags(fs, &cfg)
+	cfg = m.cfg
+	fs.VisitAll(func(fl *flag.Flag) {
+		if value := fl.Value.String(); value != fl.DefValue {
+			fmt.Fprintf(w, "%s = %s\n", fl.Name, strconv.Quote(value))
+		}
+	})
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "Scrapes:")
+	fmt.Fprintf(w, "  session:         %s\n", time.Since(m.started).Round(time.Second))
+	fmt.Fprintf(w, "  scrapes:         %d (%d failed)\n", m.store.scrapes, m.store.failures)
+	fmt.Fprintf(w, "  series:          %d\n", len(m.store.Metrics))
+	if !m.lastSuccessfulFetch.IsZero() {
+		fmt.Fprintf(w, "  last successful: %s\n", m.lastSuccessfulFetch.Format(time.RFC3339))
+	}
+	if m.connectionError != nil {
+		fmt.Fprintf(w, "  last error:      %v\n", m.connectionError)
+	}
+	if status := m.healthStatus(); status != "" {
+		fmt.Fprintf(w, "  flakiest target: %s\n", status)
+	}
+	if len(m.notes) > 0 {
+		fmt.Fprintln(w, "\nNotes:")
+		writeNotes(w, m.notes)
+	}
+}
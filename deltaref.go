@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+)
+
+// refAge returns the age in scrapes of the reference sample of the ref delta
+// mode: the one chosen with r, < and >, or else the oldest in the history.
+// It is HistoryLimit or more once the chosen sample left the history.
+func (m model) refAge() int {
+	if m.refScrape == 0 || m.refScrape > m.store.scrapes {
+		return max(min(int(m.store.scrapes), m.store.HistoryLimit)-1, 0)
+	}
+	return int(m.store.scrapes - m.refScrape)
+}
+
+// refOffset returns the offset from the current column of the value column
+// holding the reference sample.
+func (m model) refOffset() int {
+	window := max(m.cfg.ColumnWindow, 1)
+	return (m.refAge() + window - 1) / window
+}
+
+// setReference makes the sample age scrapes before the last one the
+// reference, clamped to the history, and switches to the ref delta mode.
+func (m model) setReference(age int) model {
+	age = max(min(age, min(int(m.store.scrapes), m.store.HistoryLimit)-1), 0)
+	m.refScrape = m.store.scrapes - uint64(age)
+	m.cfg.DeltaMode = DeltaModeRef
+	m.notice = "Deltas from the newest sample"
+	if age > 0 {
+		m.notice = fmt.Sprintf("Deltas from the sample at %s", ageTitle(m.store, age, m.cfg.Interval))
+	}
+	if m.viewportReady {
+		m.refreshTable()
+	}
+	return m
+}
+
+// moveReference moves the reference by columns, older for negative ones.
+func (m model) moveReference(columns int) model {
+	return m.setReference(m.refAge() - columns*max(m.cfg.ColumnWindow, 1))
+}
+
+// refStatus describes the reference for the footer, e.g. "-5s".
+func (m model) refStatus() string {
+	if m.refAge() >= m.store.HistoryLimit {
+		return "out of history"
+	}
+	return ageTitle(m.store, m.refAge(), m.cfg.Interval)
+}
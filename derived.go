@@ -0,0 +1,95 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Suffixes of the synthetic series derived from the _sum and _count series of
+// summaries and histograms. The colon marks them as not exposed, following
+// the recording rule naming convention.
+const (
+	derivedAvgSuffix       = ":avg"        // Average of the samples observed in the interval
+	derivedCountRateSuffix = ":count_rate" // Samples observed per second
+)
+
+// updateDerived appends the values of the last interval to the synthetic
+// series of each _sum and _count pair. Derived series whose sources were
+// evicted are dropped.
+func (s *Store) updateDerived(now time.Time) {
+	elapsed := now.Sub(s.lastScrape).Seconds()
+	s.lastScrape = now
+
+	seen := make(map[string]bool, len(s.Derived))
+	for _, sum := range s.Metrics {
+		base, ok := strings.CutSuffix(sum.Name, "_sum")
+		if !ok {
+			continue
+		}
+		count, ok := s.Metrics[GenerateSignature(base+"_count", sum.Labels)]
+		if !ok {
+			continue
+		}
+		dSum, dCount := lastIncrease(sum), lastIncrease(count)
+
+		avg := s.derivedSeries(base+derivedAvgSuffix, sum.Unit, sum.Labels, seen)
+		if dCount > 0 {
+			s.appendValue(avg, dSum/dCount)
+		} else {
+			s.appendValue(avg, math.NaN())
+		}
+		rate := s.derivedSeries(base+derivedCountRateSuffix, "", sum.Labels, seen)
+		if elapsed > 0 && !math.IsNaN(dCount) {
+			s.appendValue(rate, dCount/elapsed)
+		} else {
+			s.appendValue(rate, math.NaN())
+		}
+	}
+	for sig := range s.Derived {
+		if !seen[sig] {
+			delete(s.Derived, sig)
+		}
+	}
+}
+
+// derivedSeries returns the derived series of the given name and labels,
+// creating it if needed, and marks it as seen.
+func (s *Store) derivedSeries(name, unit string, labels map[string]string, seen map[string]bool) *MetricSeries {
+	sig := GenerateSignature(name, labels)
+	seen[sig] = true
+	series, ok := s.Derived[sig]
+	if !ok {
+		series = &MetricSeries{
+			Name:    name,
+			Unit:    unit,
+			Type:    dto.MetricType_GAUGE,
+			Labels:  labels,
+			Values:  make([]float64, 0, s.HistoryLimit),
+			Derived: true,
+			sig:     sig,
+
+			FirstSeen: s.lastScrape,
+			firstSeen: s.scrapes,
+		}
+		series.sortKey = sig
+		s.Derived[sig] = series
+	}
+	series.lastSeen = s.scrapes
+	return series
+}
+
+// lastIncrease returns the increase of a counter in the last interval, NaN if
+// unknown or the counter was reset.
+func lastIncrease(series *MetricSeries) float64 {
+	n := len(series.Values)
+	if n < 2 {
+		return math.NaN()
+	}
+	if d := series.Values[n-1] - series.Values[n-2]; d >= 0 {
+		return d
+	}
+	return math.NaN()
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// scrapeSamples returns the simple samples of a fetch result by signature,
+// and the set of metric names.
+func scrapeSamples(result FetchResult) (map[string]float64, map[string]bool, error) {
+	if result.Err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", result.Fetcher.URL, result.Err)
+	}
+	samples := make(map[string]float64)
+	names := make(map[string]bool)
+	forEachSample(result.Families, func(sig, name, _ string, _ map[string]string, value float64) {
+		samples[sig] = value
+		names[name] = true
+	})
+	return samples, names, nil
+}
+
+// runDiff implements the `diff <url1> <url2>` command. It returns the exit
+// code: 0 if the endpoints match, 1 if they differ and 2 on errors.
+func runDiff(args []string, w io.Writer) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	threshold := fs.Float64("threshold", 0, "Only report value differences larger than this")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s diff [flags] <url1> <url2>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+	url1, url2 := fs.Arg(0), fs.Arg(1)
+
+	// Scrape both at the same time so the values are comparable
+	results := FetchAll(context.Background(), []*Fetcher{NewFetcher(url1), NewFetcher(url2)}, 2, 0)
+	a, namesA, err := scrapeSamples(results[0])
+	if err != nil {
+		fmt.Fprintf(w, "Error: %v\n", err)
+		return 2
+	}
+	b, namesB, err := scrapeSamples(results[1])
+	if err != nil {
+		fmt.Fprintf(w, "Error: %v\n", err)
+		return 2
+	}
+
+	differs := false
+	section := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		differs = true
+		sort.Strings(lines)
+		fmt.Fprintf(w, "%s:\n", title)
+		for _, line := range lines {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
+
+	section("Metrics only in "+url1, onlyIn(namesA, namesB))
+	section("Metrics only in "+url2, onlyIn(namesB, namesA))
+
+	// Series only in one endpoint, for metrics present in both
+	var seriesA, seriesB, changed []string
+	for sig := range a {
+		if _, ok := b[sig]; !ok && namesB[metricNameOf(sig)] {
+			seriesA = append(seriesA, sig)
+		}
+	}
+	for sig := range b {
+		if _, ok := a[sig]; !ok && namesA[metricNameOf(sig)] {
+			seriesB = append(seriesB, sig)
+		}
+	}
+	section("Series only in "+url1, seriesA)
+	section("Series only in "+url2, seriesB)
+
+	for sig, va := range a {
+		vb, ok := b[sig]
+		if !ok || (math.IsNaN(va) && math.IsNaN(vb)) {
+			continue
+		}
+		if diff := vb - va; math.IsNaN(diff) || math.Abs(diff) > *threshold {
+			changed = append(changed, fmt.Sprintf("%s %s -> %s (%s)", sig, formatFloat(va), formatFloat(vb), formatDelta(diff)))
+		}
+	}
+	section("Value differences", changed)
+
+	if differs {
+		return 1
+	}
+	fmt.Fprintln(w, "No differences")
+	return 0
+}
+
+// onlyIn returns the keys of a which are not in b.
+func onlyIn(a, b map[string]bool) []string {
+	var keys []string
+	for k := range a {
+		if !b[k] {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// metricNameOf returns the metric name part of a series signature.
+func metricNameOf(sig string) string {
+	for i, ch := range sig {
+		if ch == '{' {
+			return sig[:i]
+		}
+	}
+	return sig
+}
+
+// formatDelta formats a difference with an explicit sign.
+func formatDelta(v float64) string {
+	if v > 0 {
+		return "+" + formatFloat(v)
+	}
+	return formatFloat(v)
+}
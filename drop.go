@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// parseDrop compiles the -drop patterns into one regex matching whole series
+// names, or nil without patterns.
+func parseDrop(patterns []string) (*regexp.Regexp, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	for _, p := range patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return nil, fmt.Errorf("invalid drop regex '%s': %v", p, err)
+		}
+	}
+	return regexp.Compile("^(?:" + strings.Join(patterns, ")$|^(?:") + ")$")
+}
+
+// SetDrop sets the series names excluded from ingestion, nil for none. They
+// are dropped from every scrape, so neither the Store nor the sinks see them.
+func (s *Scraper) SetDrop(re *regexp.Regexp) {
+	s.drop = re
+}
+
+// dropFamilies removes the families matched by -drop.
+func (s *Scraper) dropFamilies(families map[string]*dto.MetricFamily) {
+	if s.drop == nil {
+		return
+	}
+	for name := range families {
+		if s.drop.MatchString(name) {
+			delete(families, name)
+		}
+	}
+}
+
+// DropSeries removes the stored series whose name re matches, when -drop
+// changes.
+func (s *Store) DropSeries(re *regexp.Regexp) {
+	if re == nil {
+		return
+	}
+	for sig, series := range s.Metrics {
+		if re.MatchString(series.Name) {
+			delete(s.Metrics, sig)
+		}
+	}
+	s.UsedBytes = s.estimateBytes()
+}
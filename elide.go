@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// minNameWidth is the width below which metric names are not shortened
+// further, even if the essential columns then don't fit.
+const minNameWidth = 12
+
+// essentialColumns returns the number of rightmost columns kept however
+// narrow the terminal is: the current value, the newest history column and
+// the vs base and age columns.
+func (m model) essentialColumns() int {
+	n := 2
+	if m.baseline != nil {
+		n++
+	}
+	if m.cfg.ShowAge {
+		n++
+	}
+	return n
+}
+
+// fitColumns returns the number of value columns, counted from the right,
+// and the width of the metric column fitting the terminal. What doesn't fit
+// is given up in order: the oldest value columns down to the essential ones,
+// the label text and the middle of the metric names, see elideName.
+func (m model) fitColumns(colWidths []int) (int, int) {
+	// Table width is the sum of column widths plus a border per column and
+	// the left border, which compact density has none of
+	used := 2
+	if m.cfg.Density == DensityCompact {
+		used = 0
+	}
+	values := colWidths[1:]
+	essential := min(m.essentialColumns(), len(values))
+	valuesWidth := func(n int) int {
+		w := 0
+		for _, cw := range values[len(values)-n:] {
+			w += cw + 1
+		}
+		return w
+	}
+	for n := len(values); n >= essential; n-- {
+		if m.width-used-valuesWidth(n) >= colWidths[0] {
+			return max(n, 1), colWidths[0]
+		}
+	}
+	return max(essential, 1), min(colWidths[0], max(m.width-used-valuesWidth(essential), minNameWidth))
+}
+
+// labelsStart returns the width of a metric column cell up to its labels,
+// or its width if it has none.
+func labelsStart(cell string) int {
+	plain := ansi.Strip(cell)
+	if i := strings.IndexByte(plain, '{'); i >= 0 {
+		return lipgloss.Width(plain[:i])
+	}
+	return lipgloss.Width(plain)
+}
+
+// namePrefixWidth returns the width of the markers and sparkline before the
+// metric name in a metric column cell. Names start with a letter, _ or :,
+// or a quote if escaped.
+func namePrefixWidth(cell string) int {
+	plain := ansi.Strip(cell)
+	i := strings.IndexFunc(plain, func(r rune) bool {
+		return r == '_' || r == ':' || r == '"' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+	})
+	if i < 0 {
+		return 0
+	}
+	return lipgloss.Width(plain[:i])
+}
+
+// elideName shortens a metric column cell to width: the label text is cut
+// off first, and if the name itself doesn't fit, the labels are dropped and
+// the name is shortened in the middle, keeping the markers and sparkline
+// before it and its start and end.
+func elideName(cell string, width int) string {
+	if lipgloss.Width(cell) <= width {
+		return cell
+	}
+	bare := labelsStart(cell)
+	if bare+2 <= width {
+		// Room for at least "{…"
+		return ansi.Truncate(cell, width, "…")
+	}
+	cell = ansi.Truncate(cell, bare, "")
+	if bare <= width {
+		return cell
+	}
+	prefix := namePrefixWidth(cell)
+	avail := width - prefix - 1 // Name cells left besides the ellipsis
+	if avail < 2 {
+		return ansi.Truncate(cell, width, "…")
+	}
+	head, tail := prefix+(avail+1)/2, avail/2
+	return ansi.Truncate(cell, head, "") + "…" + ansi.TruncateLeft(cell, bare-tail, "")
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// eventsPanelHeight is the number of lines used by the events panel below
+// the table: a title and the most recent events.
+const eventsPanelHeight = 6
+
+// maxEvents bounds the number of events kept for the panel.
+const maxEvents = 500
+
+// maxEventSeries is the number of series listed in a single event, e.g. for
+// many series disappearing at once when a target restarts.
+const maxEventSeries = 3
+
+type event struct {
+	time time.Time
+	text string
+	warn bool
+}
+
+func (m *model) logEvent(text string, warn bool) {
+	m.events = append(m.events, event{time: time.Now(), text: text, warn: warn})
+	if len(m.events) > maxEvents {
+		m.events = m.events[len(m.events)-maxEvents:]
+	}
+}
+
+// logSeriesEvent logs a change of a set of series, listing the first few.
+func (m *model) logSeriesEvent(what string, sigs []string, warn bool) {
+	if len(sigs) == 0 {
+		return
+	}
+	text := fmt.Sprintf("%s: %s", what, strings.Join(sigs[:min(len(sigs), maxEventSeries)], ", "))
+	if len(sigs) > maxEventSeries {
+		text += fmt.Sprintf(" and %d more", len(sigs)-maxEventSeries)
+	}
+	m.logEvent(text, warn)
+}
+
+// logScrapeEvents logs the series changes of the last scrape.
+func (m *model) logScrapeEvents() {
+	appeared, disappeared, resets := m.store.Changes()
+	m.logSeriesEvent("New series", appeared, false)
+	m.logSeriesEvent("Series gone", disappeared, true)
+	m.logSeriesEvent("Counter reset", resets, true)
+}
+
+// toggleEvents shows or hides the events panel.
+func (m model) toggleEvents() model {
+	m.showEvents = !m.showEvents
+	m.resizeViewport()
+	m.ensureCursorVisible()
+	return m
+}
+
+// renderEventsPanel renders the most recent events, newest last.
+func (m model) renderEventsPanel() string {
+	title := m.labelStyle.Render(fmt.Sprintf("Events (%d, E to close)", len(m.events)))
+	warnStyle := lipgloss.NewStyle().Foreground(color("196")) // red
+	lines := []string{title}
+	for _, e := range m.events[max(len(m.events)-(eventsPanelHeight-1), 0):] {
+		line := truncateMessage(e.time.Format("15:04:05")+" "+e.text, m.width)
+		if e.warn {
+			line = warnStyle.Render(line)
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) < eventsPanelHeight {
+		lines = append(lines, "")
+	}
+	return strings.Join(lines, "\n")
+}
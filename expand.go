@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// renderLabelsOverlay shows all labels of the selected series in a popup,
+// one per line with long values wrapped, for label sets too large for the
+// table. It follows the selection while open.
+func (m model) renderLabelsOverlay(content string) string {
+	series := m.selectedSeries()
+	if series == nil {
+		return content
+	}
+
+	keys := make([]string, 0, len(series.Labels))
+	keyWidth := 0
+	for k := range series.Labels {
+		keys = append(keys, k)
+		keyWidth = max(keyWidth, lipgloss.Width(displayName(k, true, m.cfg.EscapedNames)))
+	}
+	sort.Strings(keys)
+
+	// Within a margin, the border and the padding
+	width := max(m.width-10, 20)
+	valueWidth := max(width-keyWidth-1, 10)
+	valueStyle := lipgloss.NewStyle().Width(valueWidth)
+	var lines []string
+	for _, k := range keys {
+		key := m.labelStyle.Render(fmt.Sprintf("%-*s", keyWidth, displayName(k, true, m.cfg.EscapedNames)))
+		for i, line := range strings.Split(valueStyle.Render(series.Labels[k]), "\n") {
+			if i > 0 {
+				key = strings.Repeat(" ", keyWidth)
+			}
+			lines = append(lines, key+" "+strings.TrimRight(line, " "))
+		}
+	}
+	if len(keys) == 0 {
+		lines = append(lines, m.labelStyle.Render("No labels"))
+	}
+
+	// Border, padding, the title and hint lines and the blank lines around
+	maxLines := max(m.height-8, 1)
+	if len(lines) > maxLines {
+		more := len(lines) - maxLines + 1
+		lines = append(lines[:maxLines-1], m.labelStyle.Render(fmt.Sprintf("… %d more lines", more)))
+	}
+
+	title := ansi.Truncate(m.metricNameStyle.Render(displayName(series.Name, false, m.cfg.EscapedNames))+
+		m.labelStyle.Render(fmt.Sprintf(" (%d labels)", len(keys))), width, "…")
+	hint := m.labelStyle.Render("↑/↓ to follow the selection, i or esc to close")
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(color("63")).
+		Padding(1, 2).
+		Render(title + "\n\n" + strings.Join(lines, "\n") + "\n\n" + hint)
+
+	return lipgloss.Place(
+		m.width,
+		m.height,
+		lipgloss.Center,
+		lipgloss.Center,
+		box,
+		lipgloss.WithWhitespaceChars(" "),
+		lipgloss.WithWhitespaceForeground(color("0")),
+	)
+}
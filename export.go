@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/csv"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// exportHistory writes the collected history of all series to a CSV file.
+// Each row is a series signature followed by its values, oldest first, with
+// empty cells for missing samples. If any series has a note, a final note
+// column holds them.
+func exportHistory(store *Store, notes map[string]string, interval time.Duration, path string) error {
+	keys := make([]string, 0, len(store.Metrics))
+	for k := range store.Metrics {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return exportSeries(store, keys, notes, interval, path)
+}
+
+// exportSeries writes the history of the series with the given signatures, in
+// that order, in the format of exportHistory.
+func exportSeries(store *Store, keys []string, notes map[string]string, interval time.Duration, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	header := []string{"series"}
+	for i := store.HistoryLimit - 1; i > 0; i-- {
+		// In seconds, fractional for sub-second intervals
+		header = append(header, "-"+strconv.FormatFloat((time.Duration(i)*interval).Seconds(), 'f', -1, 64)+"s")
+	}
+	header = append(header, "0s")
+	valueColumns := len(header)
+	if len(notes) > 0 {
+		header = append(header, "note")
+	}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		series, ok := store.Metrics[k]
+		if !ok {
+			if series, ok = store.Derived[k]; !ok {
+				continue
+			}
+		}
+		record := make([]string, len(header))
+		record[0] = k
+		// Right-align values so the newest sample is in the last column
+		offset := valueColumns - len(series.Values)
+		for i, v := range series.Values {
+			if !math.IsNaN(v) {
+				record[offset+i] = strconv.FormatFloat(v, 'g', -1, 64)
+			}
+		}
+		if len(notes) > 0 {
+			record[valueColumns] = notes[k]
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	promModel "github.com/prometheus/common/model"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Exposition format constants for the -format flag
+const (
+	FormatAuto        = "auto"
+	FormatText        = "text"
+	FormatOpenMetrics = "openmetrics"
+	FormatProtobuf    = "protobuf"
+	FormatJSON        = "json" // As written by prom2json
+)
+
+// sniffLength is the number of bytes of a response looked at to detect its
+// format.
+const sniffLength = 512
+
+// contentTypeFormat returns the format named by a Content-Type header, or ""
+// if it names none.
+func contentTypeFormat(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	switch mediaType {
+	case "text/plain":
+		return FormatText
+	case "application/openmetrics-text":
+		return FormatOpenMetrics
+	case "application/vnd.google.protobuf":
+		return FormatProtobuf
+	case "application/json":
+		return FormatJSON
+	}
+	return ""
+}
+
+// sniffFormat returns the format the body is recognized as, or "" if it
+// looks like text in either the Prometheus or OpenMetrics format without
+// the OpenMetrics # EOF marker.
+func sniffFormat(body []byte) string {
+	head := body[:min(len(body), sniffLength)]
+	if trimmed := bytes.TrimLeft(head, " \t\r\n"); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return FormatJSON
+	}
+	// Delimited protobuf starts with the length of the first family
+	// followed by the tag of its name, and has control characters text
+	// doesn't
+	if _, n := protowire.ConsumeVarint(head); n > 0 && n < len(head) && head[n] == 0x0a {
+		if !utf8.Valid(head) || bytes.ContainsFunc(head, func(r rune) bool { return r < ' ' && r != '\t' && r != '\n' && r != '\r' }) {
+			return FormatProtobuf
+		}
+	}
+	if bytes.HasSuffix(bytes.TrimRight(body, " \t\r\n"), []byte("# EOF")) {
+		return FormatOpenMetrics
+	}
+	return ""
+}
+
+// detectFormat returns the format of a response and how it was detected,
+// for errors. The body wins over a contradicting Content-Type, as servers
+// often send a generic or wrong one.
+func detectFormat(contentType string, body []byte) (string, string) {
+	declared := contentTypeFormat(contentType)
+	sniffed := sniffFormat(body)
+	switch {
+	case sniffed != "" && declared != "" && sniffed != declared:
+		return sniffed, fmt.Sprintf("detected from the body, despite Content-Type %s", contentType)
+	case sniffed != "":
+		return sniffed, "detected from the body"
+	case declared != "":
+		return declared, "detected from Content-Type " + contentType
+	case contentType != "":
+		return FormatText, fmt.Sprintf("default for unknown Content-Type %s", contentType)
+	}
+	return FormatText, "default without Content-Type"
+}
+
+// parseExposition parses a response body in the given format.
+func parseExposition(body []byte, format string) (map[string]*dto.MetricFamily, error) {
+	switch format {
+	case FormatOpenMetrics:
+		text, units := openMetricsToText(body)
+		families, err := parseText(text)
+		if err != nil {
+			return nil, err
+		}
+		for name, unit := range units {
+			if family, ok := families[name]; ok {
+				family.Unit = &unit
+			}
+		}
+		return families, nil
+	case FormatProtobuf:
+		return parseProtobuf(body)
+	case FormatJSON:
+		return parseJSON(body)
+	}
+	return parseText(body)
+}
+
+func parseText(body []byte) (map[string]*dto.MetricFamily, error) {
+	parser := expfmt.NewTextParser(promModel.UTF8Validation)
+	return parser.TextToMetricFamilies(bytes.NewReader(body))
+}
+
+func parseProtobuf(body []byte) (map[string]*dto.MetricFamily, error) {
+	dec := expfmt.NewDecoder(bytes.NewReader(body), expfmt.NewFormat(expfmt.TypeProtoDelim).WithEscapingScheme(promModel.NoEscaping))
+	families := make(map[string]*dto.MetricFamily)
+	for {
+		var family dto.MetricFamily
+		if err := dec.Decode(&family); err != nil {
+			if errors.Is(err, io.EOF) {
+				return families, nil
+			}
+			return nil, fmt.Errorf("family %d: %w", len(families)+1, err)
+		}
+		families[family.GetName()] = &family
+	}
+}
+
+// openMetricsToText rewrites OpenMetrics text to the Prometheus text format,
+// and returns the units of the families by name, which it has no place for.
+// Counter families are named after their _total samples, _created samples
+// and exemplars are dropped and timestamps converted to milliseconds.
+// Families of types the text format doesn't have are untyped.
+func openMetricsToText(body []byte) ([]byte, map[string]string) {
+	// Metadata may come in any order, so the types are needed up front
+	types := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 4 && fields[0] == "#" && fields[1] == "TYPE" {
+			types[fields[2]] = fields[3]
+		}
+	}
+	rename := func(name string) string {
+		switch types[name] {
+		case "counter":
+			if !strings.HasSuffix(name, "_total") {
+				return name + "_total"
+			}
+		case "info":
+			return name + "_info"
+		}
+		return name
+	}
+
+	var out bytes.Buffer
+	units := make(map[string]string)
+	scanner = bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "# EOF" {
+			break
+		}
+		if rest, ok := strings.CutPrefix(line, "# "); ok {
+			kind, rest, _ := strings.Cut(rest, " ")
+			name, value, _ := strings.Cut(rest, " ")
+			switch kind {
+			case "TYPE":
+				switch value {
+				case "counter", "gauge", "histogram", "summary":
+				case "info", "stateset":
+					value = "gauge"
+				default:
+					continue
+				}
+				fmt.Fprintf(&out, "# TYPE %s %s\n", rename(name), value)
+			case "HELP":
+				fmt.Fprintf(&out, "# HELP %s %s\n", rename(name), value)
+			case "UNIT":
+				units[rename(name)] = value
+			}
+			continue
+		}
+		if sample, ok := openMetricsSample(line, types); ok {
+			out.WriteString(sample + "\n")
+		}
+	}
+	return out.Bytes(), units
+}
+
+// openMetricsSample rewrites an OpenMetrics sample line, and returns false
+// if it is dropped.
+func openMetricsSample(line string, types map[string]string) (string, bool) {
+	// The labels end at the first } outside a quoted value
+	end := strings.IndexAny(line, "{ ")
+	if end < 0 {
+		return line, true
+	}
+	name := line[:end]
+	if line[end] == '{' {
+		quoted, escaped := false, false
+		for end++; end < len(line); end++ {
+			c := line[end]
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				quoted = !quoted
+			} else if c == '}' && !quoted {
+				end++
+				break
+			}
+		}
+	}
+	if base, ok := strings.CutSuffix(name, "_created"); ok {
+		switch types[base] {
+		case "counter", "histogram", "summary":
+			return "", false
+		}
+	}
+
+	rest := line[end:]
+	if i := strings.Index(rest, " # "); i >= 0 {
+		rest = rest[:i] // Exemplar
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 2 {
+		if ts, err := strconv.ParseFloat(fields[1], 64); err == nil {
+			fields[1] = strconv.FormatInt(int64(math.Round(ts*1000)), 10)
+		}
+	}
+	return line[:end] + " " + strings.Join(fields, " "), true
+}
+
+// jsonFamily is a metric family as written by prom2json.
+type jsonFamily struct {
+	Name    string `json:"name"`
+	Help    string `json:"help"`
+	Type    string `json:"type"`
+	Metrics []struct {
+		Labels      map[string]string `json:"labels"`
+		TimestampMs string            `json:"timestamp_ms"`
+		Value       string            `json:"value"`
+		Quantiles   map[string]string `json:"quantiles"`
+		Buckets     map[string]string `json:"buckets"`
+		Count       string            `json:"count"`
+		Sum         string            `json:"sum"`
+	} `json:"metrics"`
+}
+
+func parseJSON(body []byte) (map[string]*dto.MetricFamily, error) {
+	var in []jsonFamily
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	families := make(map[string]*dto.MetricFamily, len(in))
+	for _, jf := range in {
+		kind, ok := dto.MetricType_value[strings.ToUpper(jf.Type)]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown type %q", jf.Name, jf.Type)
+		}
+		family := &dto.MetricFamily{Name: &jf.Name, Help: &jf.Help, Type: dto.MetricType(kind).Enum()}
+		for _, jm := range jf.Metrics {
+			var err error
+			float := func(s string) *float64 {
+				v, perr := strconv.ParseFloat(s, 64)
+				if perr != nil && err == nil {
+					err = fmt.Errorf("%s: invalid value %q", jf.Name, s)
+				}
+				return &v
+			}
+			metric := &dto.Metric{}
+			for k, v := range jm.Labels {
+				metric.Label = append(metric.Label, &dto.LabelPair{Name: &k, Value: &v})
+			}
+			if jm.TimestampMs != "" {
+				ts, perr := strconv.ParseInt(jm.TimestampMs, 10, 64)
+				if perr != nil {
+					return nil, fmt.Errorf("%s: invalid timestamp %q", jf.Name, jm.TimestampMs)
+				}
+				metric.TimestampMs = &ts
+			}
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				metric.Counter = &dto.Counter{Value: float(jm.Value)}
+			case dto.MetricType_GAUGE:
+				metric.Gauge = &dto.Gauge{Value: float(jm.Value)}
+			case dto.MetricType_SUMMARY:
+				metric.Summary = &dto.Summary{SampleSum: float(jm.Sum)}
+				count := uint64(*float(jm.Count))
+				metric.Summary.SampleCount = &count
+				for q, v := range jm.Quantiles {
+					metric.Summary.Quantile = append(metric.Summary.Quantile, &dto.Quantile{Quantile: float(q), Value: float(v)})
+				}
+				slices.SortFunc(metric.Summary.Quantile, func(a, b *dto.Quantile) int { return cmp.Compare(a.GetQuantile(), b.GetQuantile()) })
+			case dto.MetricType_HISTOGRAM:
+				metric.Histogram = &dto.Histogram{SampleSum: float(jm.Sum)}
+				count := uint64(*float(jm.Count))
+				metric.Histogram.SampleCount = &count
+				for le, v := range jm.Buckets {
+					c := uint64(*float(v))
+					metric.Histogram.Bucket = append(metric.Histogram.Bucket, &dto.Bucket{UpperBound: float(le), CumulativeCount: &c})
+				}
+				slices.SortFunc(metric.Histogram.Bucket, func(a, b *dto.Bucket) int { return cmp.Compare(a.GetUpperBound(), b.GetUpperBound()) })
+			default:
+				metric.Untyped = &dto.Untyped{Value: float(jm.Value)}
+			}
+			if err != nil {
+				return nil, err
+			}
+			family.Metric = append(family.Metric, metric)
+		}
+		families[jf.Name] = family
+	}
+	return families, nil
+}
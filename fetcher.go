@@ -1,16 +1,23 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"net/http"
+	"sync"
 	"time"
 
 	dto "github.com/prometheus/client_model/go"
-	"github.com/prometheus/common/expfmt"
-	promModel "github.com/prometheus/common/model"
 )
 
 type Fetcher struct {
-	URL    string
+	URL string
+	// Authorization is sent as the Authorization header, if not empty
+	Authorization string
+	// Format is the exposition format of the responses, detected from each
+	// response with FormatAuto or empty, see detectFormat
+	Format string
 	client *http.Client
 }
 
@@ -24,12 +31,95 @@ func NewFetcher(url string) *Fetcher {
 }
 
 func (f *Fetcher) Fetch() (map[string]*dto.MetricFamily, error) {
+	return f.FetchContext(context.Background())
+}
+
+// FetchContext fetches and parses the metrics, aborting when ctx is done.
+func (f *Fetcher) FetchContext(ctx context.Context) (map[string]*dto.MetricFamily, error) {
+	if pid, ok := procPID(f.URL); ok {
+		return fetchProc(ctx, pid)
+	}
+	if dir, ok := textfileDir(f.URL); ok {
+		return fetchTextfiles(ctx, dir)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if f.Authorization != "" {
+		req.Header.Set("Authorization", f.Authorization)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	format, how := f.Format, "set with -format"
+	if format == "" || format == FormatAuto {
+		format, how = detectFormat(resp.Header.Get("Content-Type"), body)
+	}
+	families, err := parseExposition(body, format)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse as %s (%s): %w", format, how, err)
+	}
+	return flattenFamilies(families), nil
+}
+
+// FetchRaw returns the unparsed exposition body.
+func (f *Fetcher) FetchRaw() ([]byte, error) {
 	resp, err := f.client.Get(f.URL)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	parser := expfmt.NewTextParser(promModel.UTF8Validation)
-	return parser.TextToMetricFamilies(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// inflight tracks the most recent fetch of the UI. Starting a new fetch
+// cancels an outdated one still in flight.
+type inflight struct {
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// start cancels the previous fetch, if any, and returns the context for a new
+// one derived from parent.
+func (f *inflight) start(parent context.Context) context.Context {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.cancel != nil {
+		f.cancel()
+	}
+	f.ctx, f.cancel = context.WithCancel(parent)
+	return f.ctx
+}
+
+// finish releases the context of a completed fetch.
+func (f *inflight) finish(ctx context.Context) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.ctx == ctx {
+		f.cancel()
+		f.ctx, f.cancel = nil, nil
+	}
+}
+
+// busy reports whether a fetch is in flight.
+func (f *inflight) busy() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.ctx != nil
 }
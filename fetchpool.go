@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// FetchResult is the outcome of fetching one target.
+type FetchResult struct {
+	Fetcher  *Fetcher
+	Families map[string]*dto.MetricFamily
+	Err      error
+	Duration time.Duration
+}
+
+// FetchAll fetches all targets concurrently with at most workers requests in
+// flight, so slow targets don't serialize the others. Each fetch gets its own
+// context derived from ctx, limited by timeout if positive. Results are
+// returned in the order of fetchers, each written by exactly one worker.
+func FetchAll(ctx context.Context, fetchers []*Fetcher, workers int, timeout time.Duration) []FetchResult {
+	return FetchAllStaggered(ctx, fetchers, workers, timeout, 0)
+}
+
+// FetchAllStaggered is FetchAll with the start of the fetches spread evenly
+// across window, so many targets sharing an interval are not all hit at the
+// same instant. Fetches not started when ctx is done fail with its error.
+func FetchAllStaggered(ctx context.Context, fetchers []*Fetcher, workers int, timeout, window time.Duration) []FetchResult {
+	results := make([]FetchResult, len(fetchers))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(max(workers, 1), len(fetchers)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = fetchOne(ctx, fetchers[i], timeout)
+			}
+		}()
+	}
+	start := time.Now()
+	for i := range fetchers {
+		if wait := time.Until(start.Add(staggerOffset(i, len(fetchers), window))); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+			}
+		}
+		if ctx.Err() != nil {
+			results[i] = FetchResult{Fetcher: fetchers[i], Err: ctx.Err()}
+			continue
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+func fetchOne(ctx context.Context, f *Fetcher, timeout time.Duration) FetchResult {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	families, err := f.FetchContext(ctx)
+	return FetchResult{Fetcher: f, Families: families, Err: err, Duration: time.Since(start)}
+}
+
+// staggerOffset returns the delay of the start of fetch i of n within window.
+func staggerOffset(i, n int, window time.Duration) time.Duration {
+	if n == 0 {
+		return 0
+	}
+	return window * time.Duration(i) / time.Duration(n)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// pollInterval returns the current polling interval, which is the
+// -unfocused-interval while the terminal has lost focus.
+func (m model) pollInterval() time.Duration {
+	if m.unfocused && m.cfg.UnfocusedInterval > m.cfg.Interval {
+		return m.cfg.UnfocusedInterval
+	}
+	return m.cfg.Interval
+}
+
+// updateFocus handles the focus reports enabled with -unfocused-interval.
+// Losing focus slows down the next ticks, regaining it fetches right away and
+// restarts the ticks at full speed.
+func (m model) updateFocus(focused bool) (tea.Model, tea.Cmd) {
+	if focused != m.unfocused {
+		return m, nil
+	}
+	m.unfocused = !focused
+	if m.unfocused {
+		m.logEvent("Terminal unfocused, polling every "+m.pollInterval().String(), false)
+		return m, nil
+	}
+	m.logEvent("Terminal focused, polling every "+m.pollInterval().String(), false)
+	// Supersede the pending slow tick
+	m.tickGen++
+	if m.isPaused || m.fetches.busy() {
+		return m, m.tickCmd()
+	}
+	return m, tea.Batch(m.fetchCmd(), m.tickCmd())
+}
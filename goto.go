@@ -0,0 +1,76 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// newGotoInput creates the prompt used to jump to a metric by name.
+func newGotoInput() textinput.Model {
+	ti := textinput.New()
+	ti.Prompt = "goto: "
+	ti.Placeholder = "metric name (tab to complete)"
+	ti.ShowSuggestions = true
+	return ti
+}
+
+// startGoto opens the goto prompt with the current metric names as completions.
+func (m model) startGoto() (tea.Model, tea.Cmd) {
+	m.gotoInput = newGotoInput()
+	m.gotoInput.SetSuggestions(m.metricNames())
+	m.gotoActive = true
+	return m, m.gotoInput.Focus()
+}
+
+// updateGoto handles key presses while the goto prompt is open.
+func (m model) updateGoto(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "ctrl+c":
+		m.gotoActive = false
+		return m, nil
+	case "enter":
+		m.gotoActive = false
+		m.gotoQuery = strings.TrimSpace(m.gotoInput.Value())
+		m.jumpToMatch(0, 1)
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.gotoInput, cmd = m.gotoInput.Update(msg)
+	return m, cmd
+}
+
+// jumpToMatch moves the cursor to the next row, searching from the cursor plus
+// start in direction dir, whose metric name contains the goto query. The
+// search wraps around the table.
+func (m *model) jumpToMatch(start, dir int) {
+	if m.gotoQuery == "" {
+		return
+	}
+	series := m.visibleSeries()
+	n := len(series)
+	for i := 0; i < n; i++ {
+		idx := ((m.cursor+start+dir*i)%n + n) % n
+		if strings.Contains(series[idx].Name, m.gotoQuery) {
+			m.moveCursor(idx - m.cursor)
+			return
+		}
+	}
+}
+
+// metricNames returns the sorted, unique metric names in the store.
+func (m model) metricNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, series := range m.store.Metrics {
+		if !seen[series.Name] {
+			seen[series.Name] = true
+			names = append(names, series.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
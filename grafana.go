@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// grafanaAnnotator records findings as annotations through the HTTP API of
+// Grafana, on a dashboard or, without one, for the whole organization.
+type grafanaAnnotator struct {
+	URL       string
+	Token     string
+	Dashboard string // UID, empty for an organization annotation
+	Tags      []string
+	client    *http.Client
+}
+
+// grafanaAnnotation is the body of POST /api/annotations.
+type grafanaAnnotation struct {
+	DashboardUID string   `json:"dashboardUID,omitempty"`
+	Time         int64    `json:"time"`
+	TimeEnd      int64    `json:"timeEnd"`
+	Tags         []string `json:"tags"`
+	Text         string   `json:"text"`
+}
+
+// annotationMsg is sent when an annotation request completes.
+type annotationMsg struct {
+	series int
+	err    error
+}
+
+func newGrafanaAnnotator(url, token, dashboard string, tags []string) *grafanaAnnotator {
+	return &grafanaAnnotator{
+		URL:       strings.TrimSuffix(url, "/"),
+		Token:     token,
+		Dashboard: dashboard,
+		Tags:      append([]string{"openmetrics-tui"}, tags...),
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// annotate adds a region annotation from start to end.
+func (g *grafanaAnnotator) annotate(ctx context.Context, start, end time.Time, text string) error {
+	body, err := json.Marshal(grafanaAnnotation{
+		DashboardUID: g.Dashboard,
+		Time:         start.UnixMilli(),
+		TimeEnd:      end.UnixMilli(),
+		Tags:         g.Tags,
+		Text:         text,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.URL+"/api/annotations", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// annotationText lists the series with their notes, one per line.
+func annotationText(sigs []string, notes map[string]string) string {
+	lines := make([]string, 0, len(sigs))
+	for _, sig := range sigs {
+		if note := notes[sig]; note != "" {
+			lines = append(lines, sig+": "+note)
+		} else {
+			lines = append(lines, sig)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// annotateGrafana records the time range of the history, which stays put
+// while paused, as a Grafana annotation with the marked (or selected) series
+// and their notes, and clears the marks.
+func (m model) annotateGrafana() (tea.Model, tea.Cmd) {
+	if m.grafana == nil {
+		m.notice = "Grafana annotations need -grafana-url"
+		return m, nil
+	}
+	start, end, ok := m.store.TimeRange()
+	sigs := m.bulkTargets()
+	if !ok || len(sigs) == 0 {
+		return m, nil
+	}
+	clear(m.marked)
+	if m.viewportReady {
+		m.refreshTable()
+	}
+	m.notice = "Annotating in Grafana..."
+	g, ctx, text := m.grafana, m.ctx, annotationText(sigs, m.notes)
+	return m, func() tea.Msg {
+		return annotationMsg{series: len(sigs), err: g.annotate(ctx, start, end, text)}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import "math"
+
+// Graph mode constants
+const (
+	GraphModeOff     = "off"
+	GraphModeBraille = "braille"
+	GraphModeCompact = "compact" // Braille graphs in compact density only
+)
+
+// showGraph reports whether trend graphs are shown at the current density.
+func (m model) showGraph() bool {
+	switch m.cfg.GraphMode {
+	case GraphModeBraille:
+		return true
+	case GraphModeCompact:
+		return m.cfg.Density == DensityCompact
+	}
+	return false
+}
+
+// graphWidth returns the width in cells of a trend graph, two samples per
+// cell.
+func (m model) graphWidth() int {
+	return (max(m.cfg.History, 2) + 1) / 2
+}
+
+// graphValues returns the values plotted for a series: the raw values, or
+// the historical deltas in the next and view delta modes. Deltas from a
+// reference have the shape of the raw values.
+func (m model) graphValues(series *MetricSeries) []float64 {
+	if m.cfg.DeltaMode == DeltaModeOff || m.cfg.DeltaMode == DeltaModeRef {
+		return series.Values
+	}
+	vals := series.ValuesWithDeltas(m.cfg.DeltaMode)
+	if len(vals) == 0 {
+		return nil
+	}
+	// The last value is absolute (next) or aggregated (view), not a delta
+	return vals[:len(vals)-1]
+}
+
+// brailleDots holds the braille dot bits for the left and right sample
+// column of a cell, indexed by level from the bottom.
+var brailleDots = [2][4]rune{
+	{0x40, 0x04, 0x02, 0x01},
+	{0x80, 0x20, 0x10, 0x08},
+}
+
+// brailleGraph renders values as a line chart of width cells using braille
+// dots, giving two samples per cell and four levels per cell height. The
+// graph is right-aligned so the newest sample is always in the last cell.
+// Missing values leave gaps.
+func brailleGraph(values []float64, width int) string {
+	if len(values) > 2*width {
+		values = values[len(values)-2*width:]
+	}
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			lo, hi = math.Min(lo, v), math.Max(hi, v)
+		}
+	}
+
+	cells := make([]rune, width)
+	for i := range cells {
+		cells[i] = 0x2800
+	}
+	offset := 2*width - len(values)
+	prevLevel := -1
+	for i, v := range values {
+		if math.IsNaN(v) {
+			prevLevel = -1
+			continue
+		}
+		level := 0
+		if hi > lo {
+			level = int(math.Round((v - lo) / (hi - lo) * 3))
+		}
+		// Connect to the previous sample by filling the levels in between
+		from, to := level, level
+		if prevLevel >= 0 && prevLevel < level-1 {
+			from = prevLevel + 1
+		}
+		if prevLevel > level+1 {
+			to = prevLevel - 1
+		}
+		pos := offset + i
+		for l := from; l <= to; l++ {
+			cells[pos/2] |= brailleDots[pos%2][l]
+		}
+		prevLevel = level
+	}
+	return string(cells)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// grpcHealth polls the standard gRPC health service of the target, see
+// -grpc-health.
+type grpcHealth struct {
+	conn    *grpc.ClientConn
+	client  healthpb.HealthClient
+	service string // Empty for the overall health of the server
+}
+
+// grpcHealthMsg is the result of a health check: the serving status, or the
+// error if the check failed.
+type grpcHealthMsg struct {
+	status healthpb.HealthCheckResponse_ServingStatus
+	err    error
+}
+
+func newGRPCHealth(addr, service string, useTLS bool) (*grpcHealth, error) {
+	creds := insecure.NewCredentials()
+	if useTLS {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	return &grpcHealth{conn: conn, client: healthpb.NewHealthClient(conn), service: service}, nil
+}
+
+// grpcHealthCmd checks the health of the gRPC service, with the polling
+// interval as timeout.
+func (m model) grpcHealthCmd() tea.Cmd {
+	if m.grpcHealth == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(m.ctx, m.cfg.Interval)
+		defer cancel()
+		resp, err := m.grpcHealth.client.Check(ctx, &healthpb.HealthCheckRequest{Service: m.grpcHealth.service})
+		if m.ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return grpcHealthMsg{err: err}
+		}
+		return grpcHealthMsg{status: resp.GetStatus()}
+	}
+}
+
+// grpcHealthStatus describes the last health check for the footer, e.g.
+// "gRPC: SERVING", and whether the service is healthy.
+func (m model) grpcHealthStatus() (string, bool) {
+	prefix := "gRPC"
+	if m.grpcHealth.service != "" {
+		prefix += " " + m.grpcHealth.service
+	}
+	switch {
+	case m.grpcStatus == nil:
+		return prefix + ": ?", true
+	case m.grpcStatus.err != nil:
+		return prefix + ": " + status.Code(m.grpcStatus.err).String(), false
+	}
+	return prefix + ": " + m.grpcStatus.status.String(), m.grpcStatus.status == healthpb.HealthCheckResponse_SERVING
+}
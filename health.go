@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// healthHistory is the number of scrapes per target kept for the flakiness
+// indicator.
+const healthHistory = 20
+
+// scrapeHealth is the outcome of the recent scrapes of a target, oldest
+// first, true for success.
+type scrapeHealth []bool
+
+func (h scrapeHealth) failures() int {
+	n := 0
+	for _, ok := range h {
+		if !ok {
+			n++
+		}
+	}
+	return n
+}
+
+// String renders the outcomes as e.g. ✓✓✗✓.
+func (h scrapeHealth) String() string {
+	var b strings.Builder
+	for _, ok := range h {
+		if ok {
+			b.WriteString("✓")
+		} else {
+			b.WriteString("✗")
+		}
+	}
+	return b.String()
+}
+
+// outage is the time a target was down, from its first failed scrape to the
+// next successful one.
+type outage struct {
+	target     Target
+	start, end time.Time
+}
+
+func (o outage) duration() time.Duration {
+	return o.end.Sub(o.start)
+}
+
+// recordHealth appends the outcome of a scrape of each target at now and
+// accounts the downtime of the targets which failed.
+func (s *Scraper) recordHealth(errs []error, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.health == nil {
+		s.health = make([]scrapeHealth, len(s.targets))
+		s.downSince = make([]time.Time, len(s.targets))
+		s.downtime = make([]time.Duration, len(s.targets))
+	}
+	for i, err := range errs {
+		s.health[i] = append(s.health[i], err == nil)
+		if len(s.health[i]) > healthHistory {
+			s.health[i] = s.health[i][1:]
+		}
+		switch {
+		case err != nil && s.downSince[i].IsZero():
+			s.downSince[i] = now
+		case err == nil && !s.downSince[i].IsZero():
+			o := outage{target: s.targets[i], start: s.downSince[i], end: now}
+			s.downtime[i] += o.duration()
+			s.recovered = append(s.recovered, o)
+			s.downSince[i] = time.Time{}
+		}
+	}
+}
+
+// keepHealth carries the health and downtime of the targets of old over to
+// the targets with the same URL, so rebuilding the scraper does not reset them.
+func (s *Scraper) keepHealth(old *Scraper) {
+	old.mu.Lock()
+	defer old.mu.Unlock()
+	if old.health == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.health = make([]scrapeHealth, len(s.targets))
+	s.downSince = make([]time.Time, len(s.targets))
+	s.downtime = make([]time.Duration, len(s.targets))
+	for i, t := range s.targets {
+		for j, o := range old.targets {
+			if o.URL == t.URL {
+				s.health[i] = slices.Clone(old.health[j])
+				s.downSince[i] = old.downSince[j]
+				s.downtime[i] = old.downtime[j]
+				break
+			}
+		}
+	}
+}
+
+// takeRecovered returns the outages which ended since the last call.
+func (s *Scraper) takeRecovered() []outage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	recovered := s.recovered
+	s.recovered = nil
+	return recovered
+}
+
+// totalDowntime returns the downtime of target i during the session,
+// including the outage still ongoing at now.
+func (s *Scraper) totalDowntime(i int, now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i >= len(s.downtime) {
+		return 0
+	}
+	total := s.downtime[i]
+	if !s.downSince[i].IsZero() {
+		total += now.Sub(s.downSince[i])
+	}
+	return total
+}
+
+// flakiest returns the index of the target with the most failures among its
+// recent scrapes, the target and their outcomes, or false if all recent
+// scrapes succeeded.
+func (s *Scraper) flakiest() (int, Target, scrapeHealth, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	worst, failures := -1, 0
+	for i, h := range s.health {
+		if n := h.failures(); n > failures {
+			worst, failures = i, n
+		}
+	}
+	if worst < 0 {
+		return -1, Target{}, nil, false
+	}
+	return worst, s.targets[worst], append(scrapeHealth(nil), s.health[worst]...), true
+}
+
+// healthStatus describes the flakiest target for the footer, e.g.
+// "localhost:9100 ✓✓✗✓ 1/20, down 42s" with its downtime during the session,
+// or is empty if no recent scrape failed.
+func (m model) healthStatus() string {
+	i, target, health, ok := m.fetcher.flakiest()
+	if !ok {
+		return ""
+	}
+	status := fmt.Sprintf("%s %d/%d", health, health.failures(), len(health))
+	if downtime := m.fetcher.totalDowntime(i, time.Now()); downtime >= time.Second {
+		status += fmt.Sprintf(", down %s", downtime.Round(time.Second))
+	}
+	if len(m.fetcher.targets) > 1 {
+		status = instanceOf(target.URL) + " " + status
+	}
+	return status
+}
+
+// logRecovered logs the outages of the targets which came back with the last
+// scrape to the events panel and notes the last in the footer. It returns
+// whether any target came back.
+func (m *model) logRecovered() bool {
+	recovered := m.fetcher.takeRecovered()
+	for _, o := range recovered {
+		instance := instanceOf(o.target.URL)
+		downtime := o.duration().Round(time.Second)
+		m.logEvent(fmt.Sprintf("%s down %s-%s (%s)", instance, o.start.Format("15:04:05"), o.end.Format("15:04:05"), downtime), true)
+		m.notice = fmt.Sprintf("%s reconnected after %s", instance, downtime)
+	}
+	return len(recovered) > 0
+}
+
+// scrapeStatusMarker returns the marker appended to the header of the history
+// column age scrapes before the last one: a red dot if the scrape failed and
+// a yellow half dot if some targets failed and a pause sign for the gap of a
+// pause. Missing values in a column without marker are due to the series
+// being absent.
+func (m model) scrapeStatusMarker(age int) string {
+	status, ok := m.store.ScrapeStatus(age)
+	if !ok {
+		return ""
+	}
+	switch status {
+	case scrapeFailed:
+		return lipgloss.NewStyle().Foreground(color("196")).Render("●")
+	case scrapePartial:
+		return lipgloss.NewStyle().Foreground(color("220")).Render("◐")
+	case scrapePaused:
+		return lipgloss.NewStyle().Foreground(color("39")).Render("⏸")
+	}
+	return ""
+}
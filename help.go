@@ -0,0 +1,325 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// helpEntry is a key, or keys, and what it does.
+type helpEntry struct {
+	keys string
+	text string
+}
+
+type helpSection struct {
+	title   string
+	entries []helpEntry
+}
+
+// builtinKeys is the keymap without the -view and -bind keys, by category.
+var builtinKeys = []helpSection{
+	{"General", []helpEntry{
+		{"q/ctrl+c", "Quit"},
+		{"?", "Toggle this help (/ to search)"},
+		{"p", "Pause/unpause updates"},
+		{"R", "Reload -config file (also on SIGHUP)"},
+		{"T", "Edit targets (add, remove or change -url values)"},
+		{"G", "Write session report (-report file or timestamped .md)"},
+	}},
+	{"Navigation", []helpEntry{
+		{"↑/↓ j/k", "Move selection up/down"},
+		{"PgUp/PgDn", "Page up/down"},
+		{"Home/End", "Go to top/bottom"},
+		{"g", "Go to metric by name"},
+		{"n/N", "Next/previous goto match"},
+	}},
+	{"Display", []helpEntry{
+		{"l", "Cycle label display mode"},
+		{"c", "Toggle compact display density"},
+		{"u", "Toggle human-readable units"},
+		{"U", "Toggle unit row below the column titles"},
+		{"e", "Toggle quoted/escaped UTF-8 names"},
+		{"b", "Cycle trend graphs (off/braille/compact only)"},
+		{"t", "Toggle totals row"},
+		{"a", "Toggle series age column"},
+		{"M", "Toggle window min/max markers"},
+		{"B", "Toggle bars for bounded gauges"},
+		{"v", "Toggle derived avg/count rate rows"},
+		{"f", "Cycle aggregate rows across targets (off/sum/avg)"},
+		{"K", "Collapse/expand family of selected series to its aggregate rows"},
+		{"o", "Toggle sort by name/age (youngest first)"},
+		{"s", "Cycle stripes (off/rows/columns)"},
+		{"x", "Toggle missing metrics (absent from the last scrape)"},
+		{"1-9/0", "Switch to view preset (-view) or back"},
+	}},
+	{"History and deltas", []helpEntry{
+		{"d", "Cycle delta mode (off/next/view/ref)"},
+		{"r", "Deltas from the newest sample (ref delta mode)"},
+		{"</>", "Move the reference of the ref delta mode older/newer"},
+		{"[/]", "Fewer/more samples per history column"},
+		{"A", "Cycle column aggregation (last/min/max/mean)"},
+	}},
+	{"Panels", []helpEntry{
+		{"E", "Toggle events panel"},
+		{"L", "Toggle rules panel (-rules)"},
+		{"tab", "Select rules on the panel: s to silence (15m/1h/4h/off), a to acknowledge"},
+		{"!", "Go to the next row behind the most severe firing alerts"},
+		{"C", "Toggle cardinality explorer (o sorts by series/name)"},
+		{"S", "Take snapshot A, then B and compare them"},
+		{"D", "Toggle snapshot comparison (o sorts by absolute/percent change)"},
+	}},
+	{"Selected series", []helpEntry{
+		{"i/enter", "Show all labels of selected series, wrapped (follows the selection)"},
+		{"I", "Inspect samples of selected series at full precision (←/→ older/newer)"},
+		{"z", "Zoom selected series (fast polling)"},
+		{"y", "Copy PromQL for selected series"},
+		{"m", "Edit note on selected series"},
+	}},
+	{"Marked series", []helpEntry{
+		{"space", "Mark/unmark row for bulk actions (esc clears marks)"},
+		{"P", "Pin/unpin marked (or selected) series at the top"},
+		{"H", "Hide marked (or selected) series, or show hidden again"},
+		{"W", "Write history of marked (or selected) series to a CSV file"},
+		{"Y", "Copy marked (or selected) series with current values"},
+		{"F", "Annotate the history window in Grafana (-grafana-url)"},
+	}},
+}
+
+// keymap returns the active keymap: the builtin keys and those of the -view
+// presets and -bind bindings.
+func keymap(views []viewPreset, bindings []binding) []helpSection {
+	sections := builtinKeys
+	if len(views) > 0 {
+		section := helpSection{title: "Views (-view)"}
+		for i, v := range views {
+			section.entries = append(section.entries, helpEntry{strconv.Itoa(i + 1), v.name})
+		}
+		sections = append(sections[:len(sections):len(sections)], section)
+	}
+	if len(bindings) > 0 {
+		section := helpSection{title: "Key bindings (-bind)"}
+		for _, b := range bindings {
+			section.entries = append(section.entries, helpEntry{b.key, truncateMessage(b.command, 50)})
+		}
+		sections = append(sections[:len(sections):len(sections)], section)
+	}
+	return sections
+}
+
+// filterHelp returns the entries whose keys or text contain the query,
+// ignoring case. All entries of a section whose title matches are kept.
+func filterHelp(sections []helpSection, query string) []helpSection {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return sections
+	}
+	var res []helpSection
+	for _, section := range sections {
+		if strings.Contains(strings.ToLower(section.title), query) {
+			res = append(res, section)
+			continue
+		}
+		filtered := helpSection{title: section.title}
+		for _, e := range section.entries {
+			if strings.Contains(strings.ToLower(e.keys), query) || strings.Contains(strings.ToLower(e.text), query) {
+				filtered.entries = append(filtered.entries, e)
+			}
+		}
+		if len(filtered.entries) > 0 {
+			res = append(res, filtered)
+		}
+	}
+	return res
+}
+
+// helpLines formats the sections, each title followed by its keys, with
+// blank lines in between. Titles are rendered with titleStyle.
+func helpLines(sections []helpSection, titleStyle lipgloss.Style) []string {
+	var lines []string
+	for i, section := range sections {
+		if i > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, titleStyle.Render(section.title))
+		for _, e := range section.entries {
+			lines = append(lines, fmt.Sprintf("  %-11s %s", e.keys, e.text))
+		}
+	}
+	return lines
+}
+
+// writeCheatSheet writes the keymap as plain text, see -keys.
+func writeCheatSheet(w io.Writer, sections []helpSection) error {
+	_, err := io.WriteString(w, strings.Join(helpLines(sections, lipgloss.NewStyle()), "\n")+"\n")
+	return err
+}
+
+// printKeys prints the keymap of cfg to stdout, see -keys, and returns the
+// exit code.
+func printKeys(cfg Config) int {
+	views, err := loadViews(cfg)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	bindings, err := parseBindings(cfg.Bindings)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if err := writeCheatSheet(os.Stdout, keymap(views, bindings)); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// helpView is the state of the help overlay.
+type helpView struct {
+	search    textinput.Model
+	searching bool // Typing into search
+	offset    int  // First line shown
+}
+
+// toggleHelp opens or closes the help overlay.
+func (m model) toggleHelp() model {
+	if m.help != nil {
+		m.help = nil
+		return m
+	}
+	search := textinput.New()
+	search.Prompt = "/"
+	search.Placeholder = "search keys"
+	m.help = &helpView{search: search}
+	return m
+}
+
+// updateHelp handles keys while the help overlay is open.
+func (m model) updateHelp(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	h := m.help
+	if h.searching {
+		switch msg.String() {
+		case "enter":
+			h.searching = false
+			h.search.Blur()
+			return m, nil
+		case "esc":
+			h.searching = false
+			h.search.Blur()
+			h.search.SetValue("")
+			h.offset = 0
+			return m, nil
+		}
+		var cmd tea.Cmd
+		h.search, cmd = h.search.Update(msg)
+		h.offset = 0
+		return m, cmd
+	}
+
+	window, total := m.helpWindow()
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return m, tea.Quit
+	case "?":
+		return m.toggleHelp(), nil
+	case "esc":
+		if h.search.Value() != "" {
+			h.search.SetValue("")
+			h.offset = 0
+			return m, nil
+		}
+		return m.toggleHelp(), nil
+	case "/":
+		h.searching = true
+		return m, h.search.Focus()
+	case "up", "k":
+		h.offset--
+	case "down", "j":
+		h.offset++
+	case "pgup":
+		h.offset -= window
+	case "pgdown", " ":
+		h.offset += window
+	case "home":
+		h.offset = 0
+	case "end":
+		h.offset = total
+	}
+	h.offset = max(min(h.offset, total-window), 0)
+	return m, nil
+}
+
+// helpLinesShown returns the lines of the keymap matching the search.
+func (m model) helpLinesShown() []string {
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(color("63"))
+	return helpLines(filterHelp(keymap(m.views, m.bindings), m.help.search.Value()), titleStyle)
+}
+
+// helpChromeLines is the number of lines of the help box besides the keys:
+// border, padding, the title and search lines and the hint below a blank
+// line on either side.
+const helpChromeLines = 9
+
+// helpWindow returns the number of keymap lines fitting in the overlay and
+// the number of lines matching the search.
+func (m model) helpWindow() (int, int) {
+	return max(m.height-helpChromeLines, 1), len(m.helpLinesShown())
+}
+
+func (m model) renderHelpOverlay(content string) string {
+	h := m.help
+	lines := m.helpLinesShown()
+	window, total := m.helpWindow()
+	offset := max(min(h.offset, total-window), 0)
+	shown := lines[offset:min(offset+window, total)]
+	if total == 0 {
+		shown = []string{"No keys match"}
+	}
+	for i, line := range shown {
+		// Within the border and padding
+		shown[i] = ansi.Truncate(line, max(m.width-6, 20), "…")
+	}
+
+	title := "Help"
+	if total > window {
+		title = fmt.Sprintf("Help (%d-%d of %d lines)", offset+1, offset+len(shown), total)
+	}
+	search := h.search.View()
+	if !h.searching && h.search.Value() == "" {
+		search = m.labelStyle.Render("/ to search")
+	}
+	hint := "↑/↓ PgUp/PgDn to scroll, esc or ? to close"
+	if h.searching {
+		hint = "enter to keep the search, esc to clear it"
+	}
+	body := title + "\n" + search + "\n\n" + strings.Join(shown, "\n") + "\n\n" + m.labelStyle.Render(hint)
+
+	// Create a styled box for the help
+	helpStyle := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(color("63")).
+		Padding(1, 2).
+		Background(color("235")).
+		Foreground(color("252"))
+
+	helpBox := helpStyle.Render(body)
+
+	// Overlay the help on top of content using Place
+	return lipgloss.Place(
+		m.width,
+		m.height,
+		lipgloss.Center,
+		lipgloss.Center,
+		helpBox,
+		lipgloss.WithWhitespaceChars(" "),
+		lipgloss.WithWhitespaceForeground(color("0")),
+	)
+}
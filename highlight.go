@@ -0,0 +1,75 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// compileMetricFilter compiles the metric filter regex once for matching
+// and highlighting all rows. It returns nil for no filter, or an invalid one
+// which Config.validate rejects.
+func compileMetricFilter(filter string) *regexp.Regexp {
+	if filter == "" {
+		return nil
+	}
+	re, _ := regexp.Compile(filter)
+	return re
+}
+
+// matchRanges returns the byte ranges of a displayed metric name matched by
+// the metric filter regex or the goto query, sorted and merged.
+func (m model) matchRanges(name string) [][2]int {
+	var ranges [][2]int
+	if m.metricFilter != nil {
+		for _, loc := range m.metricFilter.FindAllStringIndex(name, -1) {
+			if loc[1] > loc[0] {
+				ranges = append(ranges, [2]int{loc[0], loc[1]})
+			}
+		}
+	}
+	if m.gotoQuery != "" {
+		for start := 0; ; {
+			i := strings.Index(name[start:], m.gotoQuery)
+			if i < 0 {
+				break
+			}
+			ranges = append(ranges, [2]int{start + i, start + i + len(m.gotoQuery)})
+			start += i + len(m.gotoQuery)
+		}
+	}
+	slices.SortFunc(ranges, func(a, b [2]int) int { return a[0] - b[0] })
+	merged := ranges[:0]
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && r[0] <= merged[n-1][1] {
+			merged[n-1][1] = max(merged[n-1][1], r[1])
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// renderMatches renders a metric name with the parts matched by the active
+// filter or search highlighted, so it is obvious why a row matched.
+func (m model) renderMatches(name string, style lipgloss.Style) string {
+	ranges := m.matchRanges(name)
+	if len(ranges) == 0 {
+		return style.Render(name)
+	}
+	var b strings.Builder
+	pos := 0
+	for _, r := range ranges {
+		if r[0] > pos {
+			b.WriteString(style.Render(name[pos:r[0]]))
+		}
+		b.WriteString(m.matchStyle.Inherit(style).Render(name[r[0]:r[1]]))
+		pos = r[1]
+	}
+	if pos < len(name) {
+		b.WriteString(style.Render(name[pos:]))
+	}
+	return b.String()
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	dto "github.com/prometheus/client_model/go"
+	promModel "github.com/prometheus/common/model"
+)
+
+// flattenFamilies replaces histograms and summaries by their classic series
+// (_bucket, _sum, _count and quantiles), which are then shown like any other
+// counter or gauge. The le and quantile label values of all series are
+// normalized, so exporters formatting them inconsistently (1 vs 1.0) don't
+// split a bucket into several rows.
+func flattenFamilies(families map[string]*dto.MetricFamily) map[string]*dto.MetricFamily {
+	res := make(map[string]*dto.MetricFamily, len(families))
+	add := func(name string, kind dto.MetricType, unit string, family *dto.MetricFamily, metric *dto.Metric) {
+		f, ok := res[name]
+		if !ok {
+			f = &dto.MetricFamily{Name: &name, Help: family.Help, Type: kind.Enum()}
+			if unit != "" {
+				f.Unit = &unit
+			}
+			res[name] = f
+		}
+		f.Metric = append(f.Metric, metric)
+	}
+
+	for name, family := range families {
+		unit := inferUnit(name, family.GetUnit())
+		switch family.GetType() {
+		case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+			kind := dto.MetricType_COUNTER
+			if family.GetType() == dto.MetricType_GAUGE_HISTOGRAM {
+				kind = dto.MetricType_GAUGE
+			}
+			for _, m := range family.GetMetric() {
+				h := m.GetHistogram()
+				hasInf := false
+				for _, b := range h.GetBucket() {
+					hasInf = hasInf || math.IsInf(b.GetUpperBound(), 1)
+					add(name+"_bucket", kind, "", family, derivedMetric(m, kind, promModel.BucketLabel, formatBound(b.GetUpperBound()), float64(b.GetCumulativeCount())))
+				}
+				if !hasInf {
+					add(name+"_bucket", kind, "", family, derivedMetric(m, kind, promModel.BucketLabel, "+Inf", float64(h.GetSampleCount())))
+				}
+				add(name+"_sum", kind, unit, family, derivedMetric(m, kind, "", "", h.GetSampleSum()))
+				add(name+"_count", kind, "", family, derivedMetric(m, kind, "", "", float64(h.GetSampleCount())))
+			}
+		case dto.MetricType_SUMMARY:
+			for _, m := range family.GetMetric() {
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add(name, dto.MetricType_GAUGE, unit, family, derivedMetric(m, dto.MetricType_GAUGE, promModel.QuantileLabel, formatBound(q.GetQuantile()), q.GetValue()))
+				}
+				add(name+"_sum", dto.MetricType_COUNTER, unit, family, derivedMetric(m, dto.MetricType_COUNTER, "", "", s.GetSampleSum()))
+				add(name+"_count", dto.MetricType_COUNTER, "", family, derivedMetric(m, dto.MetricType_COUNTER, "", "", float64(s.GetSampleCount())))
+			}
+		default:
+			for _, m := range family.GetMetric() {
+				normalizeBoundLabels(m)
+			}
+			if existing, ok := res[name]; ok {
+				// Classic series exposed without a TYPE next to a flattened family
+				existing.Metric = append(existing.Metric, family.GetMetric()...)
+			} else {
+				res[name] = family
+			}
+		}
+	}
+	return res
+}
+
+// derivedMetric returns a counter or gauge sample with the labels and
+// timestamp of m, plus an extra label if name is not empty.
+func derivedMetric(m *dto.Metric, kind dto.MetricType, name, value string, v float64) *dto.Metric {
+	labels := m.GetLabel()
+	if name != "" {
+		labels = append(labels[:len(labels):len(labels)], &dto.LabelPair{Name: &name, Value: &value})
+	}
+	res := &dto.Metric{Label: labels, TimestampMs: m.TimestampMs}
+	if kind == dto.MetricType_COUNTER {
+		res.Counter = &dto.Counter{Value: &v}
+	} else {
+		res.Gauge = &dto.Gauge{Value: &v}
+	}
+	return res
+}
+
+// normalizeBoundLabels rewrites numeric le and quantile label values in their
+// canonical form.
+func normalizeBoundLabels(m *dto.Metric) {
+	for _, l := range m.GetLabel() {
+		if l.GetName() != promModel.BucketLabel && l.GetName() != promModel.QuantileLabel {
+			continue
+		}
+		if v, err := strconv.ParseFloat(l.GetValue(), 64); err == nil {
+			normalized := formatBound(v)
+			l.Value = &normalized
+		}
+	}
+}
+
+// formatBound formats a bucket bound or quantile as Prometheus does, e.g. 1,
+// 0.25 or +Inf.
+func formatBound(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	if math.IsInf(v, -1) {
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// boundSortKey returns a string which sorts like the numeric value of a bound
+// label, or the label value if it is not a number.
+func boundSortKey(value string) string {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return value
+	}
+	bits := math.Float64bits(v)
+	if v >= 0 {
+		bits ^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return fmt.Sprintf("%016x", bits)
+}
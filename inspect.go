@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// inspectView is the state of the value inspection popup, which shows a
+// sample of the selected series at full precision.
+type inspectView struct {
+	age int // Scrapes before the last one
+}
+
+// toggleInspect opens or closes the inspection of the newest sample of the
+// selected series.
+func (m model) toggleInspect() model {
+	if m.inspect != nil {
+		m.inspect = nil
+		return m
+	}
+	if m.selectedSeries() == nil {
+		m.notice = "No series selected"
+		return m
+	}
+	m.inspect = &inspectView{}
+	return m
+}
+
+// updateInspect handles keys while the inspection is open: left and right
+// move to older and newer samples, up and down change the selected series.
+func (m model) updateInspect(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return m, tea.Quit
+	case "I", "esc":
+		return m.toggleInspect(), nil
+	case "left", "h":
+		m.inspect.age++
+	case "right", "l":
+		m.inspect.age--
+	case "home":
+		m.inspect.age = 0
+	case "up", "k":
+		m.moveCursor(-1)
+	case "down", "j":
+		m.moveCursor(1)
+	}
+	if series := m.selectedSeries(); series != nil {
+		m.inspect.age = max(min(m.inspect.age, len(series.Values)-1), 0)
+	}
+	return m, nil
+}
+
+// formatExact formats a value with as many digits as needed to tell it from
+// any other float64.
+func formatExact(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// expositionLine returns the sample as a line of the Prometheus text format,
+// with the exposition timestamp if any. Values are formatted as the client
+// libraries do, so it matches the scraped line unless the target wrote a
+// non-canonical number.
+func expositionLine(series *MetricSeries, value float64, timestamp int64) string {
+	line := strings.TrimSuffix(series.signature(), "{}") + " "
+	switch {
+	case math.IsInf(value, 1):
+		line += "+Inf"
+	case math.IsInf(value, -1):
+		line += "-Inf"
+	default:
+		line += formatExact(value)
+	}
+	if timestamp != 0 {
+		line += " " + strconv.FormatInt(timestamp, 10)
+	}
+	return line
+}
+
+// renderInspectOverlay shows a sample of the selected series at full
+// precision with the change from the previous sample, the time of its
+// scrape and the exposition line, as the table rounds values.
+func (m model) renderInspectOverlay(content string) string {
+	series := m.selectedSeries()
+	if series == nil {
+		return content
+	}
+	age := max(min(m.inspect.age, len(series.Values)-1), 0)
+
+	field := func(name, value string) string {
+		return m.labelStyle.Render(fmt.Sprintf("%-10s", name)) + " " + value
+	}
+	var lines []string
+	if len(series.Values) == 0 {
+		lines = append(lines, m.labelStyle.Render("No samples"))
+	} else {
+		i := len(series.Values) - 1 - age
+		value := series.Values[i]
+		if math.IsNaN(value) {
+			lines = append(lines, field("Value", m.labelStyle.Render("missing")))
+		} else {
+			lines = append(lines, field("Value", m.currentValueStyle.Render(formatExact(value))))
+			lines = append(lines, field("Shown as", m.formatValue(series.Unit, value)))
+		}
+		if i > 0 && !math.IsNaN(value) && !math.IsNaN(series.Values[i-1]) {
+			prev := series.Values[i-1]
+			lines = append(lines, field("Previous", formatExact(prev)))
+			change := formatExact(value - prev)
+			if value >= prev {
+				change = "+" + change
+			}
+			lines = append(lines, field("Change", change))
+		}
+
+		scraped := m.labelStyle.Render("unknown")
+		if j := len(m.store.times) - 1 - age; j >= 0 {
+			scraped = m.store.times[j].Format("2006-01-02 15:04:05.000")
+			if status, ok := m.store.ScrapeStatus(age); ok && status != scrapeOK {
+				scraped += " " + m.scrapeStatusMarker(age)
+			}
+		}
+		lines = append(lines, field("Scraped", scraped))
+
+		// The exposition timestamp is only kept for the newest sample
+		var timestamp int64
+		if age == 0 && series.Timestamp != 0 {
+			timestamp = series.Timestamp
+			lines = append(lines, field("Timestamp", fmt.Sprintf("%d (%s)", timestamp, time.UnixMilli(timestamp).Format("2006-01-02 15:04:05.000"))))
+		}
+		if !math.IsNaN(value) {
+			lines = append(lines, "", m.labelStyle.Render("Exposition"), expositionLine(series, value, timestamp))
+		}
+	}
+	// Within a margin, the border and the padding
+	width := max(m.width-10, 20)
+	for i, line := range lines {
+		lines[i] = ansi.Truncate(line, width, "…")
+	}
+
+	sample := "newest sample"
+	if age > 0 {
+		sample = fmt.Sprintf("%d sample(s) before the newest", age)
+	}
+	title := ansi.Truncate(m.metricNameStyle.Render(displayName(series.Name, false, m.cfg.EscapedNames))+
+		m.labelStyle.Render(fmt.Sprintf(" (%s of %d)", sample, len(series.Values))), width, "…")
+	hint := m.labelStyle.Render("←/→ older/newer sample, ↑/↓ to follow the selection, I or esc to close")
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(color("63")).
+		Padding(1, 2).
+		Render(title + "\n\n" + strings.Join(lines, "\n") + "\n\n" + ansi.Truncate(hint, width, "…"))
+
+	return lipgloss.Place(
+		m.width,
+		m.height,
+		lipgloss.Center,
+		lipgloss.Center,
+		box,
+		lipgloss.WithWhitespaceChars(" "),
+		lipgloss.WithWhitespaceForeground(color("0")),
+	)
+}
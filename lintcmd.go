@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/common/expfmt"
+	promModel "github.com/prometheus/common/model"
+)
+
+// lintFamily collects what the linter has seen of one metric family.
+type lintFamily struct {
+	line       int // First line the family was seen on
+	help       bool
+	typ        string
+	series     int
+	labelSets  map[string]int // Sorted label keys -> first line seen
+	labelVals  map[string]map[string]bool
+	sampleName string
+}
+
+// lintIssue is a single finding, reported with the exposition line number.
+type lintIssue struct {
+	line int
+	msg  string
+}
+
+// lintSuffixes are the sample name suffixes which belong to a typed family
+// named without them.
+var lintSuffixes = []string{"_bucket", "_sum", "_count", "_created", "_total", "_info", "_gcount", "_gsum"}
+
+// runLint implements the `lint <url>` command. It returns the exit code: 0
+// if no issues were found, 1 if there were issues and 2 on errors.
+func runLint(args []string, w io.Writer) int {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	maxSeries := fs.Int("max-series", 1000, "Report metrics with more series than this")
+	maxLabelValues := fs.Int("max-label-values", 100, "Report labels with more distinct values than this within a metric")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s lint [flags] <url>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	body, err := NewFetcher(fs.Arg(0)).FetchRaw()
+	if err != nil {
+		fmt.Fprintf(w, "Error: %v\n", err)
+		return 2
+	}
+
+	issues := lintExposition(body, *maxSeries, *maxLabelValues)
+	for _, issue := range issues {
+		if issue.line > 0 {
+			fmt.Fprintf(w, "%d: %s\n", issue.line, issue.msg)
+		} else {
+			fmt.Fprintln(w, issue.msg)
+		}
+	}
+	if len(issues) > 0 {
+		fmt.Fprintf(w, "%d issue(s) found\n", len(issues))
+		return 1
+	}
+	fmt.Fprintln(w, "No issues found")
+	return 0
+}
+
+// lintExposition checks a text exposition for spec violations and smells.
+func lintExposition(body []byte, maxSeries, maxLabelValues int) []lintIssue {
+	var issues []lintIssue
+	report := func(line int, format string, args ...any) {
+		issues = append(issues, lintIssue{line: line, msg: fmt.Sprintf(format, args...)})
+	}
+
+	// Let the upstream parser report syntax errors first
+	parser := expfmt.NewTextParser(promModel.UTF8Validation)
+	if _, err := parser.TextToMetricFamilies(bytes.NewReader(body)); err != nil {
+		report(0, "parse error: %v", err)
+	}
+
+	families := make(map[string]*lintFamily)
+	var order []string
+	family := func(name string, line int) *lintFamily {
+		f, ok := families[name]
+		if !ok {
+			f = &lintFamily{line: line, labelSets: make(map[string]int), labelVals: make(map[string]map[string]bool)}
+			families[name] = f
+			order = append(order, name)
+		}
+		return f
+	}
+	seen := make(map[string]int)
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, 1<<20)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 3 && (fields[1] == "HELP" || fields[1] == "TYPE") {
+				f := family(fields[2], lineNo)
+				if fields[1] == "HELP" {
+					f.help = true
+				} else if len(fields) >= 4 {
+					f.typ = fields[3]
+				}
+			}
+			continue
+		}
+
+		name, labels, keys, err := lintParseSample(line)
+		if err != nil {
+			report(lineNo, "%v", err)
+			continue
+		}
+
+		// Attribute the sample to its typed family, e.g. foo_bucket -> foo
+		famName := name
+		if _, ok := families[name]; !ok {
+			for _, suffix := range lintSuffixes {
+				base := strings.TrimSuffix(name, suffix)
+				if f, ok := families[base]; ok && base != name && f.typ != "" {
+					famName = base
+					break
+				}
+			}
+		}
+		f := family(famName, lineNo)
+
+		sig := GenerateSignature(name, labels)
+		if first, dup := seen[sig]; dup {
+			report(lineNo, "duplicate series %s (first on line %d)", sig, first)
+			continue
+		}
+		seen[sig] = lineNo
+		f.series++
+
+		// Bucket and quantile labels are expected to vary
+		var setKeys []string
+		for _, k := range keys {
+			if k != "le" && k != "quantile" {
+				setKeys = append(setKeys, k)
+			}
+		}
+		sort.Strings(setKeys)
+		set := strings.Join(setKeys, ",")
+		if len(f.labelSets) > 0 {
+			if _, ok := f.labelSets[set]; !ok {
+				report(lineNo, "inconsistent label set for %s: {%s}", famName, set)
+			}
+		}
+		if _, ok := f.labelSets[set]; !ok {
+			f.labelSets[set] = lineNo
+		}
+		for k, v := range labels {
+			if f.labelVals[k] == nil {
+				f.labelVals[k] = make(map[string]bool)
+			}
+			f.labelVals[k][v] = true
+		}
+		if f.sampleName == "" {
+			f.sampleName = name
+		}
+	}
+
+	for _, name := range order {
+		f := families[name]
+		if f.series == 0 {
+			continue
+		}
+		if !f.help {
+			report(f.line, "missing HELP for %s", name)
+		}
+		if f.typ == "" {
+			report(f.line, "missing TYPE for %s", name)
+		}
+		if f.typ == "counter" && !strings.HasSuffix(f.sampleName, "_total") {
+			report(f.line, "counter %s should have a _total suffix", name)
+		}
+		if f.series > maxSeries {
+			report(f.line, "high cardinality: %s has %d series", name, f.series)
+		}
+		for k, vals := range f.labelVals {
+			if len(vals) > maxLabelValues && k != "le" && k != "quantile" {
+				report(f.line, "high cardinality: label %s of %s has %d values", k, name, len(vals))
+			}
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].line < issues[j].line
+	})
+	return issues
+}
+
+// lintParseSample splits a sample line into metric name and labels, checking
+// label value escaping. Keys are returned in exposition order.
+func lintParseSample(line string) (string, map[string]string, []string, error) {
+	end := strings.IndexAny(line, "{ ")
+	if end == -1 {
+		return "", nil, nil, fmt.Errorf("sample without value: %q", line)
+	}
+	name := line[:end]
+	labels := make(map[string]string)
+	var keys []string
+	if line[end] != '{' {
+		return name, labels, keys, nil
+	}
+
+	rest := line[end+1:]
+	for {
+		rest = strings.TrimLeft(rest, " ,")
+		if strings.HasPrefix(rest, "}") {
+			return name, labels, keys, nil
+		}
+		eq := strings.Index(rest, "=")
+		if eq <= 0 || len(rest) < eq+2 || rest[eq+1] != '"' {
+			return "", nil, nil, fmt.Errorf("malformed labels in %q", line)
+		}
+		key := strings.TrimSpace(rest[:eq])
+		rest = rest[eq+2:]
+
+		var value strings.Builder
+		closed := false
+		for i := 0; i < len(rest); i++ {
+			ch := rest[i]
+			if ch == '\\' {
+				if i+1 >= len(rest) {
+					break
+				}
+				switch rest[i+1] {
+				case '\\':
+					value.WriteByte('\\')
+				case '"':
+					value.WriteByte('"')
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					return "", nil, nil, fmt.Errorf("invalid escape sequence \\%c in label %s of %s", rest[i+1], key, name)
+				}
+				i++
+				continue
+			}
+			if ch == '"' {
+				rest = rest[i+1:]
+				closed = true
+				break
+			}
+			value.WriteByte(ch)
+		}
+		if !closed {
+			return "", nil, nil, fmt.Errorf("unterminated label value in %q", line)
+		}
+		labels[key] = value.String()
+		keys = append(keys, key)
+	}
+}
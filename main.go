@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"math"
 	"os"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
+	"text/template"
 	"time"
 
+	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -22,6 +27,13 @@ const (
 	DeltaModeOff  = "off"
 	DeltaModeNext = "next"
 	DeltaModeView = "view"
+	DeltaModeRef  = "ref" // Differences from a reference sample, see refAge
+)
+
+// Density constants
+const (
+	DensityNormal  = "normal"
+	DensityCompact = "compact"
 )
 
 // Label mode constants
@@ -33,87 +45,479 @@ const (
 
 // Config holds the command line arguments
 type Config struct {
-	URL          string
-	Interval     time.Duration
-	History      int
-	LabelMode    string
-	FilterMetric string
-	FilterLabel  string
-	DeltaMode    string
+	URL               string // Summary of the targets for display
+	URLs              stringList
+	Stagger           bool
+	Format            string
+	Interval          time.Duration
+	History           int
+	LabelMode         string
+	FilterMetric      string
+	FilterLabel       string
+	Select            string
+	DeltaMode         string
+	Density           string
+	HumanUnits        bool
+	UnitRow           bool
+	ShowTotals        bool
+	StripeMode        string
+	Monochrome        bool
+	NoTUI             bool
+	Keys              bool
+	PlainFormat       string
+	Asserts           stringList
+	Duration          time.Duration
+	Export            string
+	Baseline          string
+	HighlightNew      int
+	ShowAge           bool
+	MinMax            bool
+	Bars              bool
+	Derived           bool
+	ColumnWindow      int
+	ColumnAgg         string
+	Aggregate         string
+	Views             stringList
+	Bindings          stringList
+	PromConfig        string
+	PromJob           string
+	targetAuth        map[string]string // Auth of targets by URL, from -prom-config
+	ShowMissing       bool
+	Report            string
+	Bounds            stringList
+	SLOs              stringList
+	SLOWindow         time.Duration
+	Drop              stringList
+	Transforms        stringList
+	SortMode          string
+	ConfigFile        string
+	MaxMemory         byteSize
+	Pprof             string
+	UseTimestamps     bool
+	EscapedNames      bool
+	GraphMode         string
+	RemoteWriteURL    string
+	SQLite            string
+	Sinks             stringList
+	Serve             string
+	Share             string
+	GrafanaURL        string
+	GrafanaTokenFile  string
+	GrafanaDashboard  string
+	GrafanaTags       stringList
+	Rules             stringList
+	Title             string
+	ZoomInterval      time.Duration
+	UnfocusedInterval time.Duration
+	GRPCHealth        string
+	GRPCHealthService string
+	GRPCHealthTLS     bool
+	ZoomHistory       int
 }
 
 type model struct {
 	cfg                 Config
 	store               *Store
-	fetcher             *Fetcher
+	fetcher             *Scraper
+	targetErr           error // Set when only some targets failed the last scrape
+	grpcHealth          *grpcHealth
+	grpcStatus          *grpcHealthMsg  // Last gRPC health check, nil before the first
+	ctx                 context.Context // Canceled when the program exits
+	fetches             *inflight
+	selector            *selector
+	metricFilter        *regexp.Regexp // Compiled -filter-metric, nil for none
+	labelFilter         *selector      // Compiled -filter-label, see compileLabelFilter
+	labelRegex          *regexp.Regexp // Compiled deprecated -filter-label regex
+	seriesOrder         *seriesOrder
+	baseline            map[string]float64 // Values by signature from -baseline
+	bounds              []gaugeBound
+	reload              chan os.Signal // Receives SIGHUP to reload -config
+	sinks               *sinkSet
+	failedSinks         []string          // Kinds of sinks whose last write failed
+	queries             []string          // PromQL queries copied with y, printed on exit
+	notice              string            // Shown in the footer until the next key press
+	notes               map[string]string // Notes on series by signature, see startNote
+	started             time.Time
+	views               []viewPreset
+	bindings            []binding
+	view                int       // Active view, 1-based, 0 for none
+	baseCfg             Config    // Settings views are applied to
+	marked              seriesSet // Rows marked for bulk actions
+	pinned              seriesSet // Shown at the top of the table
+	hidden              seriesSet
+	collapsed           map[string]bool // Families shown by their aggregate rows only, see toggleCollapsed
+	events              []event
+	showEvents          bool
+	web                 *webView
+	share               *shareSession
+	grafana             *grafanaAnnotator
+	rules               *ruleSet // From -rules, nil without
+	showRules           bool
+	rulesFocused        bool         // Keys go to the rules panel, see updateRules
+	selectedRule        *rule        // On the rules panel
+	slos                []*slo       // Success ratios of -slo, shown above the footer
+	showLabels          bool         // Labels of the selected series in a popup
+	inspect             *inspectView // Full precision sample popup, nil when closed
+	colUnits            []columnUnit // Of the value columns in the unit row, set while building the table
+	titleTemplate       *template.Template
+	title               string
 	err                 error
 	connectionError     error
 	isConnected         bool
 	lastSuccessfulFetch time.Time
-	showHelp            bool
+	help                *helpView // Help overlay, nil when closed
 	isPaused            bool
+	unfocused           bool // Terminal lost focus, see pollInterval
+	tickGen             int
+	refScrape           uint64 // Scrape number of the reference of the ref delta mode, 0 for the oldest
 	width               int
 	height              int
 	viewport            viewport.Model
 	viewportReady       bool
+	tableHeader         string
+	renderedFrom        int
+	renderedTo          int
+	resizeGen           int
+	rowCache            *rowCache
+	aggregateCache      *aggregateCache
+	missingCache        *missingCache
+	cursor              int
+	zoom                *zoomState
+	zoomGen             int
+	gotoInput           textinput.Model
+	gotoActive          bool
+	gotoQuery           string
+	noteInput           textinput.Model
+	noteActive          bool
+	noteSig             string // Signature of the series whose note is edited
+	targetEdit          *targetEdit
+	cardinality         *cardinalityView // Open cardinality explorer, replacing the table
+	snapshotA           *snapshot        // Snapshots compared with S and D
+	snapshotB           *snapshot
+	compare             *compareView // Open snapshot comparison, replacing the table
 	metricNameStyle     lipgloss.Style
 	labelStyle          lipgloss.Style
 	currentValueStyle   lipgloss.Style
 	deltaValueStyle     lipgloss.Style
+	selectedStyle       lipgloss.Style
+	totalsStyle         lipgloss.Style
+	newSeriesStyle      lipgloss.Style
+	maxValueStyle       lipgloss.Style
+	matchStyle          lipgloss.Style // Parts of names matched by the filter or search
+	minValueStyle       lipgloss.Style
+}
+
+// tickMsg triggers a scrape. Ticks of an older generation than
+// model.tickGen were superseded and are dropped.
+type tickMsg struct {
+	gen int
 }
 
-type tickMsg time.Time
+// partialScrapeMsg is the result of a scrape in which only some targets failed.
+type partialScrapeMsg struct {
+	families map[string]*dto.MetricFamily
+	err      error
+}
+
+// tableHeaderLines returns the number of lines rendered above the first data
+// row (top border, header row and header separator in normal density, only the
+// header row in compact density). These are kept outside the viewport so the
+// header stays visible while scrolling.
+func (m model) tableHeaderLines() int {
+	lines := 3
+	if m.cfg.Density == DensityCompact {
+		lines = 1
+	}
+	if m.showUnitRow() {
+		lines++
+	}
+	return lines
+}
+
+// showUnitRow reports whether the table has a unit row below the column
+// titles, see columnUnits. The explorers replacing the table have none.
+func (m model) showUnitRow() bool {
+	return m.cfg.UnitRow && m.cardinality == nil && m.compare == nil
+}
 
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "diff":
+			os.Exit(runDiff(os.Args[2:], os.Stdout))
+		case "lint":
+			os.Exit(runLint(os.Args[2:], os.Stdout))
+		case "attach":
+			os.Exit(runAttach(os.Args[2:], os.Stdout))
+		}
+	}
+
 	cfg := parseFlags()
+	monochrome = cfg.Monochrome
+
+	if cfg.Keys {
+		os.Exit(printKeys(cfg))
+	}
 
 	if cfg.URL == "" {
-		fmt.Println("Error: -url argument is required")
+		fmt.Println("Error: -url, -pid, -textfile-dir or -prom-config argument is required")
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	// Validate regex
-	if _, err := regexp.Compile(cfg.FilterMetric); err != nil {
-		fmt.Printf("Error: invalid metric filter regex: %v\n", err)
-		os.Exit(1)
+	var sel *selector
+	if cfg.Select != "" {
+		var err error
+		if sel, err = parseSelector(cfg.Select); err != nil {
+			fmt.Printf("Error: invalid selector: %v\n", err)
+			os.Exit(1)
+		}
 	}
-	if _, err := regexp.Compile(cfg.FilterLabel); err != nil {
-		fmt.Printf("Error: invalid label filter regex: %v\n", err)
-		os.Exit(1)
+
+	if cfg.Pprof != "" {
+		if err := startPprof(cfg.Pprof); err != nil {
+			fmt.Printf("Error: cannot serve pprof: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
 	store := NewStore(cfg.History)
-	fetcher := NewFetcher(cfg.URL)
+	store.MaxBytes = int64(cfg.MaxMemory)
+	store.UseTimestamps = cfg.UseTimestamps
+	targets, _ := parseTargets(cfg.URLs) // Validated by parseFlags
+	fetcher := NewScraper(withAuth(targets, cfg.targetAuth))
+	drop, _ := parseDrop(cfg.Drop) // Validated by parseFlags
+	fetcher.SetDrop(drop)
+	fetcher.SetFormat(cfg.Format)
+	fetcher.SetTransforms(cfg.Transforms)
+	if cfg.Stagger {
+		fetcher.Stagger = cfg.Interval / 2
+	}
 
-	metricNameStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("86"))
+	metricNameStyle := lipgloss.NewStyle().Foreground(color("86"))
 	labelStyle := lipgloss.NewStyle().Faint(true)
-	currentValueStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("213")) // brighter magenta
-	deltaValueStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("208"))   // orange
+	currentValueStyle := lipgloss.NewStyle().Foreground(color("213")) // brighter magenta
+	deltaValueStyle := lipgloss.NewStyle().Foreground(color("208"))   // orange
+	selectedStyle := lipgloss.NewStyle().Reverse(true)
+	totalsStyle := lipgloss.NewStyle().Bold(true)
+	newSeriesStyle := lipgloss.NewStyle().Foreground(color("76")).Bold(true)      // green
+	maxValueStyle := lipgloss.NewStyle().Foreground(color("203")).Underline(true) // red
+	minValueStyle := lipgloss.NewStyle().Foreground(color("75")).Underline(true)  // blue
+	matchStyle := lipgloss.NewStyle().Foreground(color("220")).Underline(true)    // yellow
+
+	if cfg.Monochrome {
+		// Colors are disabled, convey emphasis with text attributes instead
+		currentValueStyle = currentValueStyle.Bold(true).Underline(true)
+		deltaValueStyle = deltaValueStyle.Bold(true)
+		minValueStyle = minValueStyle.Underline(false).Italic(true)
+	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	m := model{
 		cfg:               cfg,
 		store:             store,
 		fetcher:           fetcher,
+		ctx:               ctx,
+		selector:          sel,
+		metricFilter:      compileMetricFilter(cfg.FilterMetric),
+		seriesOrder:       &seriesOrder{},
+		fetches:           &inflight{},
+		rowCache:          newRowCache(),
+		aggregateCache:    newAggregateCache(),
+		missingCache:      &missingCache{},
+		started:           time.Now(),
+		notes:             make(map[string]string),
+		marked:            make(seriesSet),
+		pinned:            make(seriesSet),
+		hidden:            make(seriesSet),
+		collapsed:         make(map[string]bool),
 		width:             80,
 		height:            24,
 		metricNameStyle:   metricNameStyle,
 		labelStyle:        labelStyle,
 		currentValueStyle: currentValueStyle,
 		deltaValueStyle:   deltaValueStyle,
+		selectedStyle:     selectedStyle,
+		totalsStyle:       totalsStyle,
+		newSeriesStyle:    newSeriesStyle,
+		maxValueStyle:     maxValueStyle,
+		matchStyle:        matchStyle,
+		minValueStyle:     minValueStyle,
 	}
-
-	if _, err := tea.NewProgram(m).Run(); err != nil {
-		fmt.Printf("Error running program: %v\n", err)
+	m.labelFilter, m.labelRegex = compileLabelFilter(cfg.FilterLabel)
+	if cfg.RemoteWriteURL != "" {
+		cfg.Sinks = append(cfg.Sinks, "remote_write:"+cfg.RemoteWriteURL)
+	}
+	if cfg.SQLite != "" {
+		cfg.Sinks = append(cfg.Sinks, "sqlite:"+cfg.SQLite)
+	}
+	sinks, err := openSinks(cfg.Sinks)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	m.sinks = sinks
+	titleTemplate, err := parseTitleTemplate(cfg.Title)
+	if err != nil {
+		fmt.Printf("Error: invalid title template: %v\n", err)
+		os.Exit(1)
+	}
+	m.titleTemplate = titleTemplate
+	if m.bounds, err = parseBounds(cfg.Bounds); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if m.bindings, err = parseBindings(cfg.Bindings); err != nil {
+		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
+	m.slos, _ = parseSLOs(cfg.SLOs) // Validated by parseFlags
+	if cfg.GRPCHealth != "" {
+		if m.grpcHealth, err = newGRPCHealth(cfg.GRPCHealth, cfg.GRPCHealthService, cfg.GRPCHealthTLS); err != nil {
+			fmt.Printf("Error: cannot connect to gRPC health service: %v\n", err)
+			os.Exit(1)
+		}
+		defer m.grpcHealth.conn.Close()
+	}
+	if m.views, err = loadViews(cfg); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	m.baseCfg = cfg
+	if cfg.Baseline != "" {
+		baseline, err := loadBaseline(cfg.Baseline)
+		if err != nil {
+			fmt.Printf("Error: cannot load baseline: %v\n", err)
+			os.Exit(1)
+		}
+		m.baseline = baseline
+	}
+	if cfg.Serve != "" {
+		web, err := startWebView(cfg.Serve)
+		if err != nil {
+			fmt.Printf("Error: cannot serve web view: %v\n", err)
+			os.Exit(1)
+		}
+		m.web = web
+	}
+	if len(cfg.Rules) > 0 {
+		if m.rules, err = loadRules(cfg.Rules, time.Duration(cfg.History)*cfg.Interval); err != nil {
+			fmt.Printf("Error: cannot load rules: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if cfg.GrafanaURL != "" {
+		token := os.Getenv("GRAFANA_TOKEN")
+		if cfg.GrafanaTokenFile != "" {
+			data, err := os.ReadFile(cfg.GrafanaTokenFile)
+			if err != nil {
+				fmt.Printf("Error: cannot read Grafana token: %v\n", err)
+				os.Exit(1)
+			}
+			token = strings.TrimSpace(string(data))
+		}
+		m.grafana = newGrafanaAnnotator(cfg.GrafanaURL, token, cfg.GrafanaDashboard, cfg.GrafanaTags)
+	}
+	if cfg.Share != "" {
+		share, err := startShare(cfg.Share)
+		if err != nil {
+			fmt.Printf("Error: cannot share session: %v\n", err)
+			os.Exit(1)
+		}
+		defer share.Close()
+		m.share = share
+	}
+
+	if cfg.FilterLabel != "" && !strings.Contains(cfg.FilterLabel, "=") {
+		m.notice = "-filter-label without a label name is deprecated, use -select"
+	}
+
+	if len(cfg.Asserts) > 0 {
+		var assertions []*assertion
+		for _, expr := range cfg.Asserts {
+			a, err := parseAssertion(expr)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			assertions = append(assertions, a)
+		}
+		if cfg.Duration <= 0 {
+			fmt.Println("Error: -assert requires -for")
+			os.Exit(1)
+		}
+		os.Exit(runAssertions(m, assertions, os.Stderr))
+	}
+
+	if cfg.NoTUI {
+		runPlain(m, os.Stdout)
+	} else {
+		m.reload = notifyReload()
+		var opts []tea.ProgramOption
+		if cfg.UnfocusedInterval > 0 {
+			opts = append(opts, tea.WithReportFocus())
+		}
+		guard := newCrashGuard(m)
+		final, err := tea.NewProgram(guard, opts...).Run()
+		if errors.Is(err, tea.ErrProgramPanic) {
+			writeCrashReport(guard.crash)
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Printf("Error running program: %v\n", err)
+			os.Exit(1)
+		}
+		m = final.(crashGuard).m
+		for _, query := range m.queries {
+			fmt.Println(query)
+		}
+		writeNotes(os.Stdout, m.notes)
+		if cfg.Report != "" {
+			if err := writeReport(m.buildReport(), cfg.Report); err != nil {
+				fmt.Printf("Error writing report: %v\n", err)
+			}
+		}
+	}
+	// Abort fetches still in flight
+	cancel()
+	if err := sinks.Close(); err != nil {
+		fmt.Printf("Error closing sinks: %v\n", err)
+	}
+
+	if cfg.Export != "" {
+		if err := exportHistory(store, m.notes, cfg.Interval, cfg.Export); err != nil {
+			fmt.Printf("Error exporting history: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+type durationElapsedMsg struct{}
+
+// resizeDebounce is how long the terminal size must be stable before the
+// table is rebuilt for a new width.
+const resizeDebounce = 100 * time.Millisecond
+
+// resizeDoneMsg triggers the rebuild after a resize, unless a later resize
+// (with a higher gen) superseded it.
+type resizeDoneMsg struct {
+	gen int
 }
 
 func (m model) Init() tea.Cmd {
-	return tea.Batch(
+	cmds := []tea.Cmd{
 		m.fetchCmd(),
+		m.grpcHealthCmd(),
 		m.tickCmd(),
-	)
+		m.waitForReload(),
+	}
+	if m.cfg.Duration > 0 {
+		cmds = append(cmds, tea.Tick(m.cfg.Duration, func(time.Time) tea.Msg {
+			return durationElapsedMsg{}
+		}))
+	}
+	return tea.Batch(cmds...)
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -121,16 +525,40 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.gotoActive {
+			return m.updateGoto(msg)
+		}
+		if m.noteActive {
+			return m.updateNote(msg)
+		}
+		if m.targetEdit != nil {
+			return m.updateTargetEdit(msg)
+		}
+		if m.help != nil {
+			return m.updateHelp(msg)
+		}
+		if m.inspect != nil && msg.String() != "?" {
+			return m.updateInspect(msg)
+		}
+		if m.rulesFocused && msg.String() != "?" {
+			return m.updateRules(msg)
+		}
+		if m.cardinality != nil && msg.String() != "?" {
+			return m.updateCardinality(msg)
+		}
+		if m.compare != nil && msg.String() != "?" {
+			return m.updateCompare(msg)
+		}
+		m.notice = ""
 		switch msg.String() {
 		case "q", "ctrl+c":
 			return m, tea.Quit
 		case "?":
-			m.showHelp = !m.showHelp
-			return m, nil
+			return m.toggleHelp(), nil
 		case "l":
 			// Cycle through label modes
 			// If FilterLabel is empty, skip the "hide-filtered" mode
-			if m.cfg.FilterLabel == "" {
+			if m.cfg.FilterLabel == "" && m.selector == nil {
 				// Simple toggle: all <-> hide-all
 				if m.cfg.LabelMode == LabelModeShowAll {
 					m.cfg.LabelMode = LabelModeHideAll
@@ -152,91 +580,425 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			// Update viewport content when label mode changes
 			if m.viewportReady {
-				tableStr := m.buildTable()
-				m.viewport.SetContent(tableStr)
+				m.refreshTable()
 			}
 			return m, nil
 		case "d":
-			// Cycle through delta modes: off -> next -> view -> off
+			// Cycle through delta modes: off -> next -> view -> ref -> off
 			switch m.cfg.DeltaMode {
 			case DeltaModeOff:
 				m.cfg.DeltaMode = DeltaModeNext
 			case DeltaModeNext:
 				m.cfg.DeltaMode = DeltaModeView
 			case DeltaModeView:
+				m.cfg.DeltaMode = DeltaModeRef
+			case DeltaModeRef:
 				m.cfg.DeltaMode = DeltaModeOff
 			default:
 				m.cfg.DeltaMode = DeltaModeOff
 			}
 			// Update viewport content when delta mode changes
 			if m.viewportReady {
-				tableStr := m.buildTable()
-				m.viewport.SetContent(tableStr)
+				m.refreshTable()
 			}
 			return m, nil
+		case "r":
+			return m.setReference(0), nil
+		case "<":
+			return m.moveReference(-1), nil
+		case ">":
+			return m.moveReference(1), nil
 		case "p":
 			m.isPaused = !m.isPaused
+			if m.isPaused {
+				m.logEvent("Paused", false)
+			} else {
+				m.logEvent("Resumed", false)
+				// Keep deltas and graphs from spanning the pause
+				m.store.RecordPause()
+				if m.viewportReady {
+					m.refreshTable()
+				}
+			}
+			return m, m.titleCmd()
+		case "E":
+			return m.toggleEvents(), nil
+		case "L":
+			return m.toggleRules(), nil
+		case "B":
+			m.cfg.Bars = !m.cfg.Bars
+			if m.viewportReady {
+				m.refreshTable()
+			}
+			return m, nil
+		case "v":
+			m.cfg.Derived = !m.cfg.Derived
+			m.clampCursor()
+			if m.viewportReady {
+				m.refreshTable()
+			}
+			return m, nil
+		case "0", "1", "2", "3", "4", "5", "6", "7", "8", "9":
+			return m.selectView(int(msg.String()[0] - '0')), nil
+		case "G":
+			return m.writeReportNow(), nil
+		case "C":
+			return m.toggleCardinality(), nil
+		case "S":
+			return m.captureSnapshot(), nil
+		case "D":
+			return m.toggleCompare(), nil
+		case "F":
+			return m.annotateGrafana()
+		case "x":
+			m.cfg.ShowMissing = !m.cfg.ShowMissing
+			m.clampCursor()
+			if m.viewportReady {
+				m.refreshTable()
+			}
+			return m, nil
+		case "f":
+			m.cfg.Aggregate = nextAggregate(m.cfg.Aggregate)
+			m.notice = "Aggregate rows: " + m.cfg.Aggregate
+			if m.cfg.Aggregate != AggregateOff && len(m.fetcher.targetLabelNames()) == 0 {
+				m.notice += " (needs several targets)"
+			}
+			m.clampCursor()
+			if m.viewportReady {
+				m.refreshTable()
+			}
+			return m, nil
+		case "K":
+			return m.toggleCollapsed(), nil
+		case "!":
+			return m.jumpToFiring(), nil
+		case "tab":
+			if !m.showRules {
+				return m, nil
+			}
+			m.rulesFocused = true
+			return m, nil
+		case "A":
+			m.cfg.ColumnAgg = nextColumnAgg(m.cfg.ColumnAgg)
+			m.notice = "Column aggregation: " + m.cfg.ColumnAgg
+			if m.viewportReady {
+				m.refreshTable()
+			}
+			return m, nil
+		case "[", "]":
+			// Shrink or grow the samples per history column
+			if msg.String() == "[" {
+				m.cfg.ColumnWindow = max(m.cfg.ColumnWindow-1, 1)
+			} else {
+				m.cfg.ColumnWindow = min(m.cfg.ColumnWindow+1, max(m.cfg.History-1, 1))
+			}
+			m.notice = fmt.Sprintf("Column window: %d sample(s), %s", m.cfg.ColumnWindow, m.cfg.ColumnAgg)
+			if m.viewportReady {
+				m.refreshTable()
+			}
+			return m, nil
+		case "M":
+			m.cfg.MinMax = !m.cfg.MinMax
+			if m.viewportReady {
+				m.refreshTable()
+			}
+			return m, nil
+		case "a":
+			m.cfg.ShowAge = !m.cfg.ShowAge
+			if m.viewportReady {
+				m.refreshTable()
+			}
+			return m, nil
+		case "o":
+			// Toggle between sorting by name and by age
+			if m.cfg.SortMode == SortModeAge {
+				m.cfg.SortMode = SortModeName
+			} else {
+				m.cfg.SortMode = SortModeAge
+			}
+			if m.viewportReady {
+				m.refreshTable()
+			}
+			return m, nil
+		case "u":
+			m.cfg.HumanUnits = !m.cfg.HumanUnits
+			if m.viewportReady {
+				m.refreshTable()
+			}
+			return m, nil
+		case "U":
+			m.cfg.UnitRow = !m.cfg.UnitRow
+			if m.viewportReady {
+				m.refreshTable()
+			}
+			return m, nil
+		case "b":
+			// Cycle through graph modes
+			switch m.cfg.GraphMode {
+			case GraphModeOff:
+				m.cfg.GraphMode = GraphModeBraille
+			case GraphModeBraille:
+				m.cfg.GraphMode = GraphModeCompact
+			default:
+				m.cfg.GraphMode = GraphModeOff
+			}
+			if m.viewportReady {
+				m.refreshTable()
+			}
+			return m, nil
+		case "e":
+			m.cfg.EscapedNames = !m.cfg.EscapedNames
+			if m.viewportReady {
+				m.refreshTable()
+			}
+			return m, nil
+		case "t":
+			m.cfg.ShowTotals = !m.cfg.ShowTotals
+			if m.viewportReady {
+				m.refreshTable()
+			}
+			return m, nil
+		case "s":
+			// Cycle through stripe modes: off -> rows -> columns -> off
+			switch m.cfg.StripeMode {
+			case StripeModeOff:
+				m.cfg.StripeMode = StripeModeRows
+			case StripeModeRows:
+				m.cfg.StripeMode = StripeModeColumns
+			default:
+				m.cfg.StripeMode = StripeModeOff
+			}
+			if m.viewportReady {
+				m.refreshTable()
+			}
+			return m, nil
+		case "c":
+			// Toggle between normal and compact density
+			if m.cfg.Density == DensityCompact {
+				m.cfg.Density = DensityNormal
+			} else {
+				m.cfg.Density = DensityCompact
+			}
+			if m.viewportReady {
+				m.refreshTable()
+			}
+			return m, nil
+		case "up", "k":
+			m.moveCursor(-1)
+			return m, nil
+		case "down", "j":
+			m.moveCursor(1)
+			return m, nil
+		case "z":
+			return m.toggleZoom()
+		case "m":
+			return m.startNote()
+		case " ":
+			return m.toggleMark(), nil
+		case "i", "enter":
+			m.showLabels = !m.showLabels
+			return m, nil
+		case "I":
+			m.showLabels = false
+			return m.toggleInspect(), nil
+		case "esc":
+			if m.showLabels {
+				m.showLabels = false
+				return m, nil
+			}
+			if len(m.marked) > 0 {
+				clear(m.marked)
+				if m.viewportReady {
+					m.refreshTable()
+				}
+			}
+			return m, nil
+		case "P":
+			return m.togglePins(), nil
+		case "H":
+			return m.hideSeries(), nil
+		case "W":
+			return m.exportMarked(), nil
+		case "Y":
+			return m.copyMarked(), nil
+		case "T":
+			return m.startTargetEdit()
+		case "y":
+			return m.copyPromQL(), nil
+		case "R":
+			return m.reloadConfig(), nil
+		case "g":
+			return m.startGoto()
+		case "n":
+			m.jumpToMatch(1, 1)
+			return m, nil
+		case "N":
+			m.jumpToMatch(-1, -1)
 			return m, nil
 		default:
+			if b, ok := m.bindingFor(msg.String()); ok {
+				return m.runBinding(b)
+			}
 			// Delegate other keys to viewport for scrolling
 			if m.viewportReady {
 				m.viewport, cmd = m.viewport.Update(msg)
+				m.followViewport()
 				return m, cmd
 			}
 		}
+	case durationElapsedMsg:
+		return m, tea.Quit
+	case tea.FocusMsg:
+		return m.updateFocus(true)
+	case tea.BlurMsg:
+		return m.updateFocus(false)
 	case tickMsg:
+		if msg.gen != m.tickGen {
+			return m, nil
+		}
 		if m.isPaused {
 			// When paused, only schedule next tick (no fetch)
 			return m, m.tickCmd()
 		}
+		if m.fetches.busy() {
+			// Don't pile up requests on a slow endpoint
+			return m, m.tickCmd()
+		}
 		// When not paused, do both fetch and schedule next tick
-		return m, tea.Batch(m.fetchCmd(), m.tickCmd())
+		return m, tea.Batch(m.fetchCmd(), m.grpcHealthCmd(), m.tickCmd())
 	case map[string]*dto.MetricFamily: // Fetch result
 		if m.isPaused {
 			// Ignore fetch results while paused
 			return m, nil
 		}
 		m.store.UpdateFromFamilies(msg)
+		m.clampCursor()
+		m.logScrapeEvents()
+		recovered := m.logRecovered()
+		m.evaluateRules()
+		m.evaluateSLOs()
+		m.targetErr = nil
+		if m.connectionError != nil && !recovered {
+			m.logEvent("Scrape recovered", false)
+		}
 		m.isConnected = true
 		m.connectionError = nil
 		m.lastSuccessfulFetch = time.Now()
 		// Update viewport content with new data
 		if m.viewportReady {
-			tableStr := m.buildTable()
-			m.viewport.SetContent(tableStr)
+			m.refreshTable()
+		}
+		m.publishWebView()
+		cmds := []tea.Cmd{m.titleCmd()}
+		if !m.sinks.empty() {
+			cmds = append(cmds, m.sinkCmd(msg, m.lastSuccessfulFetch))
+		}
+		return m, tea.Batch(cmds...)
+	case partialScrapeMsg:
+		prev := m.targetErr
+		updated, cmd := m.Update(msg.families)
+		m = updated.(model)
+		if m.isPaused {
+			return m, cmd
+		}
+		// Log only the first of repeated identical failures
+		if prev == nil || prev.Error() != msg.err.Error() {
+			m.logEvent("Scrape failed: "+msg.err.Error(), true)
+		}
+		m.targetErr = msg.err
+		m.store.MarkPartial()
+		if m.viewportReady {
+			m.refreshTable()
+		}
+		return m, cmd
+	case grpcHealthMsg:
+		prev, _ := m.grpcHealthStatus()
+		m.grpcStatus = &msg
+		// Log changes of the health only
+		if status, ok := m.grpcHealthStatus(); status != prev {
+			m.logEvent(status, !ok)
+		}
+		return m, nil
+	case reloadMsg:
+		return m.reloadConfig(), m.waitForReload()
+	case sinkMsg:
+		m.failedSinks = msg.failed
+		return m, nil
+	case annotationMsg:
+		if msg.err != nil {
+			m.notice = "Grafana annotation failed: " + msg.err.Error()
+		} else {
+			m.notice = fmt.Sprintf("Annotated %d series in Grafana", msg.series)
+		}
+		return m, nil
+	case bindingDoneMsg:
+		if msg.err != nil {
+			m.notice = fmt.Sprintf("Command of %s failed: %v", msg.key, msg.err)
 		}
 		return m, nil
 	case error:
+		// Log only the first of repeated identical failures
+		if m.connectionError == nil || m.connectionError.Error() != msg.Error() {
+			m.logEvent("Scrape failed: "+msg.Error(), true)
+		}
+		if !m.isPaused {
+			m.store.RecordFailure()
+			if m.viewportReady {
+				m.refreshTable()
+			}
+		}
 		// Store connection error but keep retrying
 		m.connectionError = msg
 		m.isConnected = false
 		// Don't set m.err - that's for fatal errors only
 		// The tick/fetch cycle continues automatically
+		return m, m.titleCmd()
+	case zoomTickMsg:
+		if m.zoom == nil || msg.gen != m.zoom.gen {
+			// Stale tick from a previous zoom session
+			return m, nil
+		}
+		if m.isPaused {
+			return m, m.zoomTickCmd()
+		}
+		return m, tea.Batch(m.zoomFetchCmd(), m.zoomTickCmd())
+	case zoomSampleMsg:
+		if m.zoom == nil || msg.gen != m.zoom.gen || m.isPaused {
+			return m, nil
+		}
+		m.zoom.append(msg.value)
 		return m, nil
 	case tea.WindowSizeMsg:
+		widthChanged := msg.Width != m.width
 		m.width = msg.Width
 		m.height = msg.Height
 
 		// Initialize or resize viewport
-		// Reserve 2 lines: 1 for footer, 1 for safety margin
-		viewportHeight := msg.Height - 2
-		if viewportHeight < 1 {
-			viewportHeight = 1
-		}
-
 		if !m.viewportReady {
-			m.viewport = viewport.New(msg.Width, viewportHeight)
+			m.viewport = viewport.New(msg.Width, 1)
 			m.viewport.MouseWheelEnabled = true
 			m.viewportReady = true
-		} else {
-			m.viewport.Width = msg.Width
-			m.viewport.Height = viewportHeight
+			m.resizeViewport()
+			m.refreshTable()
+			return m, nil
 		}
+		m.viewport.Width = msg.Width
+		m.resizeViewport()
 
-		// Update viewport content with current table
-		if m.viewportReady {
-			tableStr := m.buildTable()
-			m.viewport.SetContent(tableStr)
+		if !widthChanged {
+			// The rendered rows still fit, only more or fewer are shown
+			m.ensureRendered()
+			return m, nil
+		}
+		// Rebuild the table once the terminal stops resizing
+		m.resizeGen++
+		gen := m.resizeGen
+		return m, tea.Tick(resizeDebounce, func(time.Time) tea.Msg {
+			return resizeDoneMsg{gen: gen}
+		})
+	case resizeDoneMsg:
+		if msg.gen == m.resizeGen {
+			m.refreshTable()
 		}
 	}
 
@@ -253,9 +1015,9 @@ func (m model) View() string {
 	}
 
 	// Build status indicator (URL with connection status)
-	connectedStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("71")) // dimmer green
-	errorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("196"))    // red
-	scrollHintStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Faint(true)
+	connectedStyle := lipgloss.NewStyle().Foreground(color("71")) // dimmer green
+	errorStyle := lipgloss.NewStyle().Foreground(color("196"))    // red
+	scrollHintStyle := lipgloss.NewStyle().Foreground(color("240")).Faint(true)
 
 	// Build delta status first to measure it
 	deltasStatus := "Off"
@@ -264,15 +1026,92 @@ func (m model) View() string {
 		deltasStatus = m.deltaValueStyle.Render("Δ") + " Next"
 	case DeltaModeView:
 		deltasStatus = m.deltaValueStyle.Render("Δ") + " View"
+	case DeltaModeRef:
+		deltasStatus = m.deltaValueStyle.Render("Δ") + " Ref " + m.refStatus()
 	}
 
 	// Build pause status
 	var pauseStatus string
 	if m.isPaused {
-		pauseStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("220")).Bold(true)
+		pauseStyle := lipgloss.NewStyle().Foreground(color("220")).Bold(true)
 		pauseStatus = " | " + pauseStyle.Render("⏸  PAUSED")
 	}
 
+	// Build view status, only shown while a view preset is active
+	var viewStatus string
+	if m.view > 0 {
+		viewStatus = " | View: " + m.viewName()
+	}
+	if m.cfg.ShowMissing {
+		viewStatus += " | " + errorStyle.Render(fmt.Sprintf("Missing: %d families", m.missingCount()))
+	}
+	if m.cardinality != nil {
+		viewStatus += " | " + m.cardinalityStatus()
+	}
+	if m.compare != nil {
+		viewStatus += " | " + m.compareStatus()
+	}
+
+	// Build focus status, only shown while polling is slowed down
+	var focusStatus string
+	if m.pollInterval() != m.cfg.Interval {
+		focusStatus = " | " + scrollHintStyle.Render("unfocused, every "+m.pollInterval().String())
+	}
+
+	// Build gRPC health status, only shown with -grpc-health
+	var grpcStatus string
+	if m.grpcHealth != nil {
+		status, ok := m.grpcHealthStatus()
+		style := connectedStyle
+		if !ok {
+			style = errorStyle
+		}
+		grpcStatus = " | " + style.Render(status)
+	}
+
+	// Build rules status, only shown with -rules
+	var rulesStatus string
+	if m.rules != nil {
+		status, ok := m.rulesStatus()
+		style := connectedStyle
+		if !ok {
+			style = errorStyle
+		}
+		rulesStatus = " | " + style.Render(status)
+	}
+
+	// Build sink status, only shown when writing to a sink fails
+	var sinkStatus string
+	if len(m.failedSinks) > 0 {
+		sinkStatus = " | " + errorStyle.Render("⚠ "+strings.Join(m.failedSinks, ", "))
+	}
+
+	// Build target status, only shown when some targets fail
+	var targetStatus string
+	var targetErrs *TargetErrors
+	if errors.As(m.targetErr, &targetErrs) {
+		targetStatus = " | " + errorStyle.Render(fmt.Sprintf("⚠ %d/%d targets", targetErrs.Failed, targetErrs.Total))
+	}
+
+	// Build scrape health status, only shown when recent scrapes failed, so
+	// flaky targets are visible also after a successful scrape
+	var healthStatus string
+	if status := m.healthStatus(); status != "" {
+		healthStatus = " | " + errorStyle.Render(status)
+	}
+
+	// Build memory status, only shown with a memory budget
+	var memoryStatus string
+	if m.store.MaxBytes > 0 {
+		memoryStatus = fmt.Sprintf(" | Mem: %s/%s", formatHumanUnit(float64(m.store.UsedBytes), UnitBytes), formatHumanUnit(float64(m.store.MaxBytes), UnitBytes))
+		if n := len(m.store.evicted); n > 0 {
+			memoryStatus += fmt.Sprintf(", %d evicted", n)
+		}
+		if m.store.HistoryLimit < m.cfg.History {
+			memoryStatus = " | " + errorStyle.Render(strings.TrimPrefix(memoryStatus, " | ")+fmt.Sprintf(" (history %d)", m.store.HistoryLimit))
+		}
+	}
+
 	// Build scroll hints
 	var scrollHints string
 	if !m.viewport.AtTop() && !m.viewport.AtBottom() {
@@ -289,6 +1128,14 @@ func (m model) View() string {
 	fixedWidth := lipgloss.Width(fixedPrefix) +
 		lipgloss.Width(deltasStatus) +
 		lipgloss.Width(pauseStatus) +
+		lipgloss.Width(focusStatus) +
+		lipgloss.Width(viewStatus) +
+		lipgloss.Width(grpcStatus) +
+		lipgloss.Width(rulesStatus) +
+		lipgloss.Width(sinkStatus) +
+		lipgloss.Width(targetStatus) +
+		lipgloss.Width(healthStatus) +
+		lipgloss.Width(memoryStatus) +
 		lipgloss.Width(fixedSeparator) +
 		lipgloss.Width(scrollHints) +
 		lipgloss.Width("● ") // Approximate icon width
@@ -301,7 +1148,9 @@ func (m model) View() string {
 
 	// Build status indicator with dynamic truncation
 	var statusIndicator string
-	if m.isConnected {
+	if m.notice != "" {
+		statusIndicator = truncateMessage(m.notice, maxMessageLength+2)
+	} else if m.isConnected {
 		// Connected - show URL with truncation
 		url := truncateMessage(m.cfg.URL, maxMessageLength)
 		statusIndicator = connectedStyle.Render("● ") + url
@@ -315,11 +1164,41 @@ func (m model) View() string {
 		statusIndicator = lipgloss.NewStyle().Faint(true).Render("● ") + url
 	}
 
-	footer := fmt.Sprintf("? for help | Deltas: %s%s | %s%s", deltasStatus, pauseStatus, statusIndicator, scrollHints)
+	footer := fmt.Sprintf("? for help | Deltas: %s%s%s%s%s%s%s%s%s%s | %s%s", deltasStatus, pauseStatus, viewStatus, focusStatus, grpcStatus, rulesStatus, sinkStatus, targetStatus, healthStatus, memoryStatus, statusIndicator, scrollHints)
 
 	// Show help popup if toggled
-	output := m.viewport.View() + "\n" + footer
-	if m.showHelp {
+	output := m.viewport.View() + "\n"
+	if m.tableHeader != "" {
+		output = m.tableHeader + "\n" + output
+	}
+	if m.zoom != nil {
+		output += m.renderZoomPanel() + "\n"
+	}
+	if m.showEvents {
+		output += m.renderEventsPanel() + "\n"
+	}
+	if m.showRules {
+		output += m.renderRulesPanel() + "\n"
+	}
+	if len(m.slos) > 0 {
+		output += m.renderSLOPanel() + "\n"
+	}
+	if m.gotoActive {
+		output += m.gotoInput.View()
+	} else if m.noteActive {
+		output += m.noteInput.View()
+	} else if m.targetEdit != nil {
+		output += m.targetEdit.view()
+	} else {
+		output += footer
+	}
+	if m.showLabels {
+		output = m.renderLabelsOverlay(output)
+	}
+	if m.inspect != nil {
+		output = m.renderInspectOverlay(output)
+	}
+	if m.help != nil {
 		output = m.renderHelpOverlay(output)
 	}
 
@@ -337,57 +1216,168 @@ func truncateMessage(msg string, maxLen int) string {
 	return msg[:maxLen-3] + "..."
 }
 
-func (m model) renderHelpOverlay(content string) string {
-	helpText := `
-Help
+// moveCursor moves the row selection by delta rows and scrolls the viewport
+// to keep the selected row visible.
+func (m *model) moveCursor(delta int) {
+	m.cursor += delta
+	m.clampCursor()
+	if m.viewportReady {
+		m.refreshTable()
+		m.ensureCursorVisible()
+	}
+}
 
-  q/ctrl+c    Quit
-  ?           Toggle this help
-  l           Cycle label display mode
-  d           Cycle delta mode (off/next/view)
-  p           Pause/unpause updates
-  ↑/↓         Scroll up/down
-  PgUp/PgDn   Page up/down
-  Home/End    Go to top/bottom
+// clampCursor keeps the row selection within the currently visible series.
+func (m *model) clampCursor() {
+	n := len(m.visibleSeries())
+	if m.cursor >= n {
+		m.cursor = n - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+}
 
-Press ? to close
-`
+// ensureCursorVisible scrolls the viewport so the selected row is shown.
+func (m *model) ensureCursorVisible() {
+	line := m.cursor
+	if line < m.viewport.YOffset {
+		m.viewport.SetYOffset(line)
+	} else if line >= m.viewport.YOffset+m.viewport.Height {
+		m.viewport.SetYOffset(line - m.viewport.Height + 1)
+	}
+	m.ensureRendered()
+}
 
-	// Create a styled box for the help
-	helpStyle := lipgloss.NewStyle().
-		Border(lipgloss.RoundedBorder()).
-		BorderForeground(lipgloss.Color("63")).
-		Padding(1, 2).
-		Background(lipgloss.Color("235")).
-		Foreground(lipgloss.Color("252"))
+// followViewport moves the row selection into the visible part of the
+// viewport after it has been scrolled independently of the cursor.
+func (m *model) followViewport() {
+	top := m.viewport.YOffset
+	bottom := top + m.viewport.Height - 1
+	cursor := min(max(m.cursor, top), bottom)
+	if cursor != m.cursor {
+		m.cursor = cursor
+		m.clampCursor()
+		m.refreshTable()
+	}
+	m.ensureRendered()
+}
 
-	helpBox := helpStyle.Render(helpText)
+// selectedSeries returns the series under the cursor, or nil if there are no
+// visible series.
+func (m model) selectedSeries() *MetricSeries {
+	series := m.visibleSeries()
+	if m.cursor < 0 || m.cursor >= len(series) {
+		return nil
+	}
+	return series[m.cursor]
+}
 
-	// Overlay the help on top of content using Place
-	return lipgloss.Place(
-		m.width,
-		m.height,
-		lipgloss.Center,
-		lipgloss.Center,
-		helpBox,
-		lipgloss.WithWhitespaceChars(" "),
-		lipgloss.WithWhitespaceForeground(lipgloss.Color("0")),
-	)
+// refreshTable re-renders the table, keeping the header rows pinned above the
+// viewport and the data rows inside it.
+//
+// Only the rows within a viewport height above and below the visible ones are
+// rendered, the others are blank until scrolled near (see ensureRendered).
+func (m *model) refreshTable() {
+	if m.cardinality != nil {
+		m.refreshCardinality()
+		return
+	}
+	if m.compare != nil {
+		m.refreshCompare()
+		return
+	}
+	from := max(m.viewport.YOffset-m.viewport.Height, 0)
+	to := m.viewport.YOffset + 2*max(m.viewport.Height, 1)
+	table, numRows := m.buildTableWindow(from, to)
+	to = min(to, numRows)
+	from = min(from, to)
+
+	lines := strings.Split(table, "\n")
+	headerLines := m.tableHeaderLines()
+	if len(lines) > headerLines {
+		m.tableHeader = strings.Join(lines[:headerLines], "\n")
+		lines = lines[headerLines:]
+	} else {
+		m.tableHeader = ""
+	}
+	if numRows > 0 && len(lines) >= to-from {
+		// Place the rendered rows at their position among blank placeholder
+		// lines, followed by the bottom border
+		content := make([]string, 0, numRows+len(lines)-(to-from))
+		content = append(content, make([]string, from)...)
+		content = append(content, lines[:to-from]...)
+		content = append(content, make([]string, numRows-to)...)
+		lines = append(content, lines[to-from:]...)
+	}
+	m.renderedFrom, m.renderedTo = from, to
+
+	m.resizeViewport()
+	m.viewport.SetContent(strings.Join(lines, "\n"))
+}
+
+// ensureRendered re-renders the table if the viewport has been scrolled to
+// rows outside of the rendered window.
+func (m *model) ensureRendered() {
+	top := m.viewport.YOffset
+	bottom := min(top+m.viewport.Height, m.viewport.TotalLineCount())
+	if top < m.renderedFrom || bottom > m.renderedTo {
+		m.refreshTable()
+	}
+}
+
+// resizeViewport fits the viewport height to the terminal, leaving room for
+// the footer and any panels shown below the table.
+func (m *model) resizeViewport() {
+	// Reserve 2 lines: 1 for footer, 1 for safety margin
+	viewportHeight := m.height - 2
+	if m.tableHeader != "" {
+		viewportHeight -= m.tableHeaderLines()
+	}
+	if m.zoom != nil {
+		viewportHeight -= zoomPanelHeight
+	}
+	if m.showEvents {
+		viewportHeight -= eventsPanelHeight
+	}
+	if m.showRules {
+		viewportHeight -= rulesPanelHeight
+	}
+	viewportHeight -= len(m.slos)
+	if viewportHeight < 1 {
+		viewportHeight = 1
+	}
+	m.viewport.Height = viewportHeight
 }
 
 var baseStyle = lipgloss.NewStyle().
 	BorderStyle(lipgloss.NormalBorder()).
-	BorderForeground(lipgloss.Color("240"))
+	BorderForeground(color("240"))
 
+// tickCmd schedules the next tick at the next multiple of the polling interval
+// since the start of the session, rather than an interval from now, so the
+// time spent handling ticks doesn't add up to drift.
 func (m model) tickCmd() tea.Cmd {
-	return tea.Tick(m.cfg.Interval, func(t time.Time) tea.Msg {
-		return tickMsg(t)
+	gen := m.tickGen
+	interval := m.pollInterval()
+	return tea.Tick(interval-time.Since(m.started)%interval, func(time.Time) tea.Msg {
+		return tickMsg{gen: gen}
 	})
 }
 
+// fetchCmd fetches the metrics, canceling any fetch still in flight.
 func (m model) fetchCmd() tea.Cmd {
+	ctx := m.fetches.start(m.ctx)
 	return func() tea.Msg {
-		families, err := m.fetcher.Fetch()
+		families, err := m.fetcher.FetchContext(ctx)
+		if ctx.Err() != nil {
+			// Superseded by a newer fetch or the program is exiting
+			return nil
+		}
+		m.fetches.finish(ctx)
+		if err != nil && families != nil {
+			return partialScrapeMsg{families: families, err: err}
+		}
 		if err != nil {
 			return err
 		}
@@ -396,11 +1386,11 @@ func (m model) fetchCmd() tea.Cmd {
 }
 
 func formatMetricName(series *MetricSeries, hideLabels bool) string {
-	name := series.Name
+	name := displayName(series.Name, false, false)
 	if !hideLabels && len(series.Labels) > 0 {
 		var labelParts []string
 		for k, v := range series.Labels {
-			labelParts = append(labelParts, fmt.Sprintf("%s=%s", k, v))
+			labelParts = append(labelParts, fmt.Sprintf("%s=%s", displayName(k, true, false), v))
 		}
 		sort.Strings(labelParts)
 		name += fmt.Sprintf("{%s}", strings.Join(labelParts, ","))
@@ -466,220 +1456,502 @@ func calculateColumnWidths(headers []string, rows [][]string) []int {
 	return widths
 }
 
-func (m model) buildTableRows(filteredSeries []*MetricSeries) [][]string {
-	rows := [][]string{}
-	for _, series := range filteredSeries {
-		// Style metric name and labels based on label mode
-		styledName := m.metricNameStyle.Render(series.Name)
+// buildTableRows renders the rows of a range of the visible series, where
+// firstRow is the row index of the first series in the range.
+func (m model) buildTableRows(filteredSeries []*MetricSeries, firstRow int) [][]string {
+	if m.rowCache != nil {
+		return m.rowCache.render(m, filteredSeries, firstRow)
+	}
+	rows := make([][]string, 0, len(filteredSeries))
+	for i, series := range filteredSeries {
+		rows = append(rows, m.buildTableRow(firstRow+i, series))
+	}
+	return rows
+}
+
+// buildTableRow renders the metric name and all value columns of one series.
+func (m model) buildTableRow(rowIdx int, series *MetricSeries) []string {
+	// Style metric name and labels based on label mode
+	nameStyle, labelStyle := m.metricNameStyle, m.labelStyle
+	isNew := m.store.IsNew(series, m.cfg.HighlightNew)
+	if rowIdx == m.cursor {
+		nameStyle, labelStyle = m.selectedStyle, m.selectedStyle
+	} else if isNew {
+		nameStyle = m.newSeriesStyle
+	}
+	nameStripe := m.stripeStyle(rowIdx, -1)
+	nameStyle, labelStyle = nameStyle.Inherit(nameStripe), labelStyle.Inherit(nameStripe)
+	styledName := m.renderMatches(displayName(series.Name, false, m.cfg.EscapedNames), nameStyle)
+	if isNew {
+		// Marked also with a symbol, as the color is lost when selected
+		styledName = m.newSeriesStyle.Inherit(nameStripe).Render("+ ") + styledName
+	}
+	if m.showGraph() {
+		graph := brailleGraph(m.graphValues(series), m.graphWidth())
+		styledName = m.currentValueStyle.Inherit(nameStripe).Render(graph+" ") + styledName
+	}
+	if series.TimestampStale() {
+		// The exporter keeps repeating an old sample
+		styledName = m.labelStyle.Inherit(nameStripe).Render("⏱ ") + styledName
+	}
+	if _, ok := m.notes[series.signature()]; ok {
+		styledName = m.labelStyle.Inherit(nameStripe).Render("✎ ") + styledName
+	}
+	if m.pinned.has(series) {
+		styledName = m.labelStyle.Inherit(nameStripe).Render("▲ ") + styledName
+	}
+	if m.marked.has(series) {
+		styledName = m.currentValueStyle.Inherit(nameStripe).Render("◆ ") + styledName
+	}
 
-		// Determine which labels to show based on mode
-		if m.cfg.LabelMode != LabelModeHideAll && len(series.Labels) > 0 {
-			var labelParts []string
+	// Determine which labels to show based on mode
+	if m.cfg.LabelMode != LabelModeHideAll && len(series.Labels) > 0 {
+		var labelParts []string
 
-			if m.cfg.LabelMode == LabelModeHideFiltered {
-				// Hide only the filtered label keys
-				filteredKeys := getFilteredLabelKeys(m.cfg.FilterLabel)
-				filteredKeyMap := make(map[string]bool)
-				for _, key := range filteredKeys {
-					filteredKeyMap[key] = true
-				}
+		if m.cfg.LabelMode == LabelModeHideFiltered {
+			// Hide only the filtered label keys
+			filteredKeys := getFilteredLabelKeys(m.cfg.FilterLabel)
+			if m.selector != nil {
+				filteredKeys = append(filteredKeys, m.selector.equalityLabels()...)
+			}
+			filteredKeyMap := make(map[string]bool)
+			for _, key := range filteredKeys {
+				filteredKeyMap[key] = true
+			}
 
-				// Only include labels whose keys are NOT in the filter
-				for k, v := range series.Labels {
-					if !filteredKeyMap[k] {
-						labelParts = append(labelParts, fmt.Sprintf("%s=%s", k, v))
-					}
-				}
-			} else {
-				// LabelModeShowAll - show all labels
-				for k, v := range series.Labels {
-					labelParts = append(labelParts, fmt.Sprintf("%s=%s", k, v))
+			// Only include labels whose keys are NOT in the filter
+			for k, v := range series.Labels {
+				if !filteredKeyMap[k] && !filteredKeyMap[escapeName(k)] {
+					labelParts = append(labelParts, fmt.Sprintf("%s=%s", displayName(k, true, m.cfg.EscapedNames), v))
 				}
 			}
-
-			if len(labelParts) > 0 {
-				sort.Strings(labelParts)
-				styledName = styledName + m.labelStyle.Render(fmt.Sprintf("{%s}", strings.Join(labelParts, ",")))
+		} else {
+			// LabelModeShowAll - show all labels
+			for k, v := range series.Labels {
+				labelParts = append(labelParts, fmt.Sprintf("%s=%s", displayName(k, true, m.cfg.EscapedNames), v))
 			}
 		}
 
-		row := []string{styledName}
-
-		// Get values - build all possible value columns up to history limit
-		vals := series.ValuesWithDeltas(m.cfg.DeltaMode)
-		numValueCols := m.cfg.History
-		if numValueCols < 1 {
-			numValueCols = 1
+		if len(labelParts) > 0 {
+			sort.Strings(labelParts)
+			styledName = styledName + labelStyle.Render(fmt.Sprintf("{%s}", strings.Join(labelParts, ",")))
 		}
+	}
 
-		// Create value columns
-		for i := 0; i < numValueCols; i++ {
-			offset := numValueCols - 1 - i
-			valIdx := len(vals) - 1 - offset
-			isCurrentValue := (i == numValueCols-1)
+	row := []string{styledName}
 
-			if valIdx >= 0 && valIdx < len(vals) {
-				val := vals[valIdx]
-				if math.IsNaN(val) {
-					row = append(row, ".")
-				} else {
-					formatted := formatFloat(val)
-					isDeltaValue := false
-
-					// Determine if this should be displayed as a delta value
-					switch m.cfg.DeltaMode {
-					case DeltaModeNext:
-						// In 'next' mode, all historical values are deltas, current is absolute
-						isDeltaValue = !isCurrentValue
-					case DeltaModeView:
-						// In 'view' mode, all values including current are deltas
-						isDeltaValue = true
-					}
-
-					if isDeltaValue {
-						// Delta values
-						if formatted == "0" || formatted == "-0" {
-							formatted = "."
-						} else {
-							// Add explicit sign for deltas
-							if val > 0 {
-								formatted = "+" + formatted
-							}
-							formatted = m.deltaValueStyle.Render(formatted)
-						}
-					} else if isCurrentValue {
-						// Current value in non-delta modes is shown in magenta
-						formatted = m.currentValueStyle.Render(formatted)
-					}
-					row = append(row, formatted)
+	// Get values - build all possible value columns up to history limit
+	vals := m.columnValues(series)
+	numValueCols := m.valueColumns()
+
+	lo, hi := math.NaN(), math.NaN()
+	if m.cfg.MinMax {
+		lo, hi = windowMinMax(vals[max(len(vals)-numValueCols, 0):])
+	}
+
+	// Create value columns
+	for i := 0; i < numValueCols; i++ {
+		offset := numValueCols - 1 - i
+		valIdx := len(vals) - 1 - offset
+		isCurrentValue := (i == numValueCols-1)
+
+		if valIdx >= 0 && valIdx < len(vals) {
+			base := m.stripeStyle(rowIdx, offset)
+			switch vals[valIdx] {
+			case hi:
+				base = m.maxValueStyle.Inherit(base)
+			case lo:
+				base = m.minValueStyle.Inherit(base)
+			}
+			if isCurrentValue && m.cfg.Bars && (m.cfg.DeltaMode == DeltaModeOff || m.cfg.DeltaMode == DeltaModeNext) && !math.IsNaN(vals[valIdx]) {
+				if lo, hi, ok := m.gaugeRange(series); ok {
+					row = append(row, m.currentValueStyle.Inherit(base).Render(gaugeBar(vals[valIdx], lo, hi)))
+					continue
 				}
-			} else {
-				row = append(row, "")
 			}
+			if math.IsNaN(vals[valIdx]) && m.pauseColumn(offset) {
+				row = append(row, m.labelStyle.Inherit(base).Render("┊"))
+				continue
+			}
+			unit, val := m.scaledValue(series.Unit, vals[valIdx], offset)
+			row = append(row, m.formatCell(unit, val, isCurrentValue, base))
+		} else {
+			row = append(row, "")
 		}
+	}
+	if m.baseline != nil {
+		row = append(row, m.formatBaselineCell(series, m.stripeStyle(rowIdx, -1)))
+	}
+	if m.cfg.ShowAge {
+		row = append(row, m.stripeStyle(rowIdx, -1).Render(formatAge(series.FirstSeen)))
+	}
+	return row
+}
+
+// seriesOrder holds the stored, derived and aggregate series sorted for the
+// table between scrapes, as the table is rendered far more often.
+type seriesOrder struct {
+	key    seriesOrderKey
+	valid  bool
+	series []*MetricSeries
+}
 
-		rows = append(rows, row)
+type seriesOrderKey struct {
+	scrapes    uint64
+	stored     int // Series in the store, which drop with evictions
+	derived    int // Derived series shown, -1 when hidden
+	aggregates aggregateKey
+}
+
+// sortedSeries returns the stored series, the derived ones if shown and the
+// aggregate rows sorted by sortKey, and the signatures of the aggregated
+// series. The slice is shared between calls and must not be modified.
+func (m model) sortedSeries() ([]*MetricSeries, map[string]bool) {
+	aggregates, members := m.aggregates()
+	key := seriesOrderKey{
+		scrapes: m.store.scrapes,
+		stored:  len(m.store.Metrics),
+		derived: -1,
 	}
-	return rows
+	if m.aggregateCache != nil {
+		key.aggregates = m.aggregateCache.key
+	}
+	if m.cfg.Derived {
+		key.derived = len(m.store.Derived)
+	}
+	c := m.seriesOrder
+	if c != nil && c.valid && c.key == key {
+		return c.series, members
+	}
+
+	all := make([]*MetricSeries, 0, len(m.store.Metrics)+len(aggregates))
+	for _, series := range m.store.Metrics {
+		all = append(all, series)
+	}
+	if m.cfg.Derived {
+		for _, series := range m.store.Derived {
+			all = append(all, series)
+		}
+	}
+	for _, series := range aggregates {
+		all = append(all, series)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].sortKey < all[j].sortKey })
+	if c != nil {
+		*c = seriesOrder{key: key, valid: true, series: all}
+	}
+	return all, members
 }
 
-func (m model) buildTable() string {
-	// Filter metrics first
+// visibleSeries returns the series matching the metric and label filters,
+// sorted by signature with bucket rows ordered by le. Row indices in the
+// table refer to this slice.
+func (m model) visibleSeries() []*MetricSeries {
 	var filteredSeries []*MetricSeries
-	keys := make([]string, 0, len(m.store.Metrics))
-	for k := range m.store.Metrics {
-		keys = append(keys, k)
+	var all []*MetricSeries
+	if m.cfg.ShowMissing {
+		all = m.missingSeries()
+	} else {
+		var members map[string]bool
+		all, members = m.sortedSeries()
+		if len(m.collapsed) > 0 {
+			// Leave out the rows of the targets of collapsed families
+			all = slices.DeleteFunc(slices.Clone(all), func(series *MetricSeries) bool {
+				return !series.Derived && m.collapsed[series.Name] && members[series.signature()]
+			})
+		}
 	}
-	sort.Strings(keys)
 
-	for _, k := range keys {
-		series := m.store.Metrics[k]
+	for _, series := range all {
+		if len(m.hidden) > 0 && m.hidden.has(series) {
+			continue
+		}
 		// Apply filters
-		if m.cfg.FilterMetric != "" {
-			matched, _ := regexp.MatchString(m.cfg.FilterMetric, series.Name)
+		if m.selector != nil && !m.selector.matches(series) {
+			continue
+		}
+		if m.metricFilter != nil {
+			matched := m.metricFilter.MatchString(series.Name)
+			if !matched && series.Name != escapeName(series.Name) {
+				matched = m.metricFilter.MatchString(escapeName(series.Name))
+			}
 			if !matched {
 				continue
 			}
 		}
-		if m.cfg.FilterLabel != "" {
+		if m.labelFilter != nil {
+			if !m.labelFilter.matches(series) {
+				continue
+			}
+		} else if m.labelRegex != nil {
+			// Deprecated: match any label value
 			matched := false
-
-			// Check for key=value or key=~value
-			if idx := strings.Index(m.cfg.FilterLabel, "="); idx != -1 {
-				key := m.cfg.FilterLabel[:idx]
-				rest := m.cfg.FilterLabel[idx+1:]
-
-				// Check if it is a regex match (starts with ~)
-				if strings.HasPrefix(rest, "~") {
-					pattern := rest[1:]
-					if val, ok := series.Labels[key]; ok {
-						if ok, _ := regexp.MatchString(pattern, val); ok {
-							matched = true
-						}
-					}
-				} else {
-					// Exact match
-					if val, ok := series.Labels[key]; ok {
-						if val == rest {
-							matched = true
-						}
-					}
-				}
-			} else {
-				// Fallback: match value against regex (original behavior)
-				for _, v := range series.Labels {
-					if ok, _ := regexp.MatchString(m.cfg.FilterLabel, v); ok {
-						matched = true
-						break
-					}
+			for _, v := range series.Labels {
+				if m.labelRegex.MatchString(v) {
+					matched = true
+					break
 				}
 			}
-
 			if !matched {
 				continue
 			}
 		}
 		filteredSeries = append(filteredSeries, series)
 	}
+	if m.cfg.SortMode == SortModeAge {
+		sortByAge(filteredSeries)
+	}
+	if len(m.pinned) > 0 {
+		slices.SortStableFunc(filteredSeries, func(a, b *MetricSeries) int {
+			return compareBool(m.pinned.has(b), m.pinned.has(a))
+		})
+	}
+	return filteredSeries
+}
+
+// formatCell formats a single value cell, styling it as a delta or as the
+// current value depending on the delta mode. The base style carries the cell
+// background.
+func (m model) formatCell(unit string, val float64, isCurrentValue bool, base lipgloss.Style) string {
+	if math.IsNaN(val) {
+		if m.cfg.Monochrome {
+			// Distinguish missing values from zero deltas without color
+			return base.Render("?")
+		}
+		return base.Render(".")
+	}
+
+	formatted := m.formatValue(unit, val)
+	isDeltaValue := false
+
+	// Determine if this should be displayed as a delta value
+	switch m.cfg.DeltaMode {
+	case DeltaModeNext:
+		// In 'next' mode, all historical values are deltas, current is absolute
+		isDeltaValue = !isCurrentValue
+	case DeltaModeView, DeltaModeRef:
+		// In 'view' and 'ref' mode, all values including current are deltas
+		isDeltaValue = true
+	}
+
+	if isDeltaValue {
+		return m.formatDeltaCell(unit, val, base)
+	} else if isCurrentValue {
+		// Current value in non-delta modes is shown in magenta
+		return m.currentValueStyle.Inherit(base).Render(formatted)
+	}
+	return base.Render(formatted)
+}
+
+// windowMinMax returns the lowest and highest values, ignoring missing ones.
+// Both are NaN if the values do not vary, as there is nothing to mark.
+func windowMinMax(vals []float64) (float64, float64) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range vals {
+		if !math.IsNaN(v) {
+			lo, hi = math.Min(lo, v), math.Max(hi, v)
+		}
+	}
+	if lo >= hi {
+		return math.NaN(), math.NaN()
+	}
+	return lo, hi
+}
+
+// formatDeltaCell formats a difference with an explicit sign, or "." if it
+// rounds to zero.
+func (m model) formatDeltaCell(unit string, val float64, base lipgloss.Style) string {
+	if rounded := formatFloat(val); (rounded == "0" || rounded == "-0") && (unit != unitScaled || val == 0) {
+		return base.Render(".")
+	}
+	formatted := m.formatValue(unit, val)
+	if m.cfg.Monochrome {
+		// Arrows are easier to tell apart than +/- without color
+		if val > 0 {
+			formatted = "▲" + formatted
+		} else {
+			formatted = "▼" + strings.TrimPrefix(formatted, "-")
+		}
+	} else if val > 0 {
+		formatted = "+" + formatted
+	}
+	return m.deltaValueStyle.Inherit(base).Render(formatted)
+}
 
+// buildTotalsRow builds the aggregate row with the per-column sum over all
+// series, skipping missing values.
+func (m model) buildTotalsRow(filteredSeries []*MetricSeries, numValueCols int) []string {
+	sums := make([]float64, numValueCols)
+	counts := make([]int, numValueCols)
+	unit := ""
+	for i, series := range filteredSeries {
+		// Keep the unit only if all series share it
+		if i == 0 {
+			unit = series.Unit
+		} else if series.Unit != unit {
+			unit = ""
+		}
+
+		vals := m.columnValues(series)
+		for col := 0; col < numValueCols; col++ {
+			valIdx := len(vals) - numValueCols + col
+			if valIdx >= 0 && !math.IsNaN(vals[valIdx]) {
+				sums[col] += vals[valIdx]
+				counts[col]++
+			}
+		}
+	}
+
+	rowIdx := len(filteredSeries)
+	label := fmt.Sprintf("Σ %d series", len(filteredSeries))
+	if m.showGraph() {
+		// Align with the names following the graphs
+		label = strings.Repeat(" ", m.graphWidth()+1) + label
+	}
+	row := []string{m.totalsStyle.Inherit(m.stripeStyle(rowIdx, -1)).Render(label)}
+	for col := 0; col < numValueCols; col++ {
+		if counts[col] == 0 {
+			row = append(row, "")
+			continue
+		}
+		offset := numValueCols - 1 - col
+		cellUnit, sum := m.scaledValue(unit, sums[col], offset)
+		row = append(row, m.formatCell(cellUnit, sum, col == numValueCols-1, m.stripeStyle(rowIdx, offset)))
+	}
+	if m.baseline != nil {
+		var diffs float64
+		var found bool
+		for _, series := range filteredSeries {
+			if diff, ok := m.baselineDiff(series); ok {
+				diffs += diff
+				found = true
+			}
+		}
+		cell := ""
+		if found {
+			cell = m.formatDeltaCell(unit, diffs, m.stripeStyle(rowIdx, -1))
+		}
+		row = append(row, cell)
+	}
+	if m.cfg.ShowAge {
+		row = append(row, "")
+	}
+	return row
+}
+
+// buildUnitRow builds the unit row for all history columns, see
+// columnUnits.
+func (m model) buildUnitRow() []string {
+	row := []string{""}
+	for _, u := range m.colUnits {
+		row = append(row, m.labelStyle.Render(u.label))
+	}
+	if m.baseline != nil {
+		row = append(row, "")
+	}
+	if m.cfg.ShowAge {
+		row = append(row, "")
+	}
+	return row
+}
+
+// buildTableData builds the headers and rows for all history columns,
+// before fitting them to the terminal width. It returns nil if there are no
+// series to display.
+func (m model) buildTableData() ([]string, [][]string) {
+	filteredSeries := m.visibleSeries()
 	if len(filteredSeries) == 0 {
-		return "No metrics to display"
+		return nil, nil
+	}
+	var allRows [][]string
+	if m.showUnitRow() {
+		m.colUnits = m.columnUnits(filteredSeries)
+		allRows = append(allRows, m.buildUnitRow())
 	}
 
 	// Build rows with all possible columns first
-	allRows := m.buildTableRows(filteredSeries)
-
-	// Build headers for all possible columns
-	maxPossibleValueCols := m.cfg.History
-	if maxPossibleValueCols < 1 {
-		maxPossibleValueCols = 1
+	allRows = append(allRows, m.buildTableRows(filteredSeries, 0)...)
+	if m.cfg.ShowTotals {
+		allRows = append(allRows, m.buildTotalsRow(filteredSeries, m.valueColumns()))
 	}
+	return m.buildTableHeaders(), allRows
+}
+
+// buildTableHeaders builds the headers for all history columns.
+func (m model) buildTableHeaders() []string {
+	maxPossibleValueCols := m.valueColumns()
 	allHeaders := []string{"Metric"}
 	for i := 0; i < maxPossibleValueCols; i++ {
-		title := fmt.Sprintf("-%ds", (maxPossibleValueCols-1-i)*int(m.cfg.Interval.Seconds()))
-		if i == maxPossibleValueCols-1 {
-			title = "Curr"
+		offset := maxPossibleValueCols - 1 - i
+		title := m.columnTitle(offset)
+		if m.cfg.DeltaMode == DeltaModeRef && offset == m.refOffset() {
+			title += " ref"
 		}
-		allHeaders = append(allHeaders, title)
+		allHeaders = append(allHeaders, title+m.columnScrapeMarker(offset))
+	}
+	if m.baseline != nil {
+		allHeaders = append(allHeaders, "vs base")
 	}
+	if m.cfg.ShowAge {
+		allHeaders = append(allHeaders, "Age")
+	}
+	return allHeaders
+}
 
-	// Calculate column widths from headers and data
-	colWidths := calculateColumnWidths(allHeaders, allRows)
+// buildTable renders the complete table.
+func (m model) buildTable() string {
+	table, _ := m.buildTableWindow(0, math.MaxInt)
+	return table
+}
 
-	// Calculate how many value columns will fit in terminal width
-	// Table width formula: sum(column_widths) + (num_columns + 1) for borders
-	usedWidth := 1 // Start with left border
-	if len(colWidths) > 0 {
-		usedWidth += colWidths[0] + 1 // metric name column + its right border
-	}
-
-	numValueCols := 0
-	maxPossibleCols := len(colWidths) - 1 // Subtract 1 for metric name column
-
-	// Add value columns from right to left (current going back in time)
-	// Column indices: [0] = metric name, [1..N] = value columns (oldest to newest)
-	for i := 0; i < maxPossibleCols; i++ {
-		colIdx := len(colWidths) - 1 - i // Start from rightmost (newest) column
-		if colIdx > 0 && colIdx < len(colWidths) {
-			// Each additional column adds: column_width + 1 border
-			if usedWidth+colWidths[colIdx]+1 <= m.width {
-				usedWidth += colWidths[colIdx] + 1
-				numValueCols++
-			} else {
-				break
-			}
-		}
+// buildTableWindow renders the table with only the data rows in [from, to)
+// formatted, and returns it along with the total number of data rows.
+// Formatting all rows of a large table on every update is too slow, so the
+// caller renders the rows around the scroll position only.
+func (m model) buildTableWindow(from, to int) (string, int) {
+	filteredSeries := m.visibleSeries()
+	if len(filteredSeries) == 0 {
+		return "No metrics to display", 0
+	}
+	numRows := len(filteredSeries)
+	if m.cfg.ShowTotals {
+		numRows++
 	}
+	to = min(to, numRows)
+	from = min(max(from, 0), to)
+
+	// The unit row goes first, to be kept above the viewport with the headers
+	var allRows [][]string
+	unitRows := 0
+	if m.showUnitRow() {
+		m.colUnits = m.columnUnits(filteredSeries)
+		allRows = append(allRows, m.buildUnitRow())
+		unitRows = 1
+	}
+	allRows = append(allRows, m.buildTableRows(filteredSeries[from:min(to, len(filteredSeries))], from)...)
+	if m.cfg.ShowTotals && to == numRows {
+		allRows = append(allRows, m.buildTotalsRow(filteredSeries, m.valueColumns()))
+	}
+	allHeaders := m.buildTableHeaders()
 
-	if numValueCols < 1 {
-		numValueCols = 1
+	// Calculate column widths from headers and data. Rows outside the window
+	// are not known, so widths only grow to keep the layout stable while
+	// scrolling.
+	colWidths := calculateColumnWidths(allHeaders, allRows)
+	if m.rowCache != nil {
+		colWidths = m.rowCache.stickyWidths(m, colWidths)
 	}
 
+	// Fit the columns to the terminal width, see fitColumns. Column indices:
+	// [0] = metric name, [1..N] = value columns (oldest to newest)
+	numValueCols, nameWidth := m.fitColumns(colWidths)
+	colWidths[0] = nameWidth
+
 	// Trim rows to fit the calculated number of columns
 	rows := make([][]string, len(allRows))
 	for i, row := range allRows {
 		// Keep metric name column + numValueCols from the end
-		trimmedRow := []string{row[0]}
+		trimmedRow := []string{elideName(row[0], nameWidth)}
 		startCol := len(row) - numValueCols
 		if startCol < 1 {
 			startCol = 1
@@ -696,47 +1968,295 @@ func (m model) buildTable() string {
 	}
 	headers = append(headers, allHeaders[startHeaderCol:]...)
 
+	// Pad headers to the column widths, as the rows in the window may be
+	// narrower than the widest row
+	for i := range headers {
+		colIdx := 0
+		if i > 0 {
+			colIdx = startHeaderCol + i - 1
+		}
+		headers[i] += strings.Repeat(" ", max(colWidths[colIdx]-lipgloss.Width(headers[i]), 0))
+	}
+
 	// Create table
 	t := table.New().
 		Border(lipgloss.RoundedBorder()).
-		BorderStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("240"))).
+		BorderStyle(lipgloss.NewStyle().Foreground(color("240"))).
 		Headers(headers...).
 		Rows(rows...)
+	headerStyle := lipgloss.NewStyle()
+	if m.cfg.Density == DensityCompact {
+		t = t.Border(lipgloss.Border{Left: " "}).
+			BorderTop(false).
+			BorderBottom(false).
+			BorderLeft(false).
+			BorderRight(false).
+			BorderHeader(false)
+		headerStyle = headerStyle.Underline(true)
+	}
+	t = t.StyleFunc(func(row, col int) lipgloss.Style {
+		if row == table.HeaderRow {
+			return headerStyle
+		}
+		row -= unitRows
+		if row < 0 {
+			return lipgloss.NewStyle()
+		}
+		// Pad cells with the stripe background
+		offset := len(headers) - 1 - col
+		if col == 0 {
+			offset = -1
+		}
+		return m.stripeStyle(from+row, offset)
+	})
 
-	return t.Render()
+	return t.Render(), numRows
 }
 
 func parseFlags() Config {
 	var cfg Config
-	flag.StringVar(&cfg.URL, "url", "", "URL to poll metrics from (required)")
-	flag.DurationVar(&cfg.Interval, "interval", 5*time.Second, "Polling interval")
-	flag.IntVar(&cfg.History, "history", 10, "Number of historical samples to keep")
-	flag.StringVar(&cfg.LabelMode, "label-mode", LabelModeShowAll, "Label display mode: all, hide-filtered, hide-all")
-	flag.StringVar(&cfg.FilterMetric, "filter-metric", "", "Regex to filter metrics by name")
-	flag.StringVar(&cfg.FilterLabel, "filter-label", "", "Regex to filter metrics by label (e.g. 'env=prod')")
-	flag.StringVar(&cfg.DeltaMode, "delta-mode", DeltaModeOff, "Delta mode: off, next, view")
-
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage: %s [flags]\n", os.Args[0])
+		fmt.Fprintf(out, "       %s diff [flags] <url1> <url2>\n", os.Args[0])
+		fmt.Fprintf(out, "       %s lint [flags] <url>\n", os.Args[0])
+		fmt.Fprintf(out, "       %s attach <unix:path|tcp:host:port>\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	defineFlags(flag.CommandLine, &cfg)
 	flag.Parse()
 
+	if cfg.ConfigFile != "" {
+		if err := applyConfigFile(flag.CommandLine, cfg.ConfigFile); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if err := cfg.loadPromConfig(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := cfg.validate(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	return cfg
+}
+
+// defineFlags defines the command line flags of cfg on fs.
+func defineFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.ConfigFile, "config", "", "File with flag settings, one 'name = value' per line; command line flags take precedence. Reloaded on SIGHUP or R")
+	fs.Var(&cfg.URLs, "url", "URL to poll metrics from (required), optionally with labels added to its series, e.g. 'http://a/metrics;env=prod;zone=a' (repeatable to merge several targets)")
+	fs.Func("pid", "Also watch the CPU, memory, file descriptors, sockets and threads of this local process from /proc (shorthand for -url proc://<pid>, repeatable)", func(pid string) error {
+		u, err := procURL(pid)
+		if err == nil {
+			cfg.URLs = append(cfg.URLs, u)
+		}
+		return err
+	})
+	fs.Func("textfile-dir", "Also watch the *.prom files in this node exporter textfile collector directory, re-read every interval (shorthand for -url textfile://<dir>, repeatable)", func(dir string) error {
+		cfg.URLs = append(cfg.URLs, textfilePrefix+dir)
+		return nil
+	})
+	fs.StringVar(&cfg.PromConfig, "prom-config", "", "Also scrape the static targets of a -job in this Prometheus configuration file, with its scheme, metrics_path, params and basic_auth or bearer token")
+	fs.StringVar(&cfg.PromJob, "job", "", "Job in -prom-config to scrape (may be omitted if it has only one)")
+	fs.BoolVar(&cfg.Stagger, "stagger", true, "Spread the fetches of multiple targets across half the polling interval instead of starting them at once")
+	fs.StringVar(&cfg.Format, "format", FormatAuto, "Exposition format of the targets: auto (detected from Content-Type and the response), text, openmetrics, protobuf, json (prom2json)")
+	fs.DurationVar(&cfg.Interval, "interval", 5*time.Second, "Polling interval")
+	fs.IntVar(&cfg.History, "history", 10, "Number of historical samples to keep")
+	fs.StringVar(&cfg.Report, "report", "", "Write a session report (targets, events, top movers, pinned/marked/noted series) to this file on exit, HTML if it ends in .html, else Markdown")
+	fs.BoolVar(&cfg.ShowMissing, "missing", false, "Show only the metric families absent from the last scrape but seen earlier or in the -baseline")
+	fs.Var(&cfg.Views, "view", "View preset for the keys 1-9 as '<name> <setting>=<value>...' with settings filter-metric, filter-label, select, label-mode, delta-mode, sort, column-window, column-agg, aggregate, totals, age, minmax, bars, derived, missing, graph (repeatable)")
+	fs.IntVar(&cfg.ColumnWindow, "column-window", 1, "Number of samples aggregated in each history column, to fit a longer -history on screen")
+	fs.StringVar(&cfg.ColumnAgg, "column-agg", ColumnAggLast, "Aggregation of the samples of a history column with -column-window: last, min, max, mean")
+	fs.StringVar(&cfg.Aggregate, "aggregate", AggregateOff, "Add <name>:sum or <name>:avg rows aggregating the series of several targets which only differ by the target labels: off, sum, avg")
+	fs.StringVar(&cfg.LabelMode, "label-mode", LabelModeShowAll, "Label display mode: all, hide-filtered, hide-all")
+	fs.StringVar(&cfg.Select, "select", "", "PromQL vector selector for the series to show, e.g. 'http_requests_total{code=~\"5..\",endpoint!=\"/health\"}'")
+	fs.StringVar(&cfg.FilterMetric, "filter-metric", "", "Regex to filter metrics by name (see also -select)")
+	fs.StringVar(&cfg.FilterLabel, "filter-label", "", "Filter metrics by label as key=value or key=~regex, the same as -select '{key=\"value\"}' (a bare regex matching any label value is deprecated)")
+	fs.Var(&cfg.Drop, "drop", "Regex of series names to drop when scraped, before they are stored, e.g. 'go_gc_.*' (anchored, repeatable); unlike -filter-metric they take no memory and cannot be shown")
+	fs.Var(&cfg.Transforms, "transform", "Shell command transforming the samples of each scrape, e.g. to rename, rescale or synthesize series: it gets them in the text format on stdin and writes the result to stdout in any -format (repeatable, applied in order)")
+	fs.StringVar(&cfg.DeltaMode, "delta-mode", DeltaModeOff, "Delta mode: off, next, view, ref (differences from a reference sample, the oldest unless set with r)")
+	fs.StringVar(&cfg.Density, "density", DensityNormal, "Display density: normal, compact")
+	fs.BoolVar(&cfg.HumanUnits, "human-units", false, "Format values using units inferred from metric names (e.g. 1.2 GiB, 350 ms)")
+	fs.BoolVar(&cfg.UnitRow, "unit-row", false, "Show the unit of each value column in a second header row; with -human-units and a unit shared by all shown series, the cells are scaled to it without suffixes")
+	fs.BoolVar(&cfg.ShowTotals, "totals", false, "Show a row with the sum of all displayed series")
+	fs.StringVar(&cfg.StripeMode, "stripes", StripeModeOff, "Alternate background shading: off, rows, columns")
+	fs.DurationVar(&cfg.UnfocusedInterval, "unfocused-interval", 0, "Slow polling to this interval while the terminal is unfocused, for terminals reporting focus (0 disables)")
+	fs.Var(&cfg.SLOs, "slo", "Success ratio to watch with its error budget burn rate as '<name> <objective %> <errors selector> / <total selector>', e.g. 'checkout 99.9 http_requests_total{code=~\"5..\"} / http_requests_total' (repeatable)")
+	fs.DurationVar(&cfg.SLOWindow, "slo-window", 5*time.Minute, "Sliding window of the -slo ratios, at most the history")
+	fs.Var(&cfg.Rules, "rules", "Prometheus rule file to preview: alerting and recording rules are evaluated on every scrape over the history, skipping those needing more (repeatable)")
+	fs.StringVar(&cfg.GRPCHealth, "grpc-health", "", "Also poll the standard gRPC health service at this host:port on every scrape and show its status in the footer")
+	fs.StringVar(&cfg.GRPCHealthService, "grpc-health-service", "", "Service to check with -grpc-health (empty for the overall server health)")
+	fs.BoolVar(&cfg.GRPCHealthTLS, "grpc-health-tls", false, "Use TLS for -grpc-health")
+	fs.DurationVar(&cfg.ZoomInterval, "zoom-interval", 250*time.Millisecond, "Polling interval for a zoomed series")
+	fs.IntVar(&cfg.ZoomHistory, "zoom-history", 120, "Number of samples to keep for a zoomed series")
+
+	fs.BoolVar(&cfg.Keys, "keys", false, "Print the keymap, with the keys of the -view presets and -bind bindings, as a cheat sheet and exit")
+	fs.BoolVar(&cfg.NoTUI, "no-tui", false, "Print to stdout on every interval instead of running the interactive UI")
+	fs.StringVar(&cfg.PlainFormat, "no-tui-format", PlainFormatTable, "Output format with -no-tui: table, diff (only changed values)")
+	fs.Var(&cfg.Asserts, "assert", "Condition to check on every scrape, e.g. 'http_requests_total{code=\"500\"} delta < 10' (repeatable)")
+	fs.DurationVar(&cfg.Duration, "for", 0, "Exit after this duration (0 runs until quit); with -assert, exits non-zero on the first violation")
+	fs.StringVar(&cfg.RemoteWriteURL, "remote-write-url", "", "Also push every scraped sample to this Prometheus remote_write endpoint (shorthand for -sink remote_write:<url>)")
+	fs.Var(&cfg.Sinks, "sink", "Also write every scrape to a sink given as kind:target, e.g. csv:samples.csv, jsonl:- (stdout, with -no-tui), sqlite:session.db, remote_write:<url> (repeatable)")
+	fs.StringVar(&cfg.SQLite, "sqlite", "", "Store every scraped sample in this SQLite database for SQL analysis or replay with the mock server (shorthand for -sink sqlite:<path>)")
+	fs.StringVar(&cfg.Serve, "serve", "", "Serve a read-only HTML view of the table on this address (e.g. :8099)")
+	fs.StringVar(&cfg.Share, "share", "", "Stream the view to read-only clients attached with 'attach' on this address, unix:<path> or tcp:<host:port> (e.g. unix:/tmp/omtui.sock)")
+	fs.StringVar(&cfg.GrafanaURL, "grafana-url", "", "Grafana to record findings in as annotations with F, e.g. https://grafana.example.com")
+	fs.StringVar(&cfg.GrafanaTokenFile, "grafana-token-file", "", "File with the Grafana API token for -grafana-url (default $GRAFANA_TOKEN)")
+	fs.StringVar(&cfg.GrafanaDashboard, "grafana-dashboard", "", "UID of the dashboard to annotate with -grafana-url (empty for an organization annotation)")
+	fs.Var(&cfg.GrafanaTags, "grafana-tag", "Tag of Grafana annotations, besides openmetrics-tui (repeatable)")
+	fs.StringVar(&cfg.Title, "title", "{{.Host}} {{.Status}}", "Terminal/tmux pane title template, e.g. '{{.Host}} {{.Delta \"http_requests_total{code=\\\"500\\\"}\"}}' (empty to disable)")
+	fs.Var(&cfg.MaxMemory, "max-memory", "Bound the memory used for history (e.g. 256MiB), evicting series and reducing history when exceeded")
+	fs.BoolVar(&cfg.UseTimestamps, "use-timestamps", false, "Honor exposition timestamps: repeated timestamps count as missing samples and series whose timestamps stop advancing are marked with ⏱")
+	fs.BoolVar(&cfg.EscapedNames, "escaped-names", false, "Show UTF-8 metric and label names in their legacy underscore-escaped form instead of quoted")
+	fs.StringVar(&cfg.GraphMode, "graph", GraphModeOff, "Braille trend graph before each metric name: off, braille, compact (only in compact density)")
+	fs.StringVar(&cfg.Pprof, "pprof", "", "Serve net/http/pprof profiling endpoints on this address (e.g. :6060)")
+	fs.StringVar(&cfg.Export, "export", "", "Write the collected history to this CSV file on exit")
+	fs.BoolVar(&cfg.Bars, "bars", false, "Show the current value of bounded gauges as a bar (bounds from -bound or _ratio/_percent names)")
+	fs.Var(&cfg.Bindings, "bind", "Run a shell command for the selected series on a key as '<key>=<command>', e.g. 'f2=kubectl describe pod \"$OMT_LABEL_pod\" | less', with the series in $OMT_METRIC, $OMT_LABELS, $OMT_LABEL_<name>, $OMT_SERIES, $OMT_VALUE, $OMT_PROMQL and $OMT_PROMQL_QUERY (repeatable)")
+	fs.Var(&cfg.Bounds, "bound", "Value range of gauges for -bars as '<name regex>=<min>:<max>', e.g. 'ratelimit_remaining=0:5000' (repeatable)")
+	fs.BoolVar(&cfg.Derived, "derived", false, "Show synthetic <name>:avg (average per interval) and <name>:count_rate (per second) rows for summaries and histograms")
+	fs.BoolVar(&cfg.MinMax, "minmax", false, "Mark the highest (red, underlined) and lowest (blue, underlined) value in each row's history")
+	fs.BoolVar(&cfg.ShowAge, "age", false, "Show a column with the time since each series appeared")
+	fs.StringVar(&cfg.SortMode, "sort", SortModeName, "Row order: name, age (youngest series first)")
+	fs.IntVar(&cfg.HighlightNew, "highlight-new", 3, "Highlight series appearing mid-session for this many scrapes (0 disables)")
+	fs.StringVar(&cfg.Baseline, "baseline", "", "History file written with -export to compare the current values against in a 'vs base' column")
+	fs.BoolVar(&cfg.Monochrome, "monochrome", os.Getenv("NO_COLOR") != "", "Use symbols and text attributes instead of colors (default when NO_COLOR is set)")
+}
+
+// validate checks the targets, mode settings and filter regexes, and sets
+// the URL summary.
+func (cfg *Config) validate() error {
+	targets, err := parseTargets(cfg.URLs)
+	if err != nil {
+		return err
+	}
+	cfg.URL = targetsSummary(targets)
+
+	if _, err := regexp.Compile(cfg.FilterMetric); err != nil {
+		return fmt.Errorf("invalid metric filter regex: %v", err)
+	}
+	if sel, err := filterLabelSelector(cfg.FilterLabel); err != nil {
+		return fmt.Errorf("invalid label filter: %v", err)
+	} else if sel == nil {
+		if _, err := regexp.Compile(cfg.FilterLabel); err != nil {
+			return fmt.Errorf("invalid label filter regex: %v", err)
+		}
+	}
+	if _, err := parseDrop(cfg.Drop); err != nil {
+		return err
+	}
+	if _, err := parseSLOs(cfg.SLOs); err != nil {
+		return err
+	}
+	if cfg.ZoomInterval <= 0 {
+		return errors.New("-zoom-interval must be positive")
+	}
+	if cfg.SLOWindow <= 0 {
+		return errors.New("-slo-window must be positive")
+	}
+
 	// Validate label mode
 	switch cfg.LabelMode {
 	case LabelModeShowAll, LabelModeHideFiltered, LabelModeHideAll:
 		// Valid mode
 	default:
-		fmt.Printf("Error: invalid label mode '%s'. Must be one of: all, hide-filtered, hide-all\n", cfg.LabelMode)
-		os.Exit(1)
+		return fmt.Errorf("invalid label mode '%s'. Must be one of: all, hide-filtered, hide-all", cfg.LabelMode)
 	}
 
 	// Validate delta mode
 	switch cfg.DeltaMode {
-	case DeltaModeOff, DeltaModeNext, DeltaModeView:
+	case DeltaModeOff, DeltaModeNext, DeltaModeView, DeltaModeRef:
 		// Valid mode
 	default:
-		fmt.Printf("Error: invalid delta mode '%s'. Must be one of: off, next, view\n", cfg.DeltaMode)
-		os.Exit(1)
+		return fmt.Errorf("invalid delta mode '%s'. Must be one of: off, next, view, ref", cfg.DeltaMode)
 	}
 
-	return cfg
+	// Validate stripe mode
+	switch cfg.StripeMode {
+	case StripeModeOff, StripeModeRows, StripeModeColumns:
+		// Valid mode
+	default:
+		return fmt.Errorf("invalid stripe mode '%s'. Must be one of: off, rows, columns", cfg.StripeMode)
+	}
+
+	// Validate exposition format
+	switch cfg.Format {
+	case FormatAuto, FormatText, FormatOpenMetrics, FormatProtobuf, FormatJSON:
+		// Valid format
+	default:
+		return fmt.Errorf("invalid format '%s'. Must be one of: auto, text, openmetrics, protobuf, json", cfg.Format)
+	}
+
+	// Validate plain output format
+	switch cfg.PlainFormat {
+	case PlainFormatTable, PlainFormatDiff:
+		// Valid format
+	default:
+		return fmt.Errorf("invalid no-tui format '%s'. Must be one of: table, diff", cfg.PlainFormat)
+	}
+
+	// Validate graph mode
+	switch cfg.GraphMode {
+	case GraphModeOff, GraphModeBraille, GraphModeCompact:
+		// Valid mode
+	default:
+		return fmt.Errorf("invalid graph mode '%s'. Must be one of: off, braille, compact", cfg.GraphMode)
+	}
+
+	// Validate sort mode
+	switch cfg.SortMode {
+	case SortModeName, SortModeAge:
+		// Valid mode
+	default:
+		return fmt.Errorf("invalid sort mode '%s'. Must be one of: name, age", cfg.SortMode)
+	}
+
+	// Validate column aggregation
+	switch cfg.ColumnAgg {
+	case ColumnAggLast, ColumnAggMin, ColumnAggMax, ColumnAggMean:
+		// Valid aggregation
+	default:
+		return fmt.Errorf("invalid column aggregation '%s'. Must be one of: last, min, max, mean", cfg.ColumnAgg)
+	}
+	if cfg.ColumnWindow < 1 {
+		return fmt.Errorf("invalid column window %d. Must be at least 1", cfg.ColumnWindow)
+	}
+
+	// Validate target aggregation
+	switch cfg.Aggregate {
+	case AggregateOff, AggregateSum, AggregateAvg:
+		// Valid aggregation
+	default:
+		return fmt.Errorf("invalid aggregate '%s'. Must be one of: off, sum, avg", cfg.Aggregate)
+	}
+
+	// Validate density
+	switch cfg.Density {
+	case DensityNormal, DensityCompact:
+		// Valid density
+	default:
+		return fmt.Errorf("invalid density '%s'. Must be one of: normal, compact", cfg.Density)
+	}
+
+	for _, spec := range cfg.Sinks {
+		// Writing to stdout would garble the interactive UI
+		if _, target, _ := strings.Cut(spec, ":"); target == "-" && !cfg.NoTUI {
+			return fmt.Errorf("-sink %s writes to stdout, which requires -no-tui", spec)
+		}
+	}
+
+	if cfg.Share != "" {
+		if cfg.NoTUI {
+			return errors.New("-share requires the interactive UI")
+		}
+		if _, _, err := parseShareAddr(cfg.Share); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func formatFloat(val float64) string {
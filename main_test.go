@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// benchModel returns a model with the default flags and a terminal of 200x50
+// showing the series of the store.
+func benchModel(b *testing.B, store *Store) model {
+	b.Helper()
+	var cfg Config
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	defineFlags(fs, &cfg)
+	if err := fs.Parse(nil); err != nil {
+		b.Fatal(err)
+	}
+	m := model{
+		cfg:               cfg,
+		store:             store,
+		fetcher:           NewScraper(nil),
+		fetches:           &inflight{},
+		rowCache:          newRowCache(),
+		aggregateCache:    newAggregateCache(),
+		seriesOrder:       &seriesOrder{},
+		notes:             make(map[string]string),
+		marked:            make(seriesSet),
+		pinned:            make(seriesSet),
+		hidden:            make(seriesSet),
+		collapsed:         make(map[string]bool),
+		width:             200,
+		height:            50,
+		metricNameStyle:   lipgloss.NewStyle(),
+		labelStyle:        lipgloss.NewStyle(),
+		currentValueStyle: lipgloss.NewStyle(),
+		deltaValueStyle:   lipgloss.NewStyle(),
+		selectedStyle:     lipgloss.NewStyle(),
+		totalsStyle:       lipgloss.NewStyle(),
+		newSeriesStyle:    lipgloss.NewStyle(),
+		maxValueStyle:     lipgloss.NewStyle(),
+		minValueStyle:     lipgloss.NewStyle(),
+		matchStyle:        lipgloss.NewStyle(),
+	}
+	m.viewport = viewport.New(m.width, m.height)
+	m.viewportReady = true
+	return m
+}
+
+func BenchmarkParse(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			body := benchExposition(n, 1)
+			b.SetBytes(int64(len(body)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				if _, err := parseExposition(body, FormatText); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkRefreshTable measures rendering the table after a scrape, which
+// renders the rows around the shown ones.
+func BenchmarkRefreshTable(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			store := NewStore(10)
+			for scrape := 1; scrape <= 10; scrape++ {
+				store.UpdateFromFamilies(benchFamilies(b, n, scrape))
+			}
+			m := benchModel(b, store)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				m.rowCache = newRowCache()
+				m.refreshTable()
+			}
+		})
+	}
+}
+
+// BenchmarkScrape measures a whole scrape: parsing the exposition, storing
+// the samples and rendering the table.
+func BenchmarkScrape(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			bodies := [][]byte{benchExposition(n, 1), benchExposition(n, 2)}
+			m := benchModel(b, NewStore(10))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := range b.N {
+				families, err := parseExposition(bodies[i%2], FormatText)
+				if err != nil {
+					b.Fatal(err)
+				}
+				m.store.UpdateFromFamilies(families)
+				m.refreshTable()
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// missingSeries returns the series of the metric families absent from the
+// latest successful scrape: those seen earlier in the session and those only
+// in the -baseline, which have no history.
+func (m model) missingSeries() []*MetricSeries {
+	var latest uint64
+	for _, series := range m.store.Metrics {
+		latest = max(latest, series.lastSeen)
+	}
+	present := make(map[string]bool)
+	for _, series := range m.store.Metrics {
+		if series.lastSeen == latest {
+			present[series.Name] = true
+		}
+	}
+
+	var missing []*MetricSeries
+	for _, series := range m.store.Metrics {
+		if !present[series.Name] {
+			missing = append(missing, series)
+		}
+	}
+	for sig := range m.baseline {
+		if _, ok := m.store.Metrics[sig]; ok {
+			continue
+		}
+		name, labels := parseSignature(sig)
+		if !present[name] {
+			missing = append(missing, &MetricSeries{Name: name, Labels: labels, sig: sig, sortKey: sig})
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].sortKey < missing[j].sortKey })
+	return missing
+}
+
+// parseSignature returns the name and labels of a series signature. Names
+// which are not valid in a PromQL selector are returned as is, without
+// labels.
+func parseSignature(sig string) (string, map[string]string) {
+	matchers, err := parser.ParseMetricSelector(sig)
+	if err != nil {
+		name, _, _ := strings.Cut(sig, "{")
+		return name, nil
+	}
+	var name string
+	res := make(map[string]string, len(matchers))
+	for _, matcher := range matchers {
+		if matcher.Name == labels.MetricName {
+			name = matcher.Value
+		} else {
+			res[matcher.Name] = matcher.Value
+		}
+	}
+	return name, res
+}
+
+// missingCache holds the missing family count between scrapes, as the
+// footer showing it is rendered on every frame.
+type missingCache struct {
+	key   missingKey
+	valid bool
+	count int
+}
+
+type missingKey struct {
+	scrapes uint64
+	stored  int // Series in the store, which drop with evictions
+}
+
+// missingCount returns the number of metric families absent from the latest
+// scrape, for the footer.
+func (m model) missingCount() int {
+	c := m.missingCache
+	key := missingKey{scrapes: m.store.scrapes, stored: len(m.store.Metrics)}
+	if c != nil && c.valid && c.key == key {
+		return c.count
+	}
+	names := make(map[string]bool)
+	for _, series := range m.missingSeries() {
+		names[series.Name] = true
+	}
+	if c != nil {
+		*c = missingCache{key: key, valid: true, count: len(names)}
+	}
+	return len(names)
+}
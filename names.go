@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strconv"
+
+	promModel "github.com/prometheus/common/model"
+)
+
+// displayName returns a metric (or, with label, a label) name for display.
+// Names which are not valid legacy Prometheus names are quoted as in the
+// UTF-8 exposition format, or with escaped shown in their legacy
+// underscore-escaped form.
+func displayName(name string, label, escaped bool) string {
+	valid := promModel.IsValidLegacyMetricName(name)
+	if label {
+		valid = promModel.LabelName(name).IsValidLegacy()
+	}
+	if valid {
+		return name
+	}
+	if escaped {
+		return escapeName(name)
+	}
+	return strconv.Quote(name)
+}
+
+// escapeName returns the legacy underscore-escaped form of a name.
+func escapeName(name string) string {
+	return promModel.EscapeName(name, promModel.UnderscoreEscaping)
+}
+
+// nameMatches reports whether name equals want in its UTF-8 or escaped form.
+func nameMatches(name, want string) bool {
+	return name == want || escapeName(name) == want
+}
+
+// labelValue looks up a label by its UTF-8 or escaped name.
+func labelValue(labels map[string]string, name string) (string, bool) {
+	if v, ok := labels[name]; ok {
+		return v, true
+	}
+	for k, v := range labels {
+		if escapeName(k) == name {
+			return v, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxNoteLength bounds the length of a series note.
+const maxNoteLength = 120
+
+// startNote opens the prompt to edit the note of the selected series.
+func (m model) startNote() (tea.Model, tea.Cmd) {
+	series := m.selectedSeries()
+	if series == nil {
+		return m, nil
+	}
+	m.noteSig = series.signature()
+	m.noteInput = textinput.New()
+	m.noteInput.Prompt = "note: "
+	m.noteInput.Placeholder = "e.g. spiked at 14:02 after deploy (empty to remove)"
+	m.noteInput.CharLimit = maxNoteLength
+	m.noteInput.SetValue(m.notes[m.noteSig])
+	m.noteActive = true
+	return m, m.noteInput.Focus()
+}
+
+// updateNote handles key presses while the note prompt is open.
+func (m model) updateNote(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "ctrl+c":
+		m.noteActive = false
+		return m, nil
+	case "enter":
+		m.noteActive = false
+		if note := strings.TrimSpace(m.noteInput.Value()); note != "" {
+			m.notes[m.noteSig] = note
+		} else {
+			delete(m.notes, m.noteSig)
+		}
+		if m.viewportReady {
+			m.refreshTable()
+		}
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.noteInput, cmd = m.noteInput.Update(msg)
+	return m, cmd
+}
+
+// writeNotes prints the notes made during the session by series signature,
+// so they are not lost with the terminal.
+func writeNotes(w io.Writer, notes map[string]string) {
+	sigs := make([]string, 0, len(notes))
+	for sig := range notes {
+		sigs = append(sigs, sig)
+	}
+	sort.Strings(sigs)
+	for _, sig := range sigs {
+		fmt.Fprintf(w, "%s: %s\n", sig, notes[sig])
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Plain output format constants
+const (
+	PlainFormatTable = "table"
+	PlainFormatDiff  = "diff"
+)
+
+// plainWidth is the table width used in plain mode, wide enough to show all
+// history columns since there is no terminal to fit.
+const plainWidth = 1 << 16
+
+// runPlain polls the endpoint and writes the table, or the values that
+// changed, to w on every interval instead of running the full-screen TUI. It
+// returns when the configured duration has elapsed, or never if none is set.
+func runPlain(m model, w io.Writer) {
+	m.width = plainWidth
+	m.cursor = -1 // No row selection in plain mode
+
+	var deadline <-chan time.Time
+	if m.cfg.Duration > 0 {
+		deadline = time.After(m.cfg.Duration)
+	}
+
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		timestamp := time.Now().Format(time.RFC3339)
+		families, err := m.fetcher.Fetch()
+		if err != nil {
+			fmt.Fprintf(w, "%s error: %v\n", timestamp, err)
+		}
+		// Families are returned along with the error if only some targets failed
+		if families != nil {
+			previous := m.currentValues()
+			m.store.UpdateFromFamilies(families)
+			if !m.sinks.empty() {
+				if _, err := m.sinks.Write(families, time.Now()); err != nil {
+					fmt.Fprintf(w, "%s error: %v\n", timestamp, err)
+				}
+			}
+
+			m.publishWebView()
+
+			switch m.cfg.PlainFormat {
+			case PlainFormatDiff:
+				m.writeChanges(w, timestamp, previous)
+			default:
+				fmt.Fprintf(w, "%s %s\n%s\n", timestamp, m.cfg.URL, m.buildTable())
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			return
+		}
+	}
+}
+
+// currentValues returns the most recent value of every visible series.
+func (m model) currentValues() map[*MetricSeries]float64 {
+	values := make(map[*MetricSeries]float64)
+	for _, series := range m.visibleSeries() {
+		if len(series.Values) > 0 {
+			values[series] = series.Values[len(series.Values)-1]
+		}
+	}
+	return values
+}
+
+// writeChanges writes one line per visible series whose current value differs
+// from the previous scrape.
+func (m model) writeChanges(w io.Writer, timestamp string, previous map[*MetricSeries]float64) {
+	for _, series := range m.visibleSeries() {
+		if len(series.Values) == 0 {
+			continue
+		}
+		curr := series.Values[len(series.Values)-1]
+		prev, seen := previous[series]
+		if seen && (curr == prev || (math.IsNaN(curr) && math.IsNaN(prev))) {
+			continue
+		}
+
+		name := formatMetricName(series, m.cfg.LabelMode == LabelModeHideAll)
+		switch {
+		case !seen:
+			fmt.Fprintf(w, "%s %s new %s\n", timestamp, name, m.formatValue(series.Unit, curr))
+		case math.IsNaN(curr):
+			fmt.Fprintf(w, "%s %s missing\n", timestamp, name)
+		case math.IsNaN(prev):
+			fmt.Fprintf(w, "%s %s %s\n", timestamp, name, m.formatValue(series.Unit, curr))
+		default:
+			delta := m.formatValue(series.Unit, curr-prev)
+			if curr > prev {
+				delta = "+" + delta
+			}
+			fmt.Fprintf(w, "%s %s %s -> %s (%s)\n", timestamp, name,
+				m.formatValue(series.Unit, prev), m.formatValue(series.Unit, curr), delta)
+		}
+	}
+}
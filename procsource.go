@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/procfs"
+)
+
+// procScheme is the URL scheme of local process targets, e.g. proc://1234,
+// added with -pid.
+const procScheme = "proc"
+
+// procURL returns the target URL of a local process.
+func procURL(pid string) (string, error) {
+	if _, err := strconv.Atoi(pid); err != nil {
+		return "", fmt.Errorf("invalid pid '%s'", pid)
+	}
+	return procScheme + "://" + pid, nil
+}
+
+// procPID returns the process id of a proc:// target URL.
+func procPID(rawURL string) (int, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != procScheme {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(u.Host)
+	return pid, err == nil
+}
+
+// fetchProc returns the CPU, memory, file descriptor, socket and thread
+// statistics of a local process from /proc, named like those of the process
+// collector of the Prometheus client libraries. File descriptors are omitted
+// if they can not be read, e.g. for processes of other users.
+func fetchProc(ctx context.Context, pid int) (map[string]*dto.MetricFamily, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p, err := procfs.NewProc(pid)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := p.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	families := make(map[string]*dto.MetricFamily)
+	add := func(name, help string, kind dto.MetricType, v float64) {
+		metric := &dto.Metric{}
+		if kind == dto.MetricType_COUNTER {
+			metric.Counter = &dto.Counter{Value: &v}
+		} else {
+			metric.Gauge = &dto.Gauge{Value: &v}
+		}
+		families[name] = &dto.MetricFamily{Name: &name, Help: &help, Type: kind.Enum(), Metric: []*dto.Metric{metric}}
+	}
+	add("process_cpu_seconds_total", "Total user and system CPU time spent in seconds.", dto.MetricType_COUNTER, stat.CPUTime())
+	add("process_resident_memory_bytes", "Resident memory size in bytes.", dto.MetricType_GAUGE, float64(stat.ResidentMemory()))
+	add("process_virtual_memory_bytes", "Virtual memory size in bytes.", dto.MetricType_GAUGE, float64(stat.VirtualMemory()))
+	add("process_threads", "Number of OS threads.", dto.MetricType_GAUGE, float64(stat.NumThreads))
+	if start, err := stat.StartTime(); err == nil {
+		add("process_start_time_seconds", "Start time of the process since unix epoch in seconds.", dto.MetricType_GAUGE, start)
+	}
+	if fds, err := p.FileDescriptorTargets(); err == nil {
+		sockets := 0
+		for _, fd := range fds {
+			if strings.HasPrefix(fd, "socket:") {
+				sockets++
+			}
+		}
+		add("process_open_fds", "Number of open file descriptors.", dto.MetricType_GAUGE, float64(len(fds)))
+		add("process_open_sockets", "Number of open sockets.", dto.MetricType_GAUGE, float64(sockets))
+	}
+	if limits, err := p.Limits(); err == nil && limits.OpenFiles > 0 {
+		add("process_max_fds", "Maximum number of open file descriptors.", dto.MetricType_GAUGE, float64(limits.OpenFiles))
+	}
+	return families, nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// promScrapeConfig is the part of a Prometheus scrape config used to find
+// the targets of a job and how to scrape them.
+type promScrapeConfig struct {
+	JobName       string              `yaml:"job_name"`
+	Scheme        string              `yaml:"scheme"`
+	MetricsPath   string              `yaml:"metrics_path"`
+	Params        map[string][]string `yaml:"params"`
+	BasicAuth     *promBasicAuth      `yaml:"basic_auth"`
+	Authorization *promAuthorization  `yaml:"authorization"`
+	// Deprecated in Prometheus, but still common
+	BearerToken     string `yaml:"bearer_token"`
+	BearerTokenFile string `yaml:"bearer_token_file"`
+	StaticConfigs   []struct {
+		Targets []string          `yaml:"targets"`
+		Labels  map[string]string `yaml:"labels"`
+	} `yaml:"static_configs"`
+}
+
+type promBasicAuth struct {
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"password_file"`
+}
+
+type promAuthorization struct {
+	Type            string `yaml:"type"`
+	Credentials     string `yaml:"credentials"`
+	CredentialsFile string `yaml:"credentials_file"`
+}
+
+// loadPromConfig adds the static targets of the -job in the -prom-config
+// file to the -url values, and records their auth. The job may be omitted
+// if the file has only one.
+func (cfg *Config) loadPromConfig() error {
+	if cfg.PromConfig == "" {
+		if cfg.PromJob != "" {
+			return fmt.Errorf("-job requires -prom-config")
+		}
+		return nil
+	}
+	specs, auth, err := promTargets(cfg.PromConfig, cfg.PromJob)
+	if err != nil {
+		return fmt.Errorf("%s: %v", cfg.PromConfig, err)
+	}
+	cfg.URLs = append(cfg.URLs, specs...)
+	cfg.targetAuth = auth
+	return nil
+}
+
+// promTargets returns the static targets of a job in a Prometheus
+// configuration file as -url values, and the auth of each by URL. Like
+// Prometheus, it adds an instance label if the job has several targets.
+func promTargets(path, job string) ([]string, map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var file struct {
+		ScrapeConfigs []promScrapeConfig `yaml:"scrape_configs"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, nil, err
+	}
+	sc, err := findPromJob(file.ScrapeConfigs, job)
+	if err != nil {
+		return nil, nil, err
+	}
+	auth, err := sc.auth(filepath.Dir(path))
+	if err != nil {
+		return nil, nil, fmt.Errorf("job '%s': %v", sc.JobName, err)
+	}
+
+	var addresses int
+	for _, static := range sc.StaticConfigs {
+		addresses += len(static.Targets)
+	}
+	if addresses == 0 {
+		return nil, nil, fmt.Errorf("job '%s' has no static targets", sc.JobName)
+	}
+	u := url.URL{Scheme: sc.Scheme, Path: sc.MetricsPath, RawQuery: url.Values(sc.Params).Encode()}
+	if u.Scheme == "" {
+		u.Scheme = "http"
+	}
+	if u.Path == "" {
+		u.Path = "/metrics"
+	}
+	var specs []string
+	auths := make(map[string]string)
+	for _, static := range sc.StaticConfigs {
+		names := make([]string, 0, len(static.Labels))
+		for name := range static.Labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, address := range static.Targets {
+			u.Host = address
+			spec := []string{u.String()}
+			for _, name := range names {
+				spec = append(spec, name+"="+static.Labels[name])
+			}
+			if addresses > 1 && static.Labels["instance"] == "" {
+				spec = append(spec, "instance="+address)
+			}
+			specs = append(specs, strings.Join(spec, ";"))
+			if auth != "" {
+				auths[u.String()] = auth
+			}
+		}
+	}
+	return specs, auths, nil
+}
+
+// findPromJob returns the scrape config of a job, or the only one if job
+// is empty.
+func findPromJob(configs []promScrapeConfig, job string) (promScrapeConfig, error) {
+	var names []string
+	for _, sc := range configs {
+		if sc.JobName == job || (job == "" && len(configs) == 1) {
+			return sc, nil
+		}
+		names = append(names, sc.JobName)
+	}
+	if job == "" {
+		return promScrapeConfig{}, fmt.Errorf("-job is required, jobs are: %s", strings.Join(names, ", "))
+	}
+	return promScrapeConfig{}, fmt.Errorf("no job '%s', jobs are: %s", job, strings.Join(names, ", "))
+}
+
+// auth returns the auth of the scrape config as for Target.Auth. Files are
+// relative to dir, the directory of the configuration file.
+func (sc promScrapeConfig) auth(dir string) (string, error) {
+	readSecret := func(secret, file string) (string, error) {
+		if file == "" {
+			return secret, nil
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		data, err := os.ReadFile(file)
+		return strings.TrimSpace(string(data)), err
+	}
+	switch {
+	case sc.BasicAuth != nil:
+		password, err := readSecret(sc.BasicAuth.Password, sc.BasicAuth.PasswordFile)
+		return sc.BasicAuth.Username + ":" + password, err
+	case sc.Authorization != nil:
+		if sc.Authorization.Type != "" && !strings.EqualFold(sc.Authorization.Type, "Bearer") {
+			return "", fmt.Errorf("authorization type '%s' is not supported", sc.Authorization.Type)
+		}
+		return readSecret(sc.Authorization.Credentials, sc.Authorization.CredentialsFile)
+	}
+	return readSecret(sc.BearerToken, sc.BearerTokenFile)
+}
+
+// withAuth returns the targets with the auth recorded for their URLs.
+func withAuth(targets []Target, auth map[string]string) []Target {
+	for i := range targets {
+		if a, ok := auth[targets[i].URL]; ok {
+			targets[i].Auth = a
+		}
+	}
+	return targets
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/muesli/termenv"
+	dto "github.com/prometheus/client_model/go"
+	promModel "github.com/prometheus/common/model"
+)
+
+// promQLRange is the range used for rate() in generated queries.
+const promQLRange = "5m"
+
+// promQLSelector returns the vector selector matching exactly a series,
+// leaving out the labels in skip. UTF-8 metric names are quoted inside the
+// braces as PromQL requires.
+func promQLSelector(name string, labels map[string]string, skip ...string) string {
+	var matchers []string
+	if !promModel.IsValidLegacyMetricName(name) {
+		matchers = append(matchers, strconv.Quote(name))
+		name = ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		if !slices.Contains(skip, k) {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		matchers = append(matchers, displayName(k, true, false)+"="+strconv.Quote(labels[k]))
+	}
+	if len(matchers) == 0 {
+		return name
+	}
+	return name + "{" + strings.Join(matchers, ", ") + "}"
+}
+
+// promQLFor builds a query for a series: the 99th percentile of classic
+// histogram buckets, the rate of counters, the equivalent of derived series
+// and the plain selector otherwise.
+func promQLFor(series *MetricSeries) string {
+	if base, ok := strings.CutSuffix(series.Name, derivedAvgSuffix); ok && series.Derived {
+		return "rate(" + promQLSelector(base+"_sum", series.Labels) + "[" + promQLRange + "]) / rate(" + promQLSelector(base+"_count", series.Labels) + "[" + promQLRange + "])"
+	}
+	if base, ok := strings.CutSuffix(series.Name, derivedCountRateSuffix); ok && series.Derived {
+		return "rate(" + promQLSelector(base+"_count", series.Labels) + "[" + promQLRange + "])"
+	}
+	if _, ok := series.Labels["le"]; ok && strings.HasSuffix(series.Name, "_bucket") {
+		return "histogram_quantile(0.99, sum by (le) (rate(" + promQLSelector(series.Name, series.Labels, "le") + "[" + promQLRange + "])))"
+	}
+	if series.Type == dto.MetricType_COUNTER || strings.HasSuffix(series.Name, "_total") {
+		return "rate(" + promQLSelector(series.Name, series.Labels) + "[" + promQLRange + "])"
+	}
+	return promQLSelector(series.Name, series.Labels)
+}
+
+// copyPromQL copies the query for the selected series to the clipboard using
+// OSC 52 and keeps it for printing on exit, as not all terminals support
+// clipboard access.
+func (m model) copyPromQL() model {
+	series := m.selectedSeries()
+	if series == nil {
+		return m
+	}
+	query := promQLFor(series)
+	termenv.Copy(query)
+	m.queries = append(m.queries, query)
+	m.notice = "Copied: " + query
+	return m
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// RemoteWriter pushes scraped samples to a Prometheus remote_write endpoint
+// using the 1.0 protocol (snappy-compressed protobuf WriteRequest).
+type RemoteWriter struct {
+	URL    string
+	client *http.Client
+}
+
+func init() {
+	RegisterSink("remote_write", func(target string) (Sink, error) {
+		if target == "" {
+			return nil, fmt.Errorf("missing URL")
+		}
+		return NewRemoteWriter(target), nil
+	})
+}
+
+func NewRemoteWriter(url string) *RemoteWriter {
+	return &RemoteWriter{
+		URL: url,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// Write pushes all simple samples of a scrape, timestamped with the scrape time.
+func (r *RemoteWriter) Write(families map[string]*dto.MetricFamily, scrapeTime time.Time) error {
+	body := snappy.Encode(nil, encodeWriteRequest(families, scrapeTime.UnixMilli()))
+
+	req, err := http.NewRequest(http.MethodPost, r.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("remote write: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func (r *RemoteWriter) Close() error {
+	return nil
+}
+
+// encodeWriteRequest encodes a prometheus.WriteRequest message:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(families map[string]*dto.MetricFamily, timestamp int64) []byte {
+	var req []byte
+	forEachSample(families, func(_, name, _ string, labels map[string]string, value float64) {
+		// Labels must be sorted by name, __name__ sorts first
+		names := make([]string, 0, len(labels))
+		for k := range labels {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		var ts []byte
+		ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, encodeLabel("__name__", name))
+		for _, k := range names {
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, encodeLabel(k, labels[k]))
+		}
+
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(timestamp))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	})
+	return req
+}
+
+func encodeLabel(name, value string) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, name)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, value)
+	return b
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	htmltemplate "html/template"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// reportTopMovers is the number of series listed as top movers in a report.
+const reportTopMovers = 10
+
+// report summarizes a session for attaching to e.g. an incident ticket.
+type report struct {
+	Targets   []string
+	Started   time.Time
+	Ended     time.Time
+	Duration  time.Duration
+	Scrapes   uint64
+	Failures  uint64
+	Events    []reportEvent
+	TopMovers []reportMover
+	Series    []reportSeries
+	Columns   []string // History column titles, oldest first
+}
+
+type reportEvent struct {
+	Time string
+	Text string
+	Warn bool
+}
+
+type reportMover struct {
+	Series      string
+	First, Last string
+	Change      string
+}
+
+type reportSeries struct {
+	Series string
+	Note   string
+	Values []string // Right-aligned to Columns, empty if missing
+}
+
+var reportFuncs = template.FuncMap{"join": strings.Join}
+
+var markdownReport = template.Must(template.New("md").Funcs(reportFuncs).Parse(`# Metrics session report
+
+- Targets: {{join .Targets ", "}}
+- Session: {{.Started.Format "2006-01-02 15:04:05"}} - {{.Ended.Format "15:04:05"}} ({{.Duration}})
+- Scrapes: {{.Scrapes}} ({{.Failures}} failed)
+
+## Events
+{{if .Events}}
+| Time | Event |
+|------|-------|
+{{range .Events}}| {{.Time}} | {{if .Warn}}⚠ {{end}}{{.Text}} |
+{{end}}{{else}}
+None.
+{{end}}
+## Top movers
+{{if .TopMovers}}
+| Series | First | Last | Change |
+|--------|-------|------|--------|
+{{range .TopMovers}}| ` + "`{{.Series}}`" + ` | {{.First}} | {{.Last}} | {{.Change}} |
+{{end}}{{else}}
+None.
+{{end}}
+## Series
+{{range .Series}}
+### ` + "`{{.Series}}`" + `
+{{if .Note}}
+> {{.Note}}
+{{end}}
+| {{join $.Columns " | "}} |
+|{{range $.Columns}}---|{{end}}
+| {{join .Values " | "}} |
+{{else}}
+None selected.
+{{end}}`))
+
+var htmlReport = htmltemplate.Must(htmltemplate.New("html").Funcs(htmltemplate.FuncMap(reportFuncs)).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Metrics session report</title>
+<style>body{font-family:sans-serif}table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:2px 6px;text-align:right}td:first-child{text-align:left}code{font-size:90%}.warn{color:#c00}</style>
+</head><body>
+<h1>Metrics session report</h1>
+<ul>
+<li>Targets: {{join .Targets ", "}}</li>
+<li>Session: {{.Started.Format "2006-01-02 15:04:05"}} - {{.Ended.Format "15:04:05"}} ({{.Duration}})</li>
+<li>Scrapes: {{.Scrapes}} ({{.Failures}} failed)</li>
+</ul>
+<h2>Events</h2>
+{{if .Events}}<table><tr><th>Time</th><th>Event</th></tr>
+{{range .Events}}<tr><td>{{.Time}}</td><td{{if .Warn}} class="warn"{{end}}>{{.Text}}</td></tr>
+{{end}}</table>{{else}}<p>None.</p>{{end}}
+<h2>Top movers</h2>
+{{if .TopMovers}}<table><tr><th>Series</th><th>First</th><th>Last</th><th>Change</th></tr>
+{{range .TopMovers}}<tr><td><code>{{.Series}}</code></td><td>{{.First}}</td><td>{{.Last}}</td><td>{{.Change}}</td></tr>
+{{end}}</table>{{else}}<p>None.</p>{{end}}
+<h2>Series</h2>
+{{range .Series}}<h3><code>{{.Series}}</code></h3>
+{{if .Note}}<blockquote>{{.Note}}</blockquote>{{end}}
+<table><tr>{{range $.Columns}}<th>{{.}}</th>{{end}}</tr>
+<tr>{{range .Values}}<td>{{.}}</td>{{end}}</tr></table>
+{{else}}<p>None selected.</p>{{end}}
+</body></html>
+`))
+
+// buildReport summarizes the session. The series histories included are
+// those pinned, marked or with a note, or else the selected one.
+func (m model) buildReport() report {
+	r := report{
+		Targets:  m.cfg.URLs,
+		Started:  m.started,
+		Ended:    time.Now(),
+		Scrapes:  m.store.scrapes,
+		Failures: m.store.failures,
+	}
+	r.Duration = r.Ended.Sub(r.Started).Round(time.Second)
+	for _, e := range m.events {
+		r.Events = append(r.Events, reportEvent{Time: e.time.Format("15:04:05"), Text: e.text, Warn: e.warn})
+	}
+
+	type mover struct {
+		sig         string
+		first, last float64
+		change      float64
+	}
+	var movers []mover
+	for sig, series := range m.store.Metrics {
+		first, last := math.NaN(), math.NaN()
+		for _, v := range series.Values {
+			if !math.IsNaN(v) {
+				if math.IsNaN(first) {
+					first = v
+				}
+				last = v
+			}
+		}
+		if math.IsNaN(first) || first == last {
+			continue
+		}
+		change := math.Inf(1)
+		if first != 0 {
+			change = (last - first) / math.Abs(first)
+		}
+		movers = append(movers, mover{sig, first, last, change})
+	}
+	sort.Slice(movers, func(i, j int) bool {
+		if a, b := math.Abs(movers[i].change), math.Abs(movers[j].change); a != b {
+			return a > b
+		}
+		return movers[i].sig < movers[j].sig
+	})
+	for _, mv := range movers[:min(len(movers), reportTopMovers)] {
+		change := "from 0"
+		if !math.IsInf(mv.change, 0) {
+			change = formatFloat(mv.change*100) + "%"
+		}
+		r.TopMovers = append(r.TopMovers, reportMover{Series: mv.sig, First: formatFloat(mv.first), Last: formatFloat(mv.last), Change: change})
+	}
+
+	for i := m.store.HistoryLimit - 1; i > 0; i-- {
+		r.Columns = append(r.Columns, ageTitle(m.store, i, m.cfg.Interval))
+	}
+	r.Columns = append(r.Columns, "Curr")
+	for _, sig := range m.reportSignatures() {
+		series, ok := m.store.Metrics[sig]
+		if !ok {
+			continue
+		}
+		values := make([]string, len(r.Columns))
+		offset := len(values) - len(series.Values)
+		for i, v := range series.Values {
+			if offset+i >= 0 && !math.IsNaN(v) {
+				values[offset+i] = formatFloat(v)
+			}
+		}
+		r.Series = append(r.Series, reportSeries{Series: sig, Note: m.notes[sig], Values: values})
+	}
+	return r
+}
+
+// reportSignatures returns the signatures of the series to include in a
+// report, sorted.
+func (m model) reportSignatures() []string {
+	set := make(seriesSet)
+	for _, s := range []seriesSet{m.pinned, m.marked} {
+		for sig := range s {
+			set[sig] = true
+		}
+	}
+	for sig := range m.notes {
+		set[sig] = true
+	}
+	if len(set) == 0 {
+		if series := m.selectedSeries(); series != nil {
+			set[series.signature()] = true
+		}
+	}
+	sigs := make([]string, 0, len(set))
+	for sig := range set {
+		sigs = append(sigs, sig)
+	}
+	sort.Strings(sigs)
+	return sigs
+}
+
+// writeReport writes the report as HTML if path ends in .html or .htm, and as
+// Markdown otherwise.
+func writeReport(r report, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := renderReport(f, r, path); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func renderReport(w io.Writer, r report, path string) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		return htmlReport.Execute(w, r)
+	}
+	return markdownReport.Execute(w, r)
+}
+
+// writeReportNow writes a report to the -report file, or a file named after
+// the current time, on request during the session.
+func (m model) writeReportNow() model {
+	path := m.cfg.Report
+	if path == "" {
+		path = "openmetrics-report-" + time.Now().Format("20060102-150405") + ".md"
+	}
+	if err := writeReport(m.buildReport(), path); err != nil {
+		m.notice = "Report failed: " + err.Error()
+	} else {
+		m.notice = "Report written to " + path
+	}
+	return m
+}
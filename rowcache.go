@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// rowCacheKey holds everything besides the series values that a rendered
+// table row depends on. A cached row is reused only if the key is unchanged.
+type rowCacheKey struct {
+	version    uint64 // MetricSeries.version the row was rendered from
+	stripe     bool   // Odd row, for row stripes
+	selected   bool
+	labelMode  string
+	filter     string
+	deltaMode  string
+	refScrape  uint64 // Reference of the ref delta mode
+	history    int
+	humanUnits bool
+	colUnits   string // Scales of the unit row, see columnUnits
+	stripeMode string
+	escaped    bool
+	graph      bool
+	age        bool
+	minMax     bool
+	bars       bool
+	noted      bool
+	colWindow  int
+	colAgg     string
+	highlight  string // Metric filter and goto query, see renderMatches
+	marked     bool
+	pinned     bool
+}
+
+type cachedRow struct {
+	key   rowCacheKey
+	cells []string
+}
+
+// rowCache keeps the rendered cells of each series between renders so only
+// rows whose values or display settings changed are styled again.
+type rowCache struct {
+	rows map[*MetricSeries]cachedRow
+
+	// Column widths seen since the display settings last changed
+	widths    []int
+	widthsKey rowCacheKey
+}
+
+func newRowCache() *rowCache {
+	return &rowCache{rows: make(map[*MetricSeries]cachedRow)}
+}
+
+// rowKeyBase returns the display settings part of the row keys, which is
+// the same for all rows of a render.
+func (m model) rowKeyBase() rowCacheKey {
+	return rowCacheKey{
+		labelMode:  m.cfg.LabelMode,
+		filter:     m.cfg.FilterLabel + "\x00" + m.cfg.Select,
+		deltaMode:  m.cfg.DeltaMode,
+		refScrape:  m.refScrape,
+		history:    m.cfg.History,
+		humanUnits: m.cfg.HumanUnits,
+		colUnits:   fmt.Sprint(m.colUnits),
+		stripeMode: m.cfg.StripeMode,
+		escaped:    m.cfg.EscapedNames,
+		graph:      m.showGraph(),
+		age:        m.cfg.ShowAge,
+		minMax:     m.cfg.MinMax,
+		bars:       m.cfg.Bars,
+		colWindow:  m.cfg.ColumnWindow,
+		colAgg:     m.cfg.ColumnAgg,
+		highlight:  m.cfg.FilterMetric + "\x00" + m.gotoQuery,
+	}
+}
+
+// rowKey returns the key of a row from the base key of the render.
+func (m model) rowKey(base rowCacheKey, rowIdx int, series *MetricSeries) rowCacheKey {
+	sig := series.signature()
+	key := base
+	key.version = series.version
+	key.stripe = rowIdx%2 == 1
+	key.selected = rowIdx == m.cursor
+	key.noted = m.notes[sig] != ""
+	key.marked = m.marked[sig]
+	key.pinned = m.pinned[sig]
+	return key
+}
+
+// render returns the rows for the given series, rendering only those not
+// found in the cache. Series no longer rendered are dropped from the cache.
+func (c *rowCache) render(m model, series []*MetricSeries, firstRow int) [][]string {
+	rows := make([][]string, len(series))
+	next := make(map[*MetricSeries]cachedRow, len(series))
+	base := m.rowKeyBase()
+	for i, s := range series {
+		rowIdx := firstRow + i
+		key := m.rowKey(base, rowIdx, s)
+		cached, ok := c.rows[s]
+		if !ok || cached.key != key {
+			cached = cachedRow{key: key, cells: m.buildTableRow(rowIdx, s)}
+		}
+		next[s] = cached
+		rows[i] = cached.cells
+	}
+	c.rows = next
+	return rows
+}
+
+// stickyWidths returns the maximum of the given column widths and those of
+// earlier renders with the same display settings.
+func (c *rowCache) stickyWidths(m model, widths []int) []int {
+	key := rowCacheKey{
+		labelMode:  m.cfg.LabelMode,
+		filter:     m.cfg.FilterLabel + "\x00" + m.cfg.FilterMetric + "\x00" + m.cfg.Select,
+		deltaMode:  m.cfg.DeltaMode,
+		history:    m.cfg.History,
+		humanUnits: m.cfg.HumanUnits,
+		colUnits:   fmt.Sprint(m.colUnits),
+		escaped:    m.cfg.EscapedNames,
+		graph:      m.showGraph(),
+		colWindow:  m.cfg.ColumnWindow,
+		colAgg:     m.cfg.ColumnAgg,
+	}
+	if key != c.widthsKey || len(widths) != len(c.widths) {
+		c.widthsKey = key
+		c.widths = make([]int, len(widths))
+	}
+	for i, w := range widths {
+		c.widths[i] = max(c.widths[i], w)
+	}
+	return slices.Clone(c.widths)
+}
@@ -0,0 +1,579 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// lookbackDelta is how far back a vector selector looks for the newest
+// sample of a series, as in Prometheus.
+const lookbackDelta = 5 * time.Minute
+
+// promSample is an element of an instant vector. The labels include the
+// metric name as __name__ unless an operation dropped it.
+type promSample struct {
+	labels map[string]string
+	value  float64
+}
+
+type promVector []promSample
+
+// promValue is the result of an expression: a vector, or a scalar if
+// scalar is set.
+type promValue struct {
+	vector promVector
+	scalar bool
+	value  float64
+}
+
+// ruleEval evaluates the subset of PromQL which can be computed from the
+// history of the store, without a TSDB, see checkSupported. Range
+// functions only see the samples in the history. Rates are computed over the
+// samples in the range and extrapolated linearly to it, a simplification of
+// the extrapolation of Prometheus.
+type ruleEval struct {
+	store    *Store
+	now      time.Time
+	recorded map[string]promVector // Results of the recording rules evaluated so far, by name
+}
+
+// rangeFunctions are the supported functions taking a range vector.
+var rangeFunctions = map[string]bool{
+	"rate": true, "irate": true, "increase": true, "delta": true, "idelta": true, "changes": true,
+	"avg_over_time": true, "min_over_time": true, "max_over_time": true,
+	"sum_over_time": true, "count_over_time": true, "last_over_time": true,
+}
+
+// instantFunctions are the supported functions of instant vectors and
+// scalars.
+var instantFunctions = map[string]bool{
+	"abs": true, "ceil": true, "floor": true, "clamp_min": true, "clamp_max": true,
+	"time": true, "vector": true, "scalar": true,
+}
+
+// checkSupported returns why an expression cannot be evaluated from a
+// history covering window, or nil if it can.
+func checkSupported(expr parser.Expr, window time.Duration) error {
+	var err error
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.VectorSelector:
+			if n.OriginalOffset != 0 || n.Timestamp != nil || n.StartOrEnd != 0 {
+				err = fmt.Errorf("offset and @ modifiers are not supported")
+			}
+		case *parser.MatrixSelector:
+			if n.Range > window {
+				err = fmt.Errorf("range %s exceeds the history of %s", n.Range, window)
+			}
+		case *parser.Call:
+			if !rangeFunctions[n.Func.Name] && !instantFunctions[n.Func.Name] {
+				err = fmt.Errorf("function %s() is not supported", n.Func.Name)
+			}
+		case *parser.AggregateExpr:
+			switch n.Op {
+			case parser.SUM, parser.AVG, parser.MIN, parser.MAX, parser.COUNT:
+			default:
+				err = fmt.Errorf("aggregation %s is not supported", n.Op)
+			}
+		case *parser.BinaryExpr:
+			if n.VectorMatching != nil && len(n.VectorMatching.Include) > 0 ||
+				n.VectorMatching != nil && n.VectorMatching.Card != parser.CardOneToOne && !n.Op.IsSetOperator() {
+				err = fmt.Errorf("group_left and group_right are not supported")
+			}
+			if n.Op == parser.ATAN2 {
+				err = fmt.Errorf("atan2 is not supported")
+			}
+		case *parser.SubqueryExpr:
+			err = fmt.Errorf("subqueries are not supported")
+		case *parser.StringLiteral:
+			err = fmt.Errorf("strings are not supported")
+		case nil, *parser.NumberLiteral, *parser.ParenExpr, *parser.UnaryExpr, parser.Expressions:
+		default:
+			err = fmt.Errorf("%T is not supported", node)
+		}
+		return err
+	})
+	return err
+}
+
+func (e *ruleEval) eval(expr parser.Expr) (promValue, error) {
+	switch n := expr.(type) {
+	case *parser.NumberLiteral:
+		return promValue{scalar: true, value: n.Val}, nil
+	case *parser.ParenExpr:
+		return e.eval(n.Expr)
+	case *parser.UnaryExpr:
+		v, err := e.eval(n.Expr)
+		if err != nil || n.Op != parser.SUB {
+			return v, err
+		}
+		if v.scalar {
+			return promValue{scalar: true, value: -v.value}, nil
+		}
+		return promValue{vector: dropName(mapVector(v.vector, func(x float64) float64 { return -x }))}, nil
+	case *parser.VectorSelector:
+		return promValue{vector: e.selectVector(n)}, nil
+	case *parser.Call:
+		return e.call(n)
+	case *parser.AggregateExpr:
+		v, err := e.eval(n.Expr)
+		if err != nil {
+			return v, err
+		}
+		return promValue{vector: aggregateVector(n, v.vector)}, nil
+	case *parser.BinaryExpr:
+		lhs, err := e.eval(n.LHS)
+		if err != nil {
+			return lhs, err
+		}
+		rhs, err := e.eval(n.RHS)
+		if err != nil {
+			return rhs, err
+		}
+		return binaryOp(n, lhs, rhs), nil
+	}
+	return promValue{}, fmt.Errorf("%T is not supported", expr)
+}
+
+// seriesLabels returns the labels of a series including __name__.
+func seriesLabels(series *MetricSeries) map[string]string {
+	res := make(map[string]string, len(series.Labels)+1)
+	for k, v := range series.Labels {
+		res[k] = v
+	}
+	res[labels.MetricName] = series.Name
+	return res
+}
+
+// matchesAll reports whether labels are selected by all matchers.
+func matchesAll(matchers []*labels.Matcher, lbls map[string]string) bool {
+	for _, matcher := range matchers {
+		if !matcher.Matches(lbls[matcher.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// selectVector returns the newest sample within the lookback delta of the
+// series selected, including the results of recording rules.
+func (e *ruleEval) selectVector(vs *parser.VectorSelector) promVector {
+	var res promVector
+	sel := &selector{matchers: vs.LabelMatchers}
+	for _, series := range e.store.Metrics {
+		if !sel.matches(series) {
+			continue
+		}
+		times, values := e.samplesSince(series, e.now.Add(-lookbackDelta))
+		if len(times) > 0 {
+			res = append(res, promSample{labels: seriesLabels(series), value: values[len(values)-1]})
+		}
+	}
+	for _, vector := range e.recorded {
+		for _, s := range vector {
+			if matchesAll(vs.LabelMatchers, s.labels) {
+				res = append(res, s)
+			}
+		}
+	}
+	return res
+}
+
+// samplesSince returns the times and values of the samples of a series after
+// start, skipping missing ones. Values are aligned with the scrape times
+// from the end of the history.
+func (e *ruleEval) samplesSince(series *MetricSeries, start time.Time) ([]time.Time, []float64) {
+	var times []time.Time
+	var values []float64
+	n := min(len(series.Values), len(e.store.times))
+	for k := n; k >= 1; k-- {
+		t := e.store.times[len(e.store.times)-k]
+		v := series.Values[len(series.Values)-k]
+		if t.After(start) && !math.IsNaN(v) {
+			times = append(times, t)
+			values = append(values, v)
+		}
+	}
+	return times, values
+}
+
+func (e *ruleEval) call(c *parser.Call) (promValue, error) {
+	name := c.Func.Name
+	if rangeFunctions[name] {
+		ms, ok := c.Args[0].(*parser.MatrixSelector)
+		if !ok {
+			return promValue{}, fmt.Errorf("%s() needs a range selector", name)
+		}
+		return promValue{vector: e.rangeFunction(name, ms)}, nil
+	}
+	if name == "time" {
+		return promValue{scalar: true, value: float64(e.now.UnixMilli()) / 1000}, nil
+	}
+
+	var args []promValue
+	for _, arg := range c.Args {
+		v, err := e.eval(arg)
+		if err != nil {
+			return v, err
+		}
+		args = append(args, v)
+	}
+	switch name {
+	case "vector":
+		return promValue{vector: promVector{{labels: map[string]string{}, value: args[0].value}}}, nil
+	case "scalar":
+		if len(args[0].vector) != 1 {
+			return promValue{scalar: true, value: math.NaN()}, nil
+		}
+		return promValue{scalar: true, value: args[0].vector[0].value}, nil
+	case "abs":
+		return promValue{vector: dropName(mapVector(args[0].vector, math.Abs))}, nil
+	case "ceil":
+		return promValue{vector: dropName(mapVector(args[0].vector, math.Ceil))}, nil
+	case "floor":
+		return promValue{vector: dropName(mapVector(args[0].vector, math.Floor))}, nil
+	case "clamp_min":
+		bound := args[1].value
+		return promValue{vector: dropName(mapVector(args[0].vector, func(x float64) float64 { return math.Max(x, bound) }))}, nil
+	case "clamp_max":
+		bound := args[1].value
+		return promValue{vector: dropName(mapVector(args[0].vector, func(x float64) float64 { return math.Min(x, bound) }))}, nil
+	}
+	return promValue{}, fmt.Errorf("function %s() is not supported", name)
+}
+
+// rangeFunction applies a function to the samples of each series selected
+// within the range. Series without enough samples are left out.
+func (e *ruleEval) rangeFunction(name string, ms *parser.MatrixSelector) promVector {
+	vs := ms.VectorSelector.(*parser.VectorSelector)
+	sel := &selector{matchers: vs.LabelMatchers}
+	var res promVector
+	for _, series := range e.store.Metrics {
+		if !sel.matches(series) {
+			continue
+		}
+		times, values := e.samplesSince(series, e.now.Add(-ms.Range))
+		value, ok := applyRangeFunction(name, ms.Range, times, values)
+		if !ok {
+			continue
+		}
+		lbls := seriesLabels(series)
+		if name != "last_over_time" {
+			delete(lbls, labels.MetricName)
+		}
+		res = append(res, promSample{labels: lbls, value: value})
+	}
+	return res
+}
+
+func applyRangeFunction(name string, rng time.Duration, times []time.Time, values []float64) (float64, bool) {
+	n := len(values)
+	if n == 0 {
+		return 0, false
+	}
+	// Increase of a counter, accounting for resets
+	increase := func(values []float64) float64 {
+		var res float64
+		for i := 1; i < len(values); i++ {
+			if d := values[i] - values[i-1]; d >= 0 {
+				res += d
+			} else {
+				res += values[i]
+			}
+		}
+		return res
+	}
+	switch name {
+	case "rate", "increase", "delta":
+		if n < 2 {
+			return 0, false
+		}
+		span := times[n-1].Sub(times[0]).Seconds()
+		change := values[n-1] - values[0]
+		if name != "delta" {
+			change = increase(values)
+		}
+		if name == "rate" {
+			return change / span, true
+		}
+		return change / span * rng.Seconds(), true
+	case "irate", "idelta":
+		if n < 2 {
+			return 0, false
+		}
+		if name == "idelta" {
+			return values[n-1] - values[n-2], true
+		}
+		return increase(values[n-2:]) / times[n-1].Sub(times[n-2]).Seconds(), true
+	case "changes":
+		var res float64
+		for i := 1; i < n; i++ {
+			if values[i] != values[i-1] {
+				res++
+			}
+		}
+		return res, true
+	case "avg_over_time":
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float64(n), true
+	case "min_over_time":
+		return slices.Min(values), true
+	case "max_over_time":
+		return slices.Max(values), true
+	case "sum_over_time":
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum, true
+	case "count_over_time":
+		return float64(n), true
+	case "last_over_time":
+		return values[n-1], true
+	}
+	return 0, false
+}
+
+func mapVector(vector promVector, f func(float64) float64) promVector {
+	res := make(promVector, len(vector))
+	for i, s := range vector {
+		res[i] = promSample{labels: s.labels, value: f(s.value)}
+	}
+	return res
+}
+
+func dropName(vector promVector) promVector {
+	for i, s := range vector {
+		if _, ok := s.labels[labels.MetricName]; ok {
+			lbls := make(map[string]string, len(s.labels))
+			for k, v := range s.labels {
+				if k != labels.MetricName {
+					lbls[k] = v
+				}
+			}
+			vector[i].labels = lbls
+		}
+	}
+	return vector
+}
+
+// groupLabels returns the labels kept by a grouping, with on or by
+// semantics if on is set and ignoring or without semantics otherwise.
+// __name__ is always dropped.
+func groupLabels(lbls map[string]string, names []string, on bool) map[string]string {
+	res := make(map[string]string)
+	for k, v := range lbls {
+		if k != labels.MetricName && slices.Contains(names, k) == on {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// matchedLabels returns the labels of the result of a vector matching: only
+// the matching labels with on, and all but the ignored ones otherwise.
+func matchedLabels(lbls map[string]string, names []string, on bool) map[string]string {
+	if on {
+		return groupLabels(lbls, names, true)
+	}
+	res := make(map[string]string, len(lbls))
+	for k, v := range lbls {
+		if !slices.Contains(names, k) {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// labelsKey returns a string identifying a label set.
+func labelsKey(lbls map[string]string) string {
+	return GenerateSignature("", lbls)
+}
+
+func aggregateVector(a *parser.AggregateExpr, vector promVector) promVector {
+	type group struct {
+		labels map[string]string
+		values []float64
+	}
+	groups := make(map[string]*group)
+	var order []string
+	for _, s := range vector {
+		lbls := groupLabels(s.labels, a.Grouping, !a.Without)
+		key := labelsKey(lbls)
+		g, ok := groups[key]
+		if !ok {
+			g = &group{labels: lbls}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.values = append(g.values, s.value)
+	}
+
+	res := make(promVector, 0, len(groups))
+	for _, key := range order {
+		g := groups[key]
+		var value float64
+		switch a.Op {
+		case parser.SUM, parser.AVG:
+			for _, v := range g.values {
+				value += v
+			}
+			if a.Op == parser.AVG {
+				value /= float64(len(g.values))
+			}
+		case parser.MIN:
+			value = slices.Min(g.values)
+		case parser.MAX:
+			value = slices.Max(g.values)
+		case parser.COUNT:
+			value = float64(len(g.values))
+		}
+		res = append(res, promSample{labels: g.labels, value: value})
+	}
+	return res
+}
+
+// arithmetic applies an arithmetic or comparison operator. Comparisons
+// return 1 or 0.
+func arithmetic(op parser.ItemType, a, b float64) float64 {
+	bool01 := func(v bool) float64 {
+		if v {
+			return 1
+		}
+		return 0
+	}
+	switch op {
+	case parser.ADD:
+		return a + b
+	case parser.SUB:
+		return a - b
+	case parser.MUL:
+		return a * b
+	case parser.DIV:
+		return a / b
+	case parser.MOD:
+		return math.Mod(a, b)
+	case parser.POW:
+		return math.Pow(a, b)
+	case parser.EQLC:
+		return bool01(a == b)
+	case parser.NEQ:
+		return bool01(a != b)
+	case parser.GTR:
+		return bool01(a > b)
+	case parser.LSS:
+		return bool01(a < b)
+	case parser.GTE:
+		return bool01(a >= b)
+	case parser.LTE:
+		return bool01(a <= b)
+	}
+	return math.NaN()
+}
+
+// binaryOp applies a binary operator. Vectors are matched one-to-one, or
+// many-to-many for the set operators.
+func binaryOp(b *parser.BinaryExpr, lhs, rhs promValue) promValue {
+	if lhs.scalar && rhs.scalar {
+		return promValue{scalar: true, value: arithmetic(b.Op, lhs.value, rhs.value)}
+	}
+	comparison := b.Op.IsComparisonOperator()
+
+	// apply returns the result of an element, and false if it's filtered
+	apply := func(s promSample, a, c float64) (promSample, bool) {
+		v := arithmetic(b.Op, a, c)
+		if comparison && !b.ReturnBool {
+			if v == 0 {
+				return s, false
+			}
+			// Filtering keeps the value of the vector, and its name
+			return s, true
+		}
+		lbls := s.labels
+		if _, ok := lbls[labels.MetricName]; ok {
+			lbls = groupLabels(lbls, nil, false)
+		}
+		return promSample{labels: lbls, value: v}, true
+	}
+
+	var res promVector
+	switch {
+	case rhs.scalar:
+		for _, s := range lhs.vector {
+			if r, ok := apply(s, s.value, rhs.value); ok {
+				res = append(res, r)
+			}
+		}
+	case lhs.scalar:
+		for _, s := range rhs.vector {
+			if r, ok := apply(s, lhs.value, s.value); ok {
+				res = append(res, r)
+			}
+		}
+	default:
+		var names []string
+		on := false
+		if b.VectorMatching != nil {
+			names, on = b.VectorMatching.MatchingLabels, b.VectorMatching.On
+		}
+		key := func(s promSample) string { return labelsKey(groupLabels(s.labels, names, on)) }
+		right := make(map[string]promSample)
+		for _, s := range rhs.vector {
+			right[key(s)] = s
+		}
+		switch b.Op {
+		case parser.LAND, parser.LUNLESS:
+			for _, s := range lhs.vector {
+				if _, ok := right[key(s)]; ok == (b.Op == parser.LAND) {
+					res = append(res, s)
+				}
+			}
+		case parser.LOR:
+			res = append(res, lhs.vector...)
+			left := make(map[string]bool)
+			for _, s := range lhs.vector {
+				left[key(s)] = true
+			}
+			for _, s := range rhs.vector {
+				if !left[key(s)] {
+					res = append(res, s)
+				}
+			}
+		default:
+			for _, s := range lhs.vector {
+				r, ok := right[key(s)]
+				if !ok {
+					continue
+				}
+				s.labels = matchedLabels(s.labels, names, on)
+				if r, ok := apply(s, s.value, r.value); ok {
+					res = append(res, r)
+				}
+			}
+		}
+	}
+	return promValue{vector: res}
+}
+
+// formatLabels formats labels as {k="v", ...}, sorted by name.
+func formatLabels(lbls map[string]string) string {
+	keys := make([]string, 0, len(lbls))
+	for k := range lbls {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s=%q", k, lbls[k])
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
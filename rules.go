@@ -0,0 +1,540 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	promModel "github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+	"go.yaml.in/yaml/v2"
+)
+
+// rulesPanelHeight is the number of lines used by the rules panel below the
+// table: a title and the rules, most urgent first.
+const rulesPanelHeight = 6
+
+// Rule states, ordered by urgency
+const (
+	ruleFiring = iota
+	rulePending
+	ruleInactive
+	ruleRecording
+	ruleSkipped // Not expressible over the history, see checkSupported
+)
+
+// promRuleFile is the part of a Prometheus rule file used for the preview.
+type promRuleFile struct {
+	Groups []struct {
+		Name  string `yaml:"name"`
+		Rules []struct {
+			Record string             `yaml:"record"`
+			Alert  string             `yaml:"alert"`
+			Expr   string             `yaml:"expr"`
+			For    promModel.Duration `yaml:"for"`
+			Labels map[string]string  `yaml:"labels"`
+		} `yaml:"rules"`
+	} `yaml:"groups"`
+}
+
+// rule is an alerting or recording rule evaluated on every scrape.
+type rule struct {
+	name      string // Alert name, or name of the recorded series
+	alert     bool
+	expr      parser.Expr
+	selectors []*selector   // Of the series the expression selects
+	hold      time.Duration // Time the condition must hold before an alert fires
+	labels    map[string]string
+	skipped   error                   // Why the rule cannot be evaluated over the history
+	err       error                   // Of the last evaluation
+	series    int                     // Series recorded by the last evaluation
+	active    map[string]*activeAlert // By alert signature
+
+	silencedUntil time.Time // See silence
+	acked         bool      // Silenced until no alert fires, see acknowledge
+}
+
+// silenceDurations are the durations cycled through with s on the rules
+// panel.
+var silenceDurations = []time.Duration{15 * time.Minute, time.Hour, 4 * time.Hour}
+
+// silenced reports whether the alerts of the rule are silenced or
+// acknowledged at now. Silenced alerts still fire but are not counted in the
+// footer and are logged as expected.
+func (r *rule) silenced(now time.Time) bool {
+	return r.acked || now.Before(r.silencedUntil)
+}
+
+// activeAlert is an alert whose condition holds.
+type activeAlert struct {
+	since    time.Time         // When the condition started to hold
+	labels   map[string]string // Of the sample of the expression, to find its series
+	severity string            // The severity label, if any
+}
+
+// ruleSet is the rules of the -rules files, in file order, which is the order
+// of evaluation.
+type ruleSet struct {
+	rules     []*rule
+	evaluated time.Time // Time of the last evaluation
+}
+
+// loadRules loads the rules of Prometheus rule files. Rules whose expressions
+// need more than a history covering window are loaded but skipped.
+func loadRules(paths []string, window time.Duration) (*ruleSet, error) {
+	rs := &ruleSet{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var file promRuleFile
+		if err := yaml.UnmarshalStrict(data, &file); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		for _, group := range file.Groups {
+			for _, spec := range group.Rules {
+				r := &rule{
+					name:   spec.Record,
+					alert:  spec.Alert != "",
+					hold:   time.Duration(spec.For),
+					labels: spec.Labels,
+					active: make(map[string]*activeAlert),
+				}
+				if r.alert {
+					r.name = spec.Alert
+				}
+				if r.name == "" {
+					return nil, fmt.Errorf("%s: group %s: rule without alert or record name", path, group.Name)
+				}
+				if r.expr, err = parser.ParseExpr(spec.Expr); err != nil {
+					return nil, fmt.Errorf("%s: %s: %v", path, r.name, err)
+				}
+				parser.Inspect(r.expr, func(node parser.Node, _ []parser.Node) error {
+					if vs, ok := node.(*parser.VectorSelector); ok {
+						r.selectors = append(r.selectors, &selector{matchers: vs.LabelMatchers})
+					}
+					return nil
+				})
+				r.skipped = checkSupported(r.expr, window)
+				rs.rules = append(rs.rules, r)
+			}
+		}
+	}
+	return rs, nil
+}
+
+// state returns the state of a rule as of the last evaluation.
+func (r *rule) state(now time.Time) int {
+	switch {
+	case r.skipped != nil:
+		return ruleSkipped
+	case !r.alert:
+		return ruleRecording
+	}
+	state := ruleInactive
+	for _, a := range r.active {
+		if now.Sub(a.since) >= r.hold {
+			return ruleFiring
+		}
+		state = rulePending
+	}
+	return state
+}
+
+// firing returns the number of firing alerts of a rule.
+func (r *rule) firing(now time.Time) int {
+	n := 0
+	for _, a := range r.active {
+		if now.Sub(a.since) >= r.hold {
+			n++
+		}
+	}
+	return n
+}
+
+// evaluate evaluates the rules against the store as of its last scrape, and
+// returns the alerts which started or stopped firing, and those which
+// started firing while silenced.
+func (rs *ruleSet) evaluate(store *Store) (started, resolved, silenced []string) {
+	_, now, ok := store.TimeRange()
+	if !ok {
+		return nil, nil, nil
+	}
+	e := &ruleEval{store: store, now: now, recorded: make(map[string]promVector)}
+	for _, r := range rs.rules {
+		if r.skipped != nil {
+			continue
+		}
+		wasFiring := make(map[string]bool)
+		for sig, a := range r.active {
+			wasFiring[sig] = rs.evaluated.Sub(a.since) >= r.hold
+		}
+
+		var v promValue
+		if v, r.err = e.eval(r.expr); r.err != nil {
+			// Keep the alerts as they were
+			continue
+		}
+		if v.scalar {
+			v.vector = promVector{{labels: map[string]string{}, value: v.value}}
+		}
+		if !r.alert {
+			recorded := make(promVector, len(v.vector))
+			for i, s := range v.vector {
+				recorded[i] = promSample{labels: r.resultLabels(s, promModel.MetricNameLabel), value: s.value}
+			}
+			e.recorded[r.name] = recorded
+			r.series = len(recorded)
+			continue
+		}
+
+		active := make(map[string]*activeAlert, len(v.vector))
+		for _, s := range v.vector {
+			lbls := r.resultLabels(s, "")
+			sig := GenerateSignature(r.name, lbls)
+			a, ok := r.active[sig]
+			if !ok {
+				a = &activeAlert{since: now, labels: groupLabels(s.labels, nil, false), severity: lbls["severity"]}
+			}
+			active[sig] = a
+			switch {
+			case wasFiring[sig] || now.Sub(a.since) < r.hold:
+			case r.silenced(time.Now()):
+				silenced = append(silenced, sig)
+			default:
+				started = append(started, sig)
+			}
+		}
+		for sig, firing := range wasFiring {
+			if _, ok := active[sig]; firing && !ok {
+				resolved = append(resolved, sig)
+			}
+		}
+		r.active = active
+		if r.firing(now) == 0 {
+			r.acked = false
+		}
+	}
+	rs.evaluated = now
+	slices.Sort(started)
+	slices.Sort(resolved)
+	slices.Sort(silenced)
+	return started, resolved, silenced
+}
+
+// resultLabels returns the labels of a series resulting from a rule: those
+// of the sample without the metric name and the labels of the rule, with
+// the rule name as nameLabel, if set.
+func (r *rule) resultLabels(s promSample, nameLabel string) map[string]string {
+	res := groupLabels(s.labels, nil, false)
+	for k, v := range r.labels {
+		res[k] = v
+	}
+	if nameLabel != "" {
+		res[nameLabel] = r.name
+	}
+	return res
+}
+
+// evaluateRules evaluates the -rules after a scrape and logs the alerts
+// which started or stopped firing.
+func (m *model) evaluateRules() {
+	if m.rules == nil {
+		return
+	}
+	started, resolved, silenced := m.rules.evaluate(m.store)
+	m.logSeriesEvent("Alert firing", started, true)
+	m.logSeriesEvent("Silenced alert firing", silenced, false)
+	m.logSeriesEvent("Alert resolved", resolved, false)
+}
+
+// toggleRules shows or hides the rules panel.
+func (m model) toggleRules() model {
+	if m.rules == nil {
+		m.notice = "No -rules loaded"
+		return m
+	}
+	m.showRules = !m.showRules
+	m.rulesFocused = false
+	m.resizeViewport()
+	m.ensureCursorVisible()
+	return m
+}
+
+// sortedRules returns the rules in the order of the panel, most urgent
+// first.
+func (m model) sortedRules() []*rule {
+	_, now, _ := m.store.TimeRange()
+	rules := slices.Clone(m.rules.rules)
+	slices.SortStableFunc(rules, func(a, b *rule) int {
+		return cmp.Compare(a.state(now), b.state(now))
+	})
+	return rules
+}
+
+// updateRules handles keys while the rules panel has the focus: the
+// selected rule is moved with up and down, silenced with s for a duration
+// cycling through silenceDurations and acknowledged with a until its alerts
+// resolve.
+func (m model) updateRules(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	rules := m.sortedRules()
+	i := max(slices.Index(rules, m.selectedRule), 0)
+	r := rules[i]
+	m.notice = ""
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return m, tea.Quit
+	case "L":
+		return m.toggleRules(), nil
+	case "tab", "esc":
+		m.rulesFocused = false
+	case "up", "k":
+		m.selectedRule = rules[max(i-1, 0)]
+	case "down", "j":
+		m.selectedRule = rules[min(i+1, len(rules)-1)]
+	case "s":
+		m.selectedRule = r
+		if !r.alert {
+			m.notice = r.name + " is a recording rule"
+			break
+		}
+		r.acked = false
+		next := 0
+		for j, d := range silenceDurations {
+			if r.silenced(time.Now()) && time.Until(r.silencedUntil) <= d {
+				next = j + 1
+				break
+			}
+		}
+		if next == len(silenceDurations) {
+			r.silencedUntil = time.Time{}
+			m.notice = "Unsilenced " + r.name
+			break
+		}
+		r.silencedUntil = time.Now().Add(silenceDurations[next])
+		m.notice = fmt.Sprintf("Silenced %s for %s", r.name, silenceDurations[next])
+	case "a":
+		m.selectedRule = r
+		_, now, _ := m.store.TimeRange()
+		switch {
+		case !r.alert || r.firing(now) == 0:
+			m.notice = r.name + " is not firing"
+		case r.acked:
+			r.acked = false
+			m.notice = "Unacknowledged " + r.name
+		default:
+			r.acked = true
+			m.notice = "Acknowledged " + r.name + " until it resolves"
+		}
+	}
+	return m, nil
+}
+
+// silenceStatus describes the silence of a rule for the panel, or is empty.
+func (r *rule) silenceStatus(now time.Time) string {
+	switch {
+	case r.acked:
+		return "acknowledged"
+	case now.Before(r.silencedUntil):
+		return "silenced for " + r.silencedUntil.Sub(now).Round(time.Minute).String()
+	}
+	return ""
+}
+
+// severityRank orders the values of the severity label of alerts, most
+// severe first.
+func severityRank(severity string) int {
+	switch strings.ToLower(severity) {
+	case "critical", "crit", "page", "error":
+		return 0
+	case "warning", "warn":
+		return 1
+	case "":
+		return 3
+	}
+	return 2
+}
+
+// severityName abbreviates a severity for the footer, e.g. crit, with
+// "firing" for alerts without severity.
+func severityName(severity string) string {
+	switch severityRank(severity) {
+	case 0:
+		return "crit"
+	case 1:
+		return "warn"
+	case 3:
+		return "firing"
+	}
+	return strings.ToLower(severity)
+}
+
+// rulesStatus returns the footer status of the -rules with the firing alerts
+// by severity, most severe first, e.g. "Rules: 2 crit, 1 warn, 1 pending".
+func (m model) rulesStatus() (string, bool) {
+	_, now, _ := m.store.TimeRange()
+	bySeverity := make(map[string]int)
+	pending, silenced := 0, 0
+	for _, r := range m.rules.rules {
+		for _, a := range r.active {
+			switch {
+			case now.Sub(a.since) < r.hold:
+				pending++
+			case r.silenced(time.Now()):
+				silenced++
+			default:
+				bySeverity[severityName(a.severity)]++
+			}
+		}
+	}
+	if len(bySeverity) == 0 && pending == 0 {
+		if silenced > 0 {
+			return fmt.Sprintf("Rules: %d silenced", silenced), true
+		}
+		return "Rules: ok", true
+	}
+	severities := slices.Collect(maps.Keys(bySeverity))
+	slices.SortFunc(severities, func(a, b string) int {
+		return cmp.Or(cmp.Compare(severityRank(a), severityRank(b)), strings.Compare(a, b))
+	})
+	var parts []string
+	for _, severity := range severities {
+		parts = append(parts, fmt.Sprintf("%d %s", bySeverity[severity], severity))
+	}
+	if pending > 0 {
+		parts = append(parts, fmt.Sprintf("%d pending", pending))
+	}
+	if silenced > 0 {
+		parts = append(parts, fmt.Sprintf("%d silenced", silenced))
+	}
+	return "Rules: " + strings.Join(parts, ", "), false
+}
+
+// firingSeries reports whether a series is behind a firing alert: selected
+// by the expression of the rule and carrying the labels of the alert.
+func (r *rule) firingSeries(series *MetricSeries, now time.Time) bool {
+	if !slices.ContainsFunc(r.selectors, func(sel *selector) bool { return sel.matches(series) }) {
+		return false
+	}
+	for _, a := range r.active {
+		if now.Sub(a.since) < r.hold {
+			continue
+		}
+		matches := true
+		for k, v := range a.labels {
+			if series.Labels[k] != v {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+// jumpToFiring selects the next row after the selection behind a firing
+// alert of the most severe kind firing, wrapping around.
+func (m model) jumpToFiring() model {
+	if m.rules == nil {
+		m.notice = "No -rules loaded"
+		return m
+	}
+	_, now, _ := m.store.TimeRange()
+	var rules []*rule
+	rank := severityRank("")
+	for _, r := range m.rules.rules {
+		if r.silenced(time.Now()) {
+			continue
+		}
+		for _, a := range r.active {
+			if now.Sub(a.since) < r.hold {
+				continue
+			}
+			if severityRank(a.severity) < rank {
+				rank, rules = severityRank(a.severity), nil
+			}
+			if severityRank(a.severity) == rank && !slices.Contains(rules, r) {
+				rules = append(rules, r)
+			}
+		}
+	}
+	if len(rules) == 0 {
+		m.notice = "No alerts firing"
+		return m
+	}
+
+	series := m.visibleSeries()
+	for i := 1; i <= len(series); i++ {
+		row := (m.cursor + i) % len(series)
+		if slices.ContainsFunc(rules, func(r *rule) bool { return r.firingSeries(series[row], now) }) {
+			m.moveCursor(row - m.cursor)
+			return m
+		}
+	}
+	m.notice = "No shown row is behind the firing alerts"
+	return m
+}
+
+// renderRulesPanel renders the rules, firing ones first, scrolled to the
+// selected rule while the panel has the focus.
+func (m model) renderRulesPanel() string {
+	_, now, _ := m.store.TimeRange()
+	rules := m.sortedRules()
+
+	firingStyle := lipgloss.NewStyle().Foreground(color("196"))  // red
+	pendingStyle := lipgloss.NewStyle().Foreground(color("220")) // yellow
+	title := m.labelStyle.Render(fmt.Sprintf("Rules (%d, tab to select, L to close)", len(rules)))
+	if m.rulesFocused {
+		title = m.labelStyle.Render(fmt.Sprintf("Rules (%d, s to silence, a to acknowledge, tab to leave)", len(rules)))
+	}
+	lines := []string{title}
+	shown := rulesPanelHeight - 1
+	selected := slices.Index(rules, m.selectedRule)
+	offset := 0
+	if m.rulesFocused {
+		offset = max(min(selected-shown/2, len(rules)-shown), 0)
+	}
+	for i, r := range rules[offset:min(len(rules), offset+shown)] {
+		var line string
+		style := lipgloss.NewStyle()
+		switch state := r.state(now); {
+		case r.err != nil:
+			line = fmt.Sprintf("error    %s: %v", r.name, r.err)
+			style = firingStyle
+		case state == ruleFiring:
+			line = fmt.Sprintf("firing   %s: %d alert(s)", r.name, r.firing(now))
+			style = firingStyle
+		case state == rulePending:
+			line = fmt.Sprintf("pending  %s: %d alert(s), for %s", r.name, len(r.active), r.hold)
+			style = pendingStyle
+		case state == ruleInactive:
+			line = "ok       " + r.name
+		case state == ruleRecording:
+			line = fmt.Sprintf("recorded %s: %d series", r.name, r.series)
+		default:
+			line = fmt.Sprintf("skipped  %s: %v", r.name, r.skipped)
+			style = m.labelStyle
+		}
+		if status := r.silenceStatus(time.Now()); status != "" && r.alert {
+			line += " (" + status + ")"
+			style = m.labelStyle
+		}
+		if m.rulesFocused && offset+i == max(selected, 0) {
+			style = m.selectedStyle.Inherit(style)
+		}
+		lines = append(lines, style.Render(truncateMessage(line, m.width)))
+	}
+	for len(lines) < rulesPanelHeight {
+		lines = append(lines, "")
+	}
+	return strings.Join(lines, "\n")
+}
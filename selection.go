@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/muesli/termenv"
+)
+
+// seriesSet is a set of series by signature, e.g. the marked rows.
+type seriesSet map[string]bool
+
+func (s seriesSet) has(series *MetricSeries) bool {
+	return s[series.signature()]
+}
+
+// toggleMark marks or unmarks the selected row and moves to the next one, so
+// consecutive rows are marked by repeated presses.
+func (m model) toggleMark() model {
+	series := m.selectedSeries()
+	if series == nil {
+		return m
+	}
+	sig := series.signature()
+	if m.marked[sig] {
+		delete(m.marked, sig)
+	} else {
+		m.marked[sig] = true
+	}
+	m.moveCursor(1)
+	return m
+}
+
+// bulkTargets returns the signatures of the marked visible series in table
+// order, or of the selected series if none are marked.
+func (m model) bulkTargets() []string {
+	var sigs []string
+	var selected string
+	for i, series := range m.visibleSeries() {
+		sig := series.signature()
+		if m.marked[sig] {
+			sigs = append(sigs, sig)
+		}
+		if i == m.cursor {
+			selected = sig
+		}
+	}
+	if len(sigs) == 0 && selected != "" {
+		sigs = []string{selected}
+	}
+	return sigs
+}
+
+// applyBulk runs an action on the marked series, or the selected one, and
+// clears the marks.
+func (m model) applyBulk(action func(sigs []string) string) model {
+	sigs := m.bulkTargets()
+	if len(sigs) == 0 {
+		return m
+	}
+	m.notice = action(sigs)
+	clear(m.marked)
+	m.clampCursor()
+	if m.viewportReady {
+		m.refreshTable()
+	}
+	return m
+}
+
+// togglePins pins the series to the top of the table, or unpins them if all
+// are pinned.
+func (m model) togglePins() model {
+	return m.applyBulk(func(sigs []string) string {
+		pin := false
+		for _, sig := range sigs {
+			pin = pin || !m.pinned[sig]
+		}
+		for _, sig := range sigs {
+			if pin {
+				m.pinned[sig] = true
+			} else {
+				delete(m.pinned, sig)
+			}
+		}
+		if pin {
+			return fmt.Sprintf("Pinned %d series", len(sigs))
+		}
+		return fmt.Sprintf("Unpinned %d series", len(sigs))
+	})
+}
+
+// hideSeries hides the series from the table. Without marked rows and with
+// hidden series, all hidden series are shown again instead.
+func (m model) hideSeries() model {
+	if len(m.marked) == 0 && len(m.hidden) > 0 {
+		n := len(m.hidden)
+		clear(m.hidden)
+		m.notice = fmt.Sprintf("Showing %d hidden series again", n)
+		if m.viewportReady {
+			m.refreshTable()
+		}
+		return m
+	}
+	return m.applyBulk(func(sigs []string) string {
+		for _, sig := range sigs {
+			m.hidden[sig] = true
+		}
+		return fmt.Sprintf("Hid %d series (H without marks to show again)", len(sigs))
+	})
+}
+
+// exportMarked writes the history of the series to a CSV file in the format
+// of -export, named after the current time.
+func (m model) exportMarked() model {
+	return m.applyBulk(func(sigs []string) string {
+		path := "openmetrics-" + time.Now().Format("20060102-150405") + ".csv"
+		if err := exportSeries(m.store, sigs, m.notes, m.cfg.Interval, path); err != nil {
+			return "Export failed: " + err.Error()
+		}
+		return fmt.Sprintf("Exported %d series to %s", len(sigs), path)
+	})
+}
+
+// copyMarked copies the series with their current values to the clipboard
+// using OSC 52, one '<signature> <value>' line per series.
+func (m model) copyMarked() model {
+	return m.applyBulk(func(sigs []string) string {
+		var b strings.Builder
+		for _, sig := range sigs {
+			value := math.NaN()
+			series, ok := m.store.Metrics[sig]
+			if !ok {
+				series, ok = m.store.Derived[sig]
+			}
+			if ok && len(series.Values) > 0 {
+				value = series.Values[len(series.Values)-1]
+			}
+			b.WriteString(sig + " " + strconv.FormatFloat(value, 'g', -1, 64) + "\n")
+		}
+		termenv.Copy(b.String())
+		return fmt.Sprintf("Copied %d series", len(sigs))
+	})
+}
+
+// compareBool orders false before true.
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// selector is a PromQL vector selector, e.g. foo{code=~"5..",env!="dev"},
+// parsed with the upstream PromQL parser so the matcher semantics are exactly
+// those of Prometheus.
+type selector struct {
+	matchers []*labels.Matcher
+}
+
+// parseSelector parses a PromQL vector selector. Either the metric name or
+// at least one non-empty label matcher is required.
+func parseSelector(s string) (*selector, error) {
+	matchers, err := parser.ParseMetricSelector(s)
+	if err != nil {
+		return nil, err
+	}
+	return &selector{matchers: matchers}, nil
+}
+
+// filterLabelSelector converts a -filter-label of the form key=value or
+// key=~regex to the equivalent selector, so it matches like -select. It
+// returns nil for the deprecated form matching any label value with a
+// regex, which has no selector equivalent.
+func filterLabelSelector(filter string) (*selector, error) {
+	key, value, ok := strings.Cut(filter, "=")
+	if !ok {
+		return nil, nil
+	}
+	if key == "" {
+		return nil, errors.New("missing label name")
+	}
+	op := "="
+	if pattern, ok := strings.CutPrefix(value, "~"); ok {
+		op, value = "=~", pattern
+	}
+	return parseSelector("{" + strconv.Quote(key) + op + strconv.Quote(value) + "}")
+}
+
+// compileLabelFilter compiles a -filter-label once for matching all series:
+// to a selector, or to a regex for the deprecated form. A filter rejected by
+// Config.validate matches everything.
+func compileLabelFilter(filter string) (*selector, *regexp.Regexp) {
+	if filter == "" {
+		return nil, nil
+	}
+	if sel, err := filterLabelSelector(filter); sel != nil || err != nil {
+		return sel, nil
+	}
+	re, _ := regexp.Compile(filter)
+	return nil, re
+}
+
+// matches reports whether a series is selected. A missing label matches as
+// the empty string, and names match in both their UTF-8 and escaped forms.
+func (sel *selector) matches(series *MetricSeries) bool {
+	for _, matcher := range sel.matchers {
+		if matcher.Name == labels.MetricName {
+			if !matcher.Matches(series.Name) && !matcher.Matches(escapeName(series.Name)) {
+				return false
+			}
+			continue
+		}
+		value, _ := labelValue(series.Labels, matcher.Name)
+		if !matcher.Matches(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalityLabels returns the names of the labels the selector pins to a
+// single value, which are redundant to display.
+func (sel *selector) equalityLabels() []string {
+	var names []string
+	for _, matcher := range sel.matchers {
+		if matcher.Type == labels.MatchEqual && matcher.Name != labels.MetricName {
+			names = append(names, matcher.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Terminal control sequences for drawing shared frames
+const (
+	escAltScreen  = "\x1b[?1049h\x1b[?25l" // Switch to the alternate screen, hide the cursor
+	escMainScreen = "\x1b[?25h\x1b[?1049l"
+	escHome       = "\x1b[H"
+	escClearLine  = "\x1b[K" // To the end of the line
+	escClearBelow = "\x1b[J"
+)
+
+// shareSession streams the rendered view to read-only clients attached with
+// the attach command. Clients never send anything; a slow client only misses
+// frames and doesn't hold up the UI.
+type shareSession struct {
+	ln      net.Listener
+	mu      sync.Mutex
+	clients map[*shareClient]struct{}
+	last    string // Last frame, sent to clients when they attach
+	closed  bool
+}
+
+type shareClient struct {
+	conn   net.Conn
+	frames chan string // Holds at most the newest frame not yet written
+}
+
+// parseShareAddr splits a -share or attach address given as unix:<path> or
+// tcp:<host:port> into network and address.
+func parseShareAddr(s string) (string, string, error) {
+	network, addr, ok := strings.Cut(s, ":")
+	if !ok || addr == "" || network != "unix" && network != "tcp" {
+		return "", "", fmt.Errorf("invalid share address '%s'. Must be unix:<path> or tcp:<host:port>", s)
+	}
+	return network, addr, nil
+}
+
+// listenShare listens on a share address. A socket file left behind by a
+// session that didn't exit cleanly is replaced, one still in use is not.
+func listenShare(network, addr string) (net.Listener, error) {
+	ln, err := net.Listen(network, addr)
+	if network != "unix" || !errors.Is(err, syscall.EADDRINUSE) {
+		return ln, err
+	}
+	if conn, dialErr := net.Dial(network, addr); dialErr == nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := os.Remove(addr); err != nil {
+		return nil, err
+	}
+	return net.Listen(network, addr)
+}
+
+// startShare listens on the -share address and accepts clients in the
+// background.
+func startShare(s string) (*shareSession, error) {
+	network, addr, err := parseShareAddr(s)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := listenShare(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	sh := &shareSession{ln: ln, clients: make(map[*shareClient]struct{})}
+	go sh.accept()
+	return sh, nil
+}
+
+func (sh *shareSession) accept() {
+	for {
+		conn, err := sh.ln.Accept()
+		if err != nil {
+			return
+		}
+		c := &shareClient{conn: conn, frames: make(chan string, 1)}
+		sh.mu.Lock()
+		if sh.closed {
+			sh.mu.Unlock()
+			conn.Close()
+			return
+		}
+		sh.clients[c] = struct{}{}
+		if sh.last != "" {
+			c.frames <- sh.last
+		}
+		sh.mu.Unlock()
+		go sh.serve(c)
+	}
+}
+
+// serve writes frames to a client until it detaches or the session is
+// closed.
+func (sh *shareSession) serve(c *shareClient) {
+	defer func() {
+		sh.mu.Lock()
+		delete(sh.clients, c)
+		sh.mu.Unlock()
+		c.conn.Close()
+	}()
+	for frame := range c.frames {
+		if _, err := io.WriteString(c.conn, frame); err != nil {
+			return
+		}
+	}
+}
+
+// publish sends a rendered view to the attached clients, replacing frames
+// not written to them yet.
+func (sh *shareSession) publish(view string) {
+	frame := encodeFrame(view)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if frame == sh.last {
+		return
+	}
+	sh.last = frame
+	for c := range sh.clients {
+		select {
+		case <-c.frames:
+		default:
+		}
+		c.frames <- frame
+	}
+}
+
+// Close stops accepting clients and detaches the attached ones.
+func (sh *shareSession) Close() error {
+	err := sh.ln.Close()
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	sh.closed = true
+	for c := range sh.clients {
+		close(c.frames)
+		delete(sh.clients, c)
+	}
+	return err
+}
+
+// encodeFrame draws a view over the previous one from the top left corner,
+// clearing what's left of the previous frame rather than the whole screen
+// to avoid flicker.
+func encodeFrame(view string) string {
+	var b strings.Builder
+	b.WriteString(escHome)
+	for i, line := range strings.Split(view, "\n") {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(line)
+		b.WriteString(escClearLine)
+	}
+	b.WriteString(escClearBelow)
+	return b.String()
+}
+
+// runAttach implements the `attach <address>` command, following a session
+// shared with -share until it ends or the command is interrupted.
+func runAttach(args []string, w io.Writer) int {
+	fs := flag.NewFlagSet("attach", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s attach <unix:path|tcp:host:port>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	network, addr, err := parseShareAddr(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(w, "Error: %v\n", err)
+		return 2
+	}
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		fmt.Fprintf(w, "Error: cannot attach: %v\n", err)
+		return 1
+	}
+	defer conn.Close()
+
+	// Detach on Ctrl+C, restoring the screen
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	go func() {
+		<-interrupt
+		conn.Close()
+	}()
+
+	io.WriteString(w, escAltScreen)
+	io.Copy(w, conn)
+	io.WriteString(w, escMainScreen)
+	fmt.Fprintln(w, "Detached from", fs.Arg(0))
+	return 0
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Sink receives the samples of every successful scrape, e.g. to export or
+// store them outside the TUI.
+type Sink interface {
+	// Write is called once per scrape with all families of the scrape
+	Write(families map[string]*dto.MetricFamily, scrapeTime time.Time) error
+	Close() error
+}
+
+// SinkFactory opens a sink for the target part of a `-sink kind:target` spec.
+type SinkFactory func(target string) (Sink, error)
+
+var sinkFactories = map[string]SinkFactory{}
+
+// RegisterSink makes a sink kind available to the -sink flag. Sinks register
+// themselves from init functions.
+func RegisterSink(kind string, factory SinkFactory) {
+	sinkFactories[kind] = factory
+}
+
+func init() {
+	RegisterSink("csv", func(target string) (Sink, error) { return newFileSink(target, &csvEncoder{}) })
+	RegisterSink("jsonl", func(target string) (Sink, error) { return newFileSink(target, jsonlEncoder{}) })
+}
+
+// sinkKinds returns the registered sink kinds for help and error messages.
+func sinkKinds() []string {
+	kinds := make([]string, 0, len(sinkFactories))
+	for kind := range sinkFactories {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// namedSink is an opened sink with the kind it was created from.
+type namedSink struct {
+	kind string
+	Sink
+}
+
+// sinkSet fans a scrape out to all configured sinks.
+type sinkSet struct {
+	mu    sync.Mutex
+	sinks []namedSink
+}
+
+type sinkMsg struct {
+	failed []string // Kinds of the sinks which failed the last write
+	err    error
+}
+
+// openSinks opens the sinks of `kind:target` specs, closing the already
+// opened ones on error.
+func openSinks(specs []string) (*sinkSet, error) {
+	set := &sinkSet{}
+	for _, spec := range specs {
+		kind, target, _ := strings.Cut(spec, ":")
+		factory, ok := sinkFactories[kind]
+		if !ok {
+			set.Close()
+			return nil, fmt.Errorf("invalid sink '%s'. Kind must be one of: %s", spec, strings.Join(sinkKinds(), ", "))
+		}
+		sink, err := factory(target)
+		if err != nil {
+			set.Close()
+			return nil, fmt.Errorf("sink %s: %w", spec, err)
+		}
+		set.sinks = append(set.sinks, namedSink{kind: kind, Sink: sink})
+	}
+	return set, nil
+}
+
+func (s *sinkSet) empty() bool {
+	return s == nil || len(s.sinks) == 0
+}
+
+// Write passes a scrape to every sink, returning the kinds of the failed ones.
+func (s *sinkSet) Write(families map[string]*dto.MetricFamily, scrapeTime time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var failed []string
+	var errs []error
+	for _, sink := range s.sinks {
+		if err := sink.Write(families, scrapeTime); err != nil {
+			failed = append(failed, sink.kind)
+			errs = append(errs, fmt.Errorf("%s: %w", sink.kind, err))
+		}
+	}
+	return failed, errors.Join(errs...)
+}
+
+func (s *sinkSet) Close() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for _, sink := range s.sinks {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sink.kind, err))
+		}
+	}
+	s.sinks = nil
+	return errors.Join(errs...)
+}
+
+func (m model) sinkCmd(families map[string]*dto.MetricFamily, scrapeTime time.Time) tea.Cmd {
+	return func() tea.Msg {
+		failed, err := m.sinks.Write(families, scrapeTime)
+		return sinkMsg{failed: failed, err: err}
+	}
+}
+
+// sinkSample is a single simple sample as written by the file sinks.
+type sinkSample struct {
+	sig    string
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// sortedSamples returns the simple samples of a scrape ordered by signature,
+// so file output is stable between scrapes.
+func sortedSamples(families map[string]*dto.MetricFamily) []sinkSample {
+	var samples []sinkSample
+	forEachSample(families, func(sig, name, _ string, labels map[string]string, value float64) {
+		samples = append(samples, sinkSample{sig: sig, name: name, labels: labels, value: value})
+	})
+	sort.Slice(samples, func(i, j int) bool { return samples[i].sig < samples[j].sig })
+	return samples
+}
+
+// sampleEncoder writes the samples of a scrape in a file format.
+type sampleEncoder interface {
+	encode(w *bufio.Writer, scrapeTime time.Time, samples []sinkSample) error
+}
+
+// fileSink appends every scrape to a file, or stdout for "-".
+type fileSink struct {
+	f   *os.File
+	w   *bufio.Writer
+	enc sampleEncoder
+}
+
+func newFileSink(path string, enc sampleEncoder) (*fileSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("missing file name")
+	}
+	f := os.Stdout
+	if path != "-" {
+		var err error
+		f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &fileSink{f: f, w: bufio.NewWriter(f), enc: enc}, nil
+}
+
+func (s *fileSink) Write(families map[string]*dto.MetricFamily, scrapeTime time.Time) error {
+	if err := s.enc.encode(s.w, scrapeTime, sortedSamples(families)); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+func (s *fileSink) Close() error {
+	err := s.w.Flush()
+	if s.f != os.Stdout {
+		err = errors.Join(err, s.f.Close())
+	}
+	return err
+}
+
+// csvEncoder writes one `timestamp,series,value` row per sample, with a
+// header before the first scrape.
+type csvEncoder struct {
+	headerDone bool
+}
+
+func (e *csvEncoder) encode(w *bufio.Writer, scrapeTime time.Time, samples []sinkSample) error {
+	cw := csv.NewWriter(w)
+	if !e.headerDone {
+		cw.Write([]string{"timestamp", "series", "value"})
+		e.headerDone = true
+	}
+	timestamp := scrapeTime.Format(time.RFC3339Nano)
+	for _, sample := range samples {
+		cw.Write([]string{timestamp, sample.sig, strconv.FormatFloat(sample.value, 'g', -1, 64)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// jsonlEncoder writes one JSON object per sample and line. Values which JSON
+// cannot represent (NaN, ±Inf) are written as strings.
+type jsonlEncoder struct{}
+
+func (jsonlEncoder) encode(w *bufio.Writer, scrapeTime time.Time, samples []sinkSample) error {
+	enc := json.NewEncoder(w)
+	for _, sample := range samples {
+		var value any = sample.value
+		if math.IsNaN(sample.value) || math.IsInf(sample.value, 0) {
+			value = strconv.FormatFloat(sample.value, 'g', -1, 64)
+		}
+		err := enc.Encode(struct {
+			Timestamp string            `json:"timestamp"`
+			Name      string            `json:"name"`
+			Labels    map[string]string `json:"labels"`
+			Value     any               `json:"value"`
+		}{scrapeTime.Format(time.RFC3339Nano), sample.name, sample.labels, value})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
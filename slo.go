@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// fastBurnRate is the burn rate exhausting a 30 day error budget in two
+// days, the usual threshold for paging.
+const fastBurnRate = 14.4
+
+// sloGraphWidth is the width of the graph of the success ratio per scrape.
+const sloGraphWidth = 12
+
+// slo is a success ratio watched with -slo: one minus the increase of the
+// errors over the increase of the total within the sliding -slo-window.
+type slo struct {
+	name      string
+	objective float64 // Success ratio to keep, e.g. 0.999
+	errors    *selector
+	total     *selector
+	last      sloStatus // As of the last scrape
+}
+
+// sloStatus is the state of an SLO over the window.
+type sloStatus struct {
+	ratio    float64       // Success ratio, NaN without traffic
+	burn     float64       // Error ratio over the error budget
+	span     time.Duration // Covered by the history, at most the window
+	ratios   []float64     // Success ratio between consecutive scrapes
+	selected bool          // Whether any series was selected
+}
+
+// parseSLO parses an SLO of the form `<name> <objective %> <errors selector>
+// / <total selector>`, e.g. `checkout 99.9 http_requests_total{code=~"5.."}
+// / http_requests_total`.
+func parseSLO(spec string) (*slo, error) {
+	name, rest, _ := strings.Cut(strings.TrimSpace(spec), " ")
+	objective, expr, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	if name == "" || expr == "" {
+		return nil, fmt.Errorf("invalid slo '%s'. Must be <name> <objective %%> <errors selector> / <total selector>", spec)
+	}
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(objective, "%"), 64)
+	if err != nil || percent <= 0 || percent >= 100 {
+		return nil, fmt.Errorf("invalid slo '%s': objective must be a percentage between 0 and 100", spec)
+	}
+	parsed, err := parser.ParseExpr(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid slo '%s': %v", spec, err)
+	}
+	div, ok := parsed.(*parser.BinaryExpr)
+	if !ok || div.Op != parser.DIV {
+		return nil, fmt.Errorf("invalid slo '%s': must divide an errors selector by a total selector", spec)
+	}
+	errSel, ok1 := div.LHS.(*parser.VectorSelector)
+	totalSel, ok2 := div.RHS.(*parser.VectorSelector)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("invalid slo '%s': must divide an errors selector by a total selector", spec)
+	}
+	return &slo{
+		name:      name,
+		objective: percent / 100,
+		errors:    &selector{matchers: errSel.LabelMatchers},
+		total:     &selector{matchers: totalSel.LabelMatchers},
+	}, nil
+}
+
+func parseSLOs(specs []string) ([]*slo, error) {
+	var slos []*slo
+	for _, spec := range specs {
+		s, err := parseSLO(spec)
+		if err != nil {
+			return nil, err
+		}
+		slos = append(slos, s)
+	}
+	return slos, nil
+}
+
+// increases returns the increase of the selected counters between
+// consecutive scrapes from the scrape at index from in the history on,
+// summed over the series. Counter resets are taken as restarts from zero.
+func increases(store *Store, sel *selector, from int) ([]float64, bool) {
+	res := make([]float64, len(store.times)-from-1)
+	found := false
+	for _, series := range store.Metrics {
+		if !sel.matches(series) {
+			continue
+		}
+		found = true
+		// Values are aligned with the scrape times from the end
+		shift := len(store.times) - len(series.Values)
+		for i := range res {
+			j := from + i - shift
+			if j < 0 {
+				continue
+			}
+			prev, cur := series.Values[j], series.Values[j+1]
+			switch {
+			case math.IsNaN(prev) || math.IsNaN(cur):
+			case cur < prev:
+				res[i] += cur
+			default:
+				res[i] += cur - prev
+			}
+		}
+	}
+	return res, found
+}
+
+// evaluate computes the status of the SLO over the scrapes of the last
+// window.
+func (s *slo) evaluate(store *Store, window time.Duration) sloStatus {
+	status := sloStatus{ratio: math.NaN(), burn: math.NaN()}
+	if len(store.times) < 2 {
+		return status
+	}
+	last := store.times[len(store.times)-1]
+	from := len(store.times) - 1
+	for from > 0 && last.Sub(store.times[from-1]) <= window {
+		from--
+	}
+	status.span = last.Sub(store.times[from])
+
+	errs, found1 := increases(store, s.errors, from)
+	total, found2 := increases(store, s.total, from)
+	status.selected = found1 || found2
+	var errSum, totalSum float64
+	status.ratios = make([]float64, len(total))
+	for i := range total {
+		errSum += errs[i]
+		totalSum += total[i]
+		status.ratios[i] = math.NaN()
+		if total[i] > 0 {
+			status.ratios[i] = 1 - errs[i]/total[i]
+		}
+	}
+	if totalSum > 0 {
+		status.ratio = 1 - errSum/totalSum
+		status.burn = (errSum / totalSum) / (1 - s.objective)
+	}
+	return status
+}
+
+// evaluateSLOs updates the -slo statuses after a scrape.
+func (m *model) evaluateSLOs() {
+	for _, s := range m.slos {
+		s.last = s.evaluate(m.store, m.cfg.SLOWindow)
+	}
+}
+
+// formatRatio formats a success ratio as a percentage with as many decimals
+// as the objective needs.
+func formatRatio(ratio, objective float64) string {
+	// One more than the error budget in percent needs, e.g. 99.90% for 99.9%
+	decimals := max(int(math.Ceil(-math.Log10((1-objective)*100)-1e-9)), 0) + 1
+	return strconv.FormatFloat(ratio*100, 'f', decimals, 64) + "%"
+}
+
+// renderSLOPanel renders a line per -slo with the success ratio over the
+// window, the burn rate of the error budget and a graph of the ratio.
+func (m model) renderSLOPanel() string {
+	okStyle := lipgloss.NewStyle().Foreground(color("42"))       // green
+	burningStyle := lipgloss.NewStyle().Foreground(color("220")) // yellow
+	fastStyle := lipgloss.NewStyle().Foreground(color("196"))    // red
+	lines := make([]string, 0, len(m.slos))
+	for _, s := range m.slos {
+		st := s.last
+		objective := formatRatio(s.objective, s.objective)
+		var line string
+		switch {
+		case !st.selected:
+			line = m.labelStyle.Render(fmt.Sprintf("SLO %s: no series selected (objective %s)", s.name, objective))
+		case math.IsNaN(st.ratio):
+			line = m.labelStyle.Render(fmt.Sprintf("SLO %s: no traffic in %s (objective %s)", s.name, st.span.Round(time.Second), objective))
+		default:
+			style, state := okStyle, "ok"
+			switch {
+			case st.burn >= fastBurnRate:
+				style, state = fastStyle, "fast burn"
+			case st.burn >= 1:
+				style, state = burningStyle, "burning"
+			}
+			line = fmt.Sprintf("SLO %s: %s over %s (objective %s), burn %.1fx %s %s",
+				s.name, style.Render(formatRatio(st.ratio, s.objective)), st.span.Round(time.Second), objective,
+				st.burn, style.Render(state), m.currentValueStyle.Render(brailleGraph(st.ratios, sloGraphWidth)))
+		}
+		lines = append(lines, ansi.Truncate(line, m.width, "…"))
+	}
+	return strings.Join(lines, "\n")
+}
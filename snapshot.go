@@ -0,0 +1,276 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Snapshot comparison sort orders
+const (
+	CompareSortAbsolute = "absolute" // Largest absolute change first
+	CompareSortPercent  = "percent"  // Largest relative change first
+)
+
+// snapshot is the current value of every series at one point in time.
+type snapshot struct {
+	taken  time.Time
+	values map[string]snapshotValue // By signature
+}
+
+type snapshotValue struct {
+	name   string
+	unit   string
+	labels map[string]string
+	value  float64
+}
+
+// compareView is the state of the snapshot comparison, which replaces the
+// table while open.
+type compareView struct {
+	sort    string
+	yOffset int // Scroll position of the table, restored on close
+}
+
+// seriesChange is the change of a series from snapshot A to B. A series
+// absent from A appeared and one absent from B disappeared in between.
+type seriesChange struct {
+	snapshotValue
+	sig         string
+	a, b        float64
+	appeared    bool
+	disappeared bool
+}
+
+// percent returns the change relative to the value in A, infinite if that
+// is zero.
+func (c seriesChange) percent() float64 {
+	if c.a == 0 {
+		return math.Inf(1)
+	}
+	return (c.b - c.a) / math.Abs(c.a) * 100
+}
+
+// takeSnapshot captures the current value of the series in the store. Series
+// missing from the last scrape are left out.
+func (m model) takeSnapshot() *snapshot {
+	_, taken, _ := m.store.TimeRange()
+	snap := &snapshot{taken: taken, values: make(map[string]snapshotValue, len(m.store.Metrics))}
+	for sig, series := range m.store.Metrics {
+		if len(series.Values) == 0 || math.IsNaN(series.Values[len(series.Values)-1]) {
+			continue
+		}
+		snap.values[sig] = snapshotValue{
+			name:   series.Name,
+			unit:   series.Unit,
+			labels: series.Labels,
+			value:  series.Values[len(series.Values)-1],
+		}
+	}
+	return snap
+}
+
+// compareSnapshots returns the series which changed, appeared or disappeared
+// from a to b, ordered by sortMode with the appeared and disappeared ones
+// last, and the number of unchanged series.
+func compareSnapshots(a, b *snapshot, sortMode string) ([]seriesChange, int) {
+	var changes []seriesChange
+	unchanged := 0
+	for sig, va := range a.values {
+		vb, ok := b.values[sig]
+		switch {
+		case !ok:
+			changes = append(changes, seriesChange{snapshotValue: va, sig: sig, a: va.value, b: math.NaN(), disappeared: true})
+		case vb.value == va.value:
+			unchanged++
+		default:
+			changes = append(changes, seriesChange{snapshotValue: vb, sig: sig, a: va.value, b: vb.value})
+		}
+	}
+	for sig, vb := range b.values {
+		if _, ok := a.values[sig]; !ok {
+			changes = append(changes, seriesChange{snapshotValue: vb, sig: sig, a: math.NaN(), b: vb.value, appeared: true})
+		}
+	}
+
+	rank := func(c seriesChange) int {
+		switch {
+		case c.appeared:
+			return 1
+		case c.disappeared:
+			return 2
+		}
+		return 0
+	}
+	magnitude := func(c seriesChange) float64 {
+		if sortMode == CompareSortPercent {
+			return math.Abs(c.percent())
+		}
+		return math.Abs(c.b - c.a)
+	}
+	slices.SortFunc(changes, func(x, y seriesChange) int {
+		if c := cmp.Compare(rank(x), rank(y)); c != 0 {
+			return c
+		}
+		if rank(x) == 0 {
+			if c := cmp.Compare(magnitude(y), magnitude(x)); c != 0 {
+				return c
+			}
+		}
+		return strings.Compare(x.sig, y.sig)
+	})
+	return changes, unchanged
+}
+
+// captureSnapshot takes snapshot A, or B if A was taken last, and opens the
+// comparison of the two after taking B.
+func (m model) captureSnapshot() model {
+	snap := m.takeSnapshot()
+	if len(snap.values) == 0 {
+		m.notice = "No samples to snapshot yet"
+		return m
+	}
+	if m.snapshotA == nil || m.snapshotB != nil {
+		m.snapshotA, m.snapshotB = snap, nil
+		m.notice = "Took snapshot A, S again for B"
+		return m
+	}
+	m.snapshotB = snap
+	if m.compare != nil {
+		if m.viewportReady {
+			m.refreshTable()
+		}
+		return m
+	}
+	return m.toggleCompare()
+}
+
+// toggleCompare opens or closes the comparison of snapshots A and B.
+func (m model) toggleCompare() model {
+	if m.compare != nil {
+		yOffset := m.compare.yOffset
+		m.compare = nil
+		if m.viewportReady {
+			m.refreshTable()
+			m.viewport.SetYOffset(yOffset)
+			m.ensureRendered()
+		}
+		return m
+	}
+	if m.snapshotA == nil || m.snapshotB == nil {
+		m.notice = "Take snapshots A and B with S first"
+		return m
+	}
+	m.compare = &compareView{sort: CompareSortAbsolute, yOffset: m.viewport.YOffset}
+	if m.viewportReady {
+		m.refreshTable()
+		m.viewport.GotoTop()
+	}
+	return m
+}
+
+// updateCompare handles keys while the snapshot comparison is open.
+func (m model) updateCompare(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return m, tea.Quit
+	case "D", "esc":
+		return m.toggleCompare(), nil
+	case "S":
+		return m.captureSnapshot(), nil
+	case "o":
+		// Toggle between sorting by absolute and by relative change
+		if m.compare.sort == CompareSortAbsolute {
+			m.compare.sort = CompareSortPercent
+		} else {
+			m.compare.sort = CompareSortAbsolute
+		}
+		m.refreshTable()
+		return m, nil
+	case "up", "k":
+		m.viewport.ScrollUp(1)
+		return m, nil
+	case "down", "j":
+		m.viewport.ScrollDown(1)
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.viewport, cmd = m.viewport.Update(msg)
+	return m, cmd
+}
+
+// refreshCompare renders the snapshot comparison in place of the table.
+func (m *model) refreshCompare() {
+	changes, _ := compareSnapshots(m.snapshotA, m.snapshotB, m.compare.sort)
+	rows := make([][]string, 0, len(changes))
+	for _, c := range changes {
+		name := m.metricNameStyle.Render(displayName(c.name, false, m.cfg.EscapedNames))
+		if len(c.labels) > 0 {
+			var labelParts []string
+			for k, v := range c.labels {
+				labelParts = append(labelParts, fmt.Sprintf("%s=%s", displayName(k, true, m.cfg.EscapedNames), v))
+			}
+			sort.Strings(labelParts)
+			name += m.labelStyle.Render("{" + strings.Join(labelParts, ",") + "}")
+		}
+
+		a, b, change, percent := "", "", "", ""
+		switch {
+		case c.appeared:
+			b = m.formatValue(c.unit, c.b)
+			change = m.currentValueStyle.Render("new")
+		case c.disappeared:
+			a = m.formatValue(c.unit, c.a)
+			change = m.labelStyle.Render("gone")
+		default:
+			a, b = m.formatValue(c.unit, c.a), m.formatValue(c.unit, c.b)
+			change = m.formatValue(c.unit, c.b-c.a)
+			if c.b > c.a {
+				change = "+" + change
+			}
+			if p := c.percent(); !math.IsInf(p, 0) {
+				percent = fmt.Sprintf("%+.1f%%", p)
+			}
+		}
+		rows = append(rows, []string{name, a, b, change, percent})
+	}
+	headers := []string{"Series", "A", "B", "Change", "%"}
+
+	// Shorten the names to fit the terminal
+	widths := calculateColumnWidths(headers, rows)
+	others := m.explorerBorders(len(widths))
+	for _, w := range widths[1:] {
+		others += w
+	}
+	nameWidth := min(widths[0], max(m.width-others, minNameWidth))
+	for _, row := range rows {
+		row[0] = elideName(row[0], nameWidth)
+	}
+
+	m.renderExplorer(headers, rows, func(col int) bool { return col > 0 })
+}
+
+// compareStatus returns the footer status of the snapshot comparison.
+func (m model) compareStatus() string {
+	changes, unchanged := compareSnapshots(m.snapshotA, m.snapshotB, m.compare.sort)
+	changed, appeared, disappeared := 0, 0, 0
+	for _, c := range changes {
+		switch {
+		case c.appeared:
+			appeared++
+		case c.disappeared:
+			disappeared++
+		default:
+			changed++
+		}
+	}
+	a, b := m.snapshotA.taken, m.snapshotB.taken
+	return fmt.Sprintf("Compare: A %s, B %s (%s later), %d changed, %d new, %d gone, %d unchanged, by %s (o to sort, D to close)",
+		a.Format("15:04:05"), b.Format("15:04:05"), b.Sub(a).Round(time.Second), changed, appeared, disappeared, unchanged, m.compare.sort)
+}
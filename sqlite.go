@@ -0,0 +1,167 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema stores one row per scrape and per sample. Labels are a JSON
+// object, so they can be queried with json_extract(labels, '$.code').
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS scrapes (
+	id   INTEGER PRIMARY KEY,
+	time INTEGER NOT NULL -- Unix milliseconds
+);
+CREATE TABLE IF NOT EXISTS series (
+	id        INTEGER PRIMARY KEY,
+	signature TEXT NOT NULL UNIQUE,
+	name      TEXT NOT NULL,
+	type      TEXT NOT NULL,
+	labels    TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS series_name ON series (name);
+CREATE INDEX IF NOT EXISTS series_labels ON series (labels);
+CREATE TABLE IF NOT EXISTS samples (
+	scrape_id INTEGER NOT NULL REFERENCES scrapes (id),
+	series_id INTEGER NOT NULL REFERENCES series (id),
+	value     REAL,
+	PRIMARY KEY (scrape_id, series_id)
+);
+CREATE INDEX IF NOT EXISTS samples_series ON samples (series_id);
+`
+
+// SQLiteSink stores every sample of a session in a SQLite database for later
+// analysis with SQL or replay with the mock server.
+type SQLiteSink struct {
+	db     *sql.DB
+	series map[string]int64 // Series ids by signature
+}
+
+func init() {
+	RegisterSink("sqlite", func(target string) (Sink, error) { return NewSQLiteSink(target) })
+}
+
+func NewSQLiteSink(path string) (*SQLiteSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("missing file name")
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// Writes are serialized by the sink set anyway
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &SQLiteSink{db: db, series: make(map[string]int64)}
+	rows, err := db.Query("SELECT id, signature FROM series")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var sig string
+		if err := rows.Scan(&id, &sig); err != nil {
+			db.Close()
+			return nil, err
+		}
+		s.series[sig] = id
+	}
+	return s, rows.Err()
+}
+
+// Write stores a scrape in a single transaction.
+func (s *SQLiteSink) Write(families map[string]*dto.MetricFamily, scrapeTime time.Time) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	// Ids of series created in this transaction, only kept if it commits
+	created := make(map[string]int64)
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			for sig := range created {
+				delete(s.series, sig)
+			}
+		}
+	}()
+
+	res, err := tx.Exec("INSERT INTO scrapes (time) VALUES (?)", scrapeTime.UnixMilli())
+	if err != nil {
+		return err
+	}
+	scrapeID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	insertSeries, err := tx.Prepare("INSERT INTO series (signature, name, type, labels) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer insertSeries.Close()
+	insertSample, err := tx.Prepare("INSERT INTO samples (scrape_id, series_id, value) VALUES (?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer insertSample.Close()
+
+	// Series repeated in the scrape keep their first sample, as in the Store
+	inserted := make(map[int64]bool)
+	for _, family := range families {
+		name := family.GetName()
+		kind := strings.ToLower(family.GetType().String())
+		for _, metric := range family.GetMetric() {
+			value, ok := sampleValue(metric)
+			if !ok {
+				continue
+			}
+			sig := labelPairsSignature(name, metric.GetLabel())
+			id, known := s.series[sig]
+			if !known {
+				labels := make(map[string]string)
+				for _, label := range metric.GetLabel() {
+					labels[label.GetName()] = label.GetValue()
+				}
+				// Map keys are sorted, so equal label sets are equal strings
+				labelsJSON, err := json.Marshal(labels)
+				if err != nil {
+					return err
+				}
+				res, err := insertSeries.Exec(sig, name, kind, string(labelsJSON))
+				if err != nil {
+					return err
+				}
+				if id, err = res.LastInsertId(); err != nil {
+					return err
+				}
+				s.series[sig] = id
+				created[sig] = id
+			}
+			if inserted[id] {
+				continue
+			}
+			inserted[id] = true
+			// SQLite stores NaN as NULL
+			if _, err := insertSample.Exec(scrapeID, id, value); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteSink) Close() error {
+	return s.db.Close()
+}
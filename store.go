@@ -1,18 +1,74 @@
 package main
 
 import (
-	"fmt"
+	"cmp"
 	"math"
-	"sort"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	dto "github.com/prometheus/client_model/go"
+	promModel "github.com/prometheus/common/model"
 )
 
 type MetricSeries struct {
 	Name   string
+	Unit   string
+	Type   dto.MetricType
 	Labels map[string]string
 	Values []float64
+
+	// Timestamp is the last exposition timestamp in ms (0 if none) and
+	// StaleScrapes the number of consecutive scrapes repeating it. Only
+	// tracked with Store.UseTimestamps.
+	Timestamp    int64
+	StaleScrapes int
+
+	// FirstSeen is when the series appeared during the session
+	FirstSeen time.Time
+	// Derived marks synthetic series computed from others, see updateDerived
+	Derived bool
+
+	sig       string // Signature, see signature
+	sortKey   string // Orders rows, with bucket rows numerically by le
+	version   uint64 // Incremented on every change of Values
+	firstSeen uint64 // Store.scrapes when the series appeared
+	lastSeen  uint64 // Store.scrapes when the series was last present
+}
+
+// signature returns the signature of the series, kept from its creation as
+// rows look it up on every render.
+func (s *MetricSeries) signature() string {
+	if s.sig == "" {
+		s.sig = GenerateSignature(s.Name, s.Labels)
+	}
+	return s.sig
+}
+
+// staleTimestampScrapes is the number of scrapes with a repeated timestamp
+// after which a series is considered stuck.
+const staleTimestampScrapes = 2
+
+// TimestampStale reports whether the exposition timestamp of the series has
+// stopped advancing.
+func (s *MetricSeries) TimestampStale() bool {
+	return s.StaleScrapes >= staleTimestampScrapes
+}
+
+// ValuesFromReference returns the differences of the values to the value
+// age samples before the last one. All are missing if it is.
+func (s *MetricSeries) ValuesFromReference(age int) []float64 {
+	ref := math.NaN()
+	if i := len(s.Values) - 1 - age; i >= 0 && i < len(s.Values) {
+		ref = s.Values[i]
+	}
+	res := make([]float64, len(s.Values))
+	for i, v := range s.Values {
+		res[i] = v - ref
+	}
+	return res
 }
 
 // ValuesWithDeltas returns the values, optionally converting them to deltas based on the mode.
@@ -74,95 +130,492 @@ func (s *MetricSeries) ValuesWithDeltas(mode string) []float64 {
 	return res
 }
 
+// scrapeStatus is the outcome of a scrape, see Store.ScrapeStatus.
+type scrapeStatus uint8
+
+const (
+	scrapeOK      scrapeStatus = iota
+	scrapePartial              // Some targets failed
+	scrapeFailed               // No samples, all values are missing
+	scrapePaused               // Gap of a pause, see RecordPause
+)
+
+// maxInternedStrings bounds the intern table under series churn.
+const maxInternedStrings = 1 << 16
+
 type Store struct {
 	Metrics      map[string]*MetricSeries
+	Derived      map[string]*MetricSeries // Synthetic series, see updateDerived
 	HistoryLimit int
+
+	// MaxBytes bounds the estimated memory use (0 for no limit). Exceeding it
+	// evicts series and reduces the history, see enforceBudget.
+	MaxBytes int64
+	// UsedBytes is the estimated memory use after the last update
+	UsedBytes int64
+	// UseTimestamps honors exposition timestamps: a sample repeating the
+	// previous timestamp is not a new sample and is recorded as missing.
+	UseTimestamps bool
+	// evicted holds the signatures of exposed series evicted for MaxBytes,
+	// which are not stored again so the budget holds
+	evicted map[string]bool
+
+	scrapes    uint64
+	failures   uint64 // Scrapes recorded with RecordFailure
+	firstOK    uint64 // Scrape of the first UpdateFromFamilies, see IsNew
+	updated    uint64 // Scrape of the last UpdateFromFamilies
+	prevUpdate uint64 // Scrape of the one before, see Changes
+	lastScrape time.Time
+	status     []scrapeStatus    // Outcome of the scrapes in the history, oldest first
+	times      []time.Time       // Time of the scrapes in the history, oldest first
+	strings    map[string]string // Interned label names and values
+	sigBuf     []byte            // Reused for building signatures
+	pairs      []*dto.LabelPair  // Reused for sorting labels
 }
 
 func NewStore(historyLimit int) *Store {
 	return &Store{
 		Metrics:      make(map[string]*MetricSeries),
+		Derived:      make(map[string]*MetricSeries),
 		HistoryLimit: historyLimit,
+		strings:      make(map[string]string),
 	}
 }
 
+// intern returns a shared copy of str so the label maps of many series don't
+// each hold their own copies of the same names and values.
+func (s *Store) intern(str string) string {
+	if interned, ok := s.strings[str]; ok {
+		return interned
+	}
+	if len(s.strings) >= maxInternedStrings {
+		// Start over rather than keep the values of long gone series forever
+		clear(s.strings)
+	}
+	s.strings[str] = str
+	return str
+}
+
+// signatureScratch holds reusable buffers for building signatures.
+type signatureScratch struct {
+	buf   []byte
+	keys  []string
+	pairs []*dto.LabelPair
+}
+
+var signaturePool = sync.Pool{New: func() any { return new(signatureScratch) }}
+
 // GenerateSignature creates a unique key for a metric based on name and labels
 func GenerateSignature(name string, labels map[string]string) string {
+	scratch := signaturePool.Get().(*signatureScratch)
+	defer signaturePool.Put(scratch)
+
 	// Sort label keys to ensure consistent signature
-	keys := make([]string, 0, len(labels))
+	keys := scratch.keys[:0]
 	for k := range labels {
 		keys = append(keys, k)
 	}
-	sort.Strings(keys)
+	slices.Sort(keys)
+	scratch.keys = keys
 
-	var sb strings.Builder
-	sb.WriteString(name)
-	sb.WriteString("{")
+	buf := append(scratch.buf[:0], name...)
+	buf = append(buf, '{')
 	for i, k := range keys {
 		if i > 0 {
-			sb.WriteString(",")
+			buf = append(buf, ',')
 		}
-		sb.WriteString(fmt.Sprintf("%s=%q", k, labels[k]))
+		buf = append(buf, k...)
+		buf = append(buf, '=')
+		buf = strconv.AppendQuote(buf, labels[k])
 	}
-	sb.WriteString("}")
-	return sb.String()
+	buf = append(buf, '}')
+	scratch.buf = buf
+	return string(buf)
+}
+
+// labelPairsSignature returns the signature of a series given its label
+// pairs in any order, without building a label map.
+func labelPairsSignature(name string, labels []*dto.LabelPair) string {
+	scratch := signaturePool.Get().(*signatureScratch)
+	defer signaturePool.Put(scratch)
+
+	scratch.pairs = sortLabelPairs(scratch.pairs, labels)
+	scratch.buf = appendSignature(scratch.buf[:0], name, scratch.pairs)
+	return string(scratch.buf)
+}
+
+// sortLabelPairs copies labels into dst, sorted by name.
+func sortLabelPairs(dst, labels []*dto.LabelPair) []*dto.LabelPair {
+	dst = append(dst[:0], labels...)
+	slices.SortFunc(dst, func(a, b *dto.LabelPair) int { return strings.Compare(a.GetName(), b.GetName()) })
+	return dst
+}
+
+// appendSignature appends the signature of a series to buf, in the same
+// format as GenerateSignature. Labels must be sorted by name.
+func appendSignature(buf []byte, name string, labels []*dto.LabelPair) []byte {
+	buf = append(buf, name...)
+	buf = append(buf, '{')
+	for i, label := range labels {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, label.GetName()...)
+		buf = append(buf, '=')
+		buf = strconv.AppendQuote(buf, label.GetValue())
+	}
+	return append(buf, '}')
 }
 
 // UpdateFromFamilies updates the store with a fresh batch of metrics.
 // It handles appending new values and filling missing metrics with NaN.
+//
+// Label sets are stable between scrapes, so samples of known series are
+// looked up without allocating a label map or signature string.
 func (s *Store) UpdateFromFamilies(families map[string]*dto.MetricFamily) {
-	seenSignatures := make(map[string]bool)
-
+	s.scrapes++
+	s.prevUpdate, s.updated = s.updated, s.scrapes
+	if s.firstOK == 0 {
+		s.firstOK = s.scrapes
+	}
+	now := time.Now()
 	for _, family := range families {
 		name := family.GetName()
+		unit := ""
 		for _, metric := range family.GetMetric() {
-			labels := make(map[string]string)
-			for _, label := range metric.GetLabel() {
-				labels[label.GetName()] = label.GetValue()
+			value, ok := sampleValue(metric)
+			if !ok {
+				continue
 			}
 
-			var value float64
-			if metric.Gauge != nil {
-				value = metric.Gauge.GetValue()
-			} else if metric.Counter != nil {
-				value = metric.Counter.GetValue()
-			} else if metric.Untyped != nil {
-				value = metric.Untyped.GetValue()
-			} else {
-				// Skip complex types for now
+			s.pairs = sortLabelPairs(s.pairs, metric.GetLabel())
+			s.sigBuf = appendSignature(s.sigBuf[:0], name, s.pairs)
+
+			series, exists := s.Metrics[string(s.sigBuf)]
+			if !exists && s.evicted[string(s.sigBuf)] {
+				continue
+			}
+			if exists && series.lastSeen == s.scrapes {
+				// Repeated in the same scrape, e.g. by targets with the
+				// same labels, keep the first sample so the history stays
+				// aligned with the scrape times
 				continue
 			}
+			if !exists {
+				if unit == "" {
+					unit = inferUnit(name, family.GetUnit())
+				}
+				labels := make(map[string]string, len(s.pairs))
+				for _, label := range s.pairs {
+					labels[s.intern(label.GetName())] = s.intern(label.GetValue())
+				}
+				series = &MetricSeries{
+					Name:   s.intern(name),
+					Unit:   unit,
+					Type:   family.GetType(),
+					Labels: labels,
+					Values: make([]float64, 0, s.HistoryLimit),
 
-			sig := GenerateSignature(name, labels)
-			s.updateMetric(sig, name, labels, value)
-			seenSignatures[sig] = true
+					FirstSeen: now,
+					firstSeen: s.scrapes,
+				}
+				series.sig = string(s.sigBuf)
+				series.sortKey = seriesSortKey(series.sig, series)
+				s.Metrics[series.sig] = series
+			}
+			series.lastSeen = s.scrapes
+			if s.UseTimestamps && metric.TimestampMs != nil {
+				if ts := metric.GetTimestampMs(); ts <= series.Timestamp {
+					series.StaleScrapes++
+					value = math.NaN()
+				} else {
+					series.Timestamp = ts
+					series.StaleScrapes = 0
+				}
+			}
+			s.appendValue(series, value)
 		}
 	}
 
 	// Handle missing metrics
-	for sig, series := range s.Metrics {
-		if !seenSignatures[sig] {
+	for _, series := range s.Metrics {
+		if series.lastSeen != s.scrapes {
 			s.appendValue(series, math.NaN())
 		}
 	}
+	s.updateDerived(now)
+	s.appendStatus(scrapeOK, now)
+
+	s.UsedBytes = s.estimateBytes()
+	if s.MaxBytes > 0 && s.UsedBytes > s.MaxBytes {
+		s.enforceBudget()
+	}
+}
+
+// RecordFailure records a failed scrape, adding a missing value to all series
+// so the history stays aligned with the scrape times.
+func (s *Store) RecordFailure() {
+	s.scrapes++
+	s.failures++
+	for _, metrics := range []map[string]*MetricSeries{s.Metrics, s.Derived} {
+		for _, series := range metrics {
+			s.appendValue(series, math.NaN())
+		}
+	}
+	s.appendStatus(scrapeFailed, time.Now())
+}
+
+// RecordPause records a gap for a pause after the last scrape, adding a
+// missing value to all series so the samples before and after the pause are
+// never adjacent in the history.
+func (s *Store) RecordPause() {
+	if len(s.status) == 0 {
+		return
+	}
+	s.scrapes++
+	for _, metrics := range []map[string]*MetricSeries{s.Metrics, s.Derived} {
+		for _, series := range metrics {
+			s.appendValue(series, math.NaN())
+		}
+	}
+	s.appendStatus(scrapePaused, time.Now())
+}
+
+// MarkPartial marks the last scrape as having failed for some targets.
+func (s *Store) MarkPartial() {
+	if len(s.status) > 0 {
+		s.status[len(s.status)-1] = scrapePartial
+	}
 }
 
-func (s *Store) updateMetric(sig, name string, labels map[string]string, value float64) {
-	series, exists := s.Metrics[sig]
-	if !exists {
-		series = &MetricSeries{
-			Name:   name,
-			Labels: labels,
-			Values: make([]float64, 0, s.HistoryLimit),
+// ScrapeStatus returns the outcome of the scrape age scrapes before the last
+// one, and false if it is not in the history.
+func (s *Store) ScrapeStatus(age int) (scrapeStatus, bool) {
+	i := len(s.status) - 1 - age
+	if i < 0 || age < 0 {
+		return scrapeOK, false
+	}
+	return s.status[i], true
+}
+
+// ScrapeAge returns the measured time from the scrape age scrapes before the
+// last one to the last one, and false if it is not in the history. It differs
+// from age polling intervals when scrapes were delayed, e.g. under load.
+func (s *Store) ScrapeAge(age int) (time.Duration, bool) {
+	i := len(s.times) - 1 - age
+	if i < 0 || age < 0 {
+		return 0, false
+	}
+	return s.times[len(s.times)-1].Sub(s.times[i]), true
+}
+
+// TimeRange returns the times of the oldest and the last scrape in the
+// history, and false before the first scrape.
+func (s *Store) TimeRange() (time.Time, time.Time, bool) {
+	if len(s.times) == 0 {
+		return time.Time{}, time.Time{}, false
+	}
+	return s.times[0], s.times[len(s.times)-1], true
+}
+
+func (s *Store) appendStatus(status scrapeStatus, t time.Time) {
+	s.status = append(s.status, status)
+	s.times = append(s.times, t)
+	if len(s.status) > s.HistoryLimit {
+		s.status = s.status[len(s.status)-s.HistoryLimit:]
+		s.times = s.times[len(s.times)-s.HistoryLimit:]
+	}
+}
+
+// seriesSortKey returns the key ordering the rows of series. It is the
+// signature, except for bucket series, which sort by the signature without
+// le followed by the numeric le value.
+func seriesSortKey(sig string, series *MetricSeries) string {
+	le, ok := series.Labels[promModel.BucketLabel]
+	if !ok {
+		return sig
+	}
+	labels := make(map[string]string, len(series.Labels)-1)
+	for k, v := range series.Labels {
+		if k != promModel.BucketLabel {
+			labels[k] = v
+		}
+	}
+	return GenerateSignature(series.Name, labels) + "\x00" + boundSortKey(le)
+}
+
+// IsNew reports whether a series appeared less than scrapes scrapes ago, but
+// after the first successful scrape so failed scrapes before it don't make
+// every series new.
+func (s *Store) IsNew(series *MetricSeries, scrapes int) bool {
+	return series.firstSeen > s.firstOK && s.scrapes-series.firstSeen < uint64(scrapes)
+}
+
+// Changes returns the signatures of the series which appeared, disappeared
+// or, for counters, were reset in the last scrape, sorted. They are relative
+// to the previous successful scrape, so failed scrapes and pauses in between
+// neither hide a change nor report one.
+func (s *Store) Changes() (appeared, disappeared, resets []string) {
+	if s.prevUpdate == 0 {
+		return nil, nil, nil
+	}
+	for sig, series := range s.Metrics {
+		switch {
+		case series.firstSeen == s.updated:
+			appeared = append(appeared, sig)
+		case series.lastSeen == s.prevUpdate:
+			disappeared = append(disappeared, sig)
+		case series.Type == dto.MetricType_COUNTER && series.lastSeen == s.updated:
+			// Compare with the last sample before the gap, if any
+			curr := series.Values[len(series.Values)-1]
+			for i := len(series.Values) - 2; i >= 0; i-- {
+				if prev := series.Values[i]; !math.IsNaN(prev) {
+					if curr < prev {
+						resets = append(resets, sig)
+					}
+					break
+				}
+			}
+		}
+	}
+	slices.Sort(appeared)
+	slices.Sort(disappeared)
+	slices.Sort(resets)
+	return appeared, disappeared, resets
+}
+
+// seriesOverhead approximates the fixed memory cost of a series: the struct,
+// its label map and the Metrics map entry.
+const seriesOverhead = 256
+
+// seriesBytes estimates the memory used by a series. Interned label strings
+// are counted per series, so this errs on the high side.
+func seriesBytes(sig string, series *MetricSeries) int64 {
+	n := int64(seriesOverhead + len(sig) + 8*cap(series.Values))
+	for k, v := range series.Labels {
+		n += int64(len(k) + len(v) + 32)
+	}
+	return n
+}
+
+func (s *Store) estimateBytes() int64 {
+	var n int64
+	for sig, series := range s.Metrics {
+		n += seriesBytes(sig, series)
+	}
+	for sig, series := range s.Derived {
+		n += seriesBytes(sig, series)
+	}
+	return n
+}
+
+// enforceBudget brings the memory estimate below MaxBytes by, in order,
+// evicting series no longer exposed (longest gone first), reducing the
+// history down to two samples, and finally evicting current series, which
+// are then skipped by later scrapes.
+func (s *Store) enforceBudget() {
+	type entry struct {
+		sig    string
+		series *MetricSeries
+	}
+	var gone, present []entry
+	for sig, series := range s.Metrics {
+		if series.lastSeen != s.scrapes {
+			gone = append(gone, entry{sig, series})
+		} else {
+			present = append(present, entry{sig, series})
+		}
+	}
+	slices.SortFunc(gone, func(a, b entry) int { return cmp.Compare(a.series.lastSeen, b.series.lastSeen) })
+	for _, e := range gone {
+		if s.UsedBytes <= s.MaxBytes {
+			return
+		}
+		s.UsedBytes -= seriesBytes(e.sig, e.series)
+		delete(s.Metrics, e.sig)
+	}
+
+	for s.UsedBytes > s.MaxBytes && s.HistoryLimit > 2 {
+		s.HistoryLimit = max(s.HistoryLimit/2, 2)
+		for _, metrics := range []map[string]*MetricSeries{s.Metrics, s.Derived} {
+			for _, series := range metrics {
+				// Copy to release the backing array of the longer history
+				keep := series.Values[max(len(series.Values)-s.HistoryLimit, 0):]
+				series.Values = append(make([]float64, 0, s.HistoryLimit), keep...)
+				series.version++
+			}
+		}
+		s.UsedBytes = s.estimateBytes()
+	}
+
+	// Evict from the end of the table
+	slices.SortFunc(present, func(a, b entry) int { return strings.Compare(b.series.sortKey, a.series.sortKey) })
+	for _, e := range present {
+		if s.UsedBytes <= s.MaxBytes {
+			return
+		}
+		s.UsedBytes -= seriesBytes(e.sig, e.series)
+		delete(s.Metrics, e.sig)
+		if s.evicted == nil {
+			s.evicted = make(map[string]bool)
+		}
+		s.evicted[e.sig] = true
+	}
+}
+
+// sampleValue returns the value of a simple (gauge, counter or untyped)
+// sample.
+func sampleValue(metric *dto.Metric) (float64, bool) {
+	switch {
+	case metric.Gauge != nil:
+		return metric.Gauge.GetValue(), true
+	case metric.Counter != nil:
+		return metric.Counter.GetValue(), true
+	case metric.Untyped != nil:
+		return metric.Untyped.GetValue(), true
+	}
+	// Skip complex types for now
+	return 0, false
+}
+
+// FindSample returns the value of the series with the given signature in a
+// batch of metric families.
+func FindSample(families map[string]*dto.MetricFamily, sig string) (float64, bool) {
+	value, found := math.NaN(), false
+	forEachSample(families, func(s, _, _ string, _ map[string]string, v float64) {
+		if s == sig {
+			value, found = v, true
+		}
+	})
+	return value, found
+}
+
+// forEachSample calls fn for every simple (gauge, counter or untyped) sample
+// in a batch of metric families.
+func forEachSample(families map[string]*dto.MetricFamily, fn func(sig, name, unit string, labels map[string]string, value float64)) {
+	for _, family := range families {
+		name := family.GetName()
+		unit := inferUnit(name, family.GetUnit())
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+
+			value, ok := sampleValue(metric)
+			if !ok {
+				continue
+			}
+
+			fn(labelPairsSignature(name, metric.GetLabel()), name, unit, labels, value)
 		}
-		s.Metrics[sig] = series
 	}
-	s.appendValue(series, value)
 }
 
 func (s *Store) appendValue(series *MetricSeries, value float64) {
 	// Append new value
 	series.Values = append(series.Values, value)
+	series.version++
 
 	// Prune if exceeding history limit
 	if len(series.Values) > s.HistoryLimit {
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// benchSizes are the numbers of series of the benchmark fixtures.
+var benchSizes = []int{1_000, 10_000, 100_000}
+
+// benchExposition generates an exposition in the text format with n series,
+// spread over families of 100 series with a few labels each like those of
+// typical HTTP server metrics. The values vary with scrape.
+func benchExposition(n, scrape int) []byte {
+	var b strings.Builder
+	for family := 0; family*100 < n; family++ {
+		fmt.Fprintf(&b, "# HELP bench_requests_%d_total Requests handled.\n", family)
+		fmt.Fprintf(&b, "# TYPE bench_requests_%d_total counter\n", family)
+		for i := 0; i < min(100, n-family*100); i++ {
+			fmt.Fprintf(&b, "bench_requests_%d_total{code=\"%d\",handler=\"/api/v1/items/%d\",method=\"GET\",instance=\"10.0.0.%d:9100\"} %d\n",
+				family, 200+i%5, i/5, i%20, scrape*(i+1))
+		}
+	}
+	return []byte(b.String())
+}
+
+func benchFamilies(b *testing.B, n, scrape int) map[string]*dto.MetricFamily {
+	b.Helper()
+	families, err := parseText(benchExposition(n, scrape))
+	if err != nil {
+		b.Fatal(err)
+	}
+	return families
+}
+
+// sprintfSignature is GenerateSignature as it was before building signatures
+// in pooled buffers, as the baseline of the signature benchmarks.
+func sprintfSignature(name string, labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString(name)
+	sb.WriteString("{")
+	for i, k := range keys {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(fmt.Sprintf("%s=%q", k, labels[k]))
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+func BenchmarkSprintfSignature(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			store := NewStore(10)
+			store.UpdateFromFamilies(benchFamilies(b, n, 1))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				for _, series := range store.Metrics {
+					sprintfSignature(series.Name, series.Labels)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkLabelPairsSignature(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			families := benchFamilies(b, n, 1)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				for name, family := range families {
+					for _, metric := range family.GetMetric() {
+						labelPairsSignature(name, metric.GetLabel())
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGenerateSignature(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			store := NewStore(10)
+			store.UpdateFromFamilies(benchFamilies(b, n, 1))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				for _, series := range store.Metrics {
+					GenerateSignature(series.Name, series.Labels)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkUpdateFromFamilies measures a scrape of known series, which looks
+// them up by signature without allocating.
+func BenchmarkUpdateFromFamilies(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			store := NewStore(10)
+			store.UpdateFromFamilies(benchFamilies(b, n, 1))
+			families := benchFamilies(b, n, 2)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				store.UpdateFromFamilies(families)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import "github.com/charmbracelet/lipgloss"
+
+// Stripe mode constants
+const (
+	StripeModeOff     = "off"
+	StripeModeRows    = "rows"
+	StripeModeColumns = "columns"
+)
+
+// stripeColor returns a subtle background which works on both light and dark
+// terminal themes.
+func stripeColor() lipgloss.TerminalColor {
+	if monochrome {
+		return lipgloss.NoColor{}
+	}
+	return lipgloss.AdaptiveColor{Light: "254", Dark: "236"}
+}
+
+// stripeStyle returns the background style for a table cell. Row is the data
+// row index and offset is the value column offset counted from the current
+// value column, or -1 for the metric name column. Columns are counted from the
+// right so stripes stay put when older columns are trimmed.
+func (m model) stripeStyle(row, offset int) lipgloss.Style {
+	style := lipgloss.NewStyle()
+	switch m.cfg.StripeMode {
+	case StripeModeRows:
+		if row%2 == 1 {
+			style = style.Background(stripeColor())
+		}
+	case StripeModeColumns:
+		if offset >= 0 && offset%2 == 1 {
+			style = style.Background(stripeColor())
+		}
+	}
+	return style
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// targetEdit is the state of editing the targets at runtime. The targets are
+// edited as one space separated list of -url values, after which the auth of
+// each added target is prompted for.
+type targetEdit struct {
+	input   textinput.Model
+	specs   []string
+	targets []Target
+	added   []int  // Indices into targets still to prompt auth for
+	err     string // Validation error of the submitted list
+}
+
+// startTargetEdit opens the prompt with the current targets.
+func (m model) startTargetEdit() (tea.Model, tea.Cmd) {
+	ti := textinput.New()
+	ti.Prompt = "targets: "
+	ti.Placeholder = "space separated <url>[;<name>=<value>]..."
+	ti.SetValue(strings.Join(m.cfg.URLs, " "))
+	ti.CursorEnd()
+	m.targetEdit = &targetEdit{input: ti}
+	return m, m.targetEdit.input.Focus()
+}
+
+// updateTargetEdit handles key presses while editing targets.
+func (m model) updateTargetEdit(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	e := m.targetEdit
+	switch msg.String() {
+	case "esc", "ctrl+c":
+		m.targetEdit = nil
+		m.notice = "Targets unchanged"
+		return m, nil
+	case "enter":
+		if e.targets == nil {
+			return m.submitTargets()
+		}
+		e.targets[e.added[0]].Auth = strings.TrimSpace(e.input.Value())
+		e.added = e.added[1:]
+		if len(e.added) > 0 {
+			e.promptAuth()
+			return m, nil
+		}
+		return m.applyTargets(), nil
+	}
+
+	var cmd tea.Cmd
+	e.err = ""
+	e.input, cmd = e.input.Update(msg)
+	return m, cmd
+}
+
+// view renders the prompt, followed by the validation error if any.
+func (e *targetEdit) view() string {
+	if e.err != "" {
+		return e.input.View() + "  ⚠ " + e.err
+	}
+	return e.input.View()
+}
+
+// submitTargets validates the edited list, then prompts for the auth of
+// added targets or applies the list right away.
+func (m model) submitTargets() (tea.Model, tea.Cmd) {
+	e := m.targetEdit
+	specs := strings.Fields(e.input.Value())
+	if len(specs) == 0 {
+		e.err = "at least one target is required"
+		return m, nil
+	}
+	targets, err := parseTargets(specs)
+	if err == nil {
+		err = validateTargetURLs(targets)
+	}
+	if err != nil {
+		e.err = err.Error()
+		return m, nil
+	}
+
+	// Keep the auth of the targets which remain
+	auth := make(map[string]string)
+	for _, t := range m.fetcher.targets {
+		auth[t.URL] = t.Auth
+	}
+	for i := range targets {
+		if a, ok := auth[targets[i].URL]; ok {
+			targets[i].Auth = a
+		} else {
+			e.added = append(e.added, i)
+		}
+	}
+	e.specs, e.targets = specs, targets
+	if len(e.added) > 0 {
+		e.promptAuth()
+		return m, nil
+	}
+	return m.applyTargets(), nil
+}
+
+// promptAuth switches the input to the auth of the next added target.
+func (e *targetEdit) promptAuth() {
+	e.input.Reset()
+	e.input.Prompt = fmt.Sprintf("auth for %s: ", e.targets[e.added[0]].URL)
+	e.input.Placeholder = "user:password or bearer token (empty for none)"
+	e.input.EchoMode = textinput.EchoPassword
+}
+
+// applyTargets replaces the scraper with one for the edited targets. The
+// history is kept, series of removed targets eventually age out.
+func (m model) applyTargets() model {
+	e := m.targetEdit
+	m.targetEdit = nil
+	if slices.Equal(e.specs, m.cfg.URLs) {
+		m.notice = "Targets unchanged"
+		return m
+	}
+	stagger, drop := m.fetcher.Stagger, m.fetcher.drop
+	m.fetcher = NewScraper(e.targets)
+	m.fetcher.SetFormat(m.cfg.Format)
+	m.fetcher.SetTransforms(m.cfg.Transforms)
+	m.fetcher.SetDrop(drop)
+	m.fetcher.Stagger = stagger
+	m.cfg.URLs = e.specs
+	m.cfg.URL = targetsSummary(e.targets)
+	m.targetErr = nil
+	m.logEvent("Targets changed to "+strings.Join(e.specs, " "), false)
+	m.notice = fmt.Sprintf("Scraping %d target(s)", len(e.targets))
+	return m
+}
+
+// validateTargetURLs checks that all targets are absolute http(s) URLs,
+// local processes or textfile directories.
+func validateTargetURLs(targets []Target) error {
+	for _, t := range targets {
+		if _, ok := procPID(t.URL); ok {
+			continue
+		}
+		if _, ok := textfileDir(t.URL); ok {
+			continue
+		}
+		u, err := url.Parse(t.URL)
+		if err != nil {
+			return fmt.Errorf("invalid target URL: %v", err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid target URL '%s'. Must be http(s)://<host>[:<port>]/<path> , proc://<pid> or textfile://<dir>", t.URL)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	promModel "github.com/prometheus/common/model"
+)
+
+// Target is a scraped endpoint with static labels added to all its series.
+type Target struct {
+	URL    string
+	Labels map[string]string
+	// Auth is either 'user:password' for basic auth or a bearer token
+	Auth string
+}
+
+// parseTarget parses a -url value of the form `<url>[;<name>=<value>]...`.
+func parseTarget(spec string) (Target, error) {
+	parts := strings.Split(spec, ";")
+	t := Target{URL: parts[0]}
+	if t.URL == "" {
+		return t, fmt.Errorf("invalid target '%s': missing URL", spec)
+	}
+	for _, part := range parts[1:] {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || !promModel.LabelName(name).IsValid() {
+			return t, fmt.Errorf("invalid target label '%s' in '%s'. Must be <name>=<value>", part, spec)
+		}
+		if t.Labels == nil {
+			t.Labels = make(map[string]string)
+		}
+		t.Labels[name] = value
+	}
+	return t, nil
+}
+
+func parseTargets(specs []string) ([]Target, error) {
+	var targets []Target
+	for _, spec := range specs {
+		t, err := parseTarget(spec)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// targetsSummary describes the targets for display, e.g. in the footer.
+func targetsSummary(targets []Target) string {
+	switch len(targets) {
+	case 0:
+		return ""
+	case 1:
+		return targets[0].URL
+	}
+	return fmt.Sprintf("%s (+%d more)", targets[0].URL, len(targets)-1)
+}
+
+// Scraper fetches all targets and merges their metric families, adding the
+// target labels to every series. With several targets, those without an
+// instance label get one (host:port) so their series stay distinguishable
+// also when targets share their other labels.
+type Scraper struct {
+	targets  []Target
+	fetchers []*Fetcher
+
+	// Stagger spreads the start of the fetches of several targets over
+	// this window
+	Stagger time.Duration
+
+	mu        sync.Mutex
+	health    []scrapeHealth  // Recent outcomes by target, see recordHealth
+	downSince []time.Time     // First failure of the ongoing outage by target
+	downtime  []time.Duration // Of the past outages by target
+	recovered []outage        // Ended outages, see takeRecovered
+
+	transforms []string       // See SetTransforms
+	drop       *regexp.Regexp // See SetDrop
+}
+
+// TargetErrors is returned when some but not all targets failed, along with
+// the merged families of the others.
+type TargetErrors struct {
+	Failed int
+	Total  int
+	Err    error
+}
+
+func (e *TargetErrors) Error() string {
+	return fmt.Sprintf("%d/%d targets failed: %v", e.Failed, e.Total, e.Err)
+}
+
+func NewScraper(targets []Target) *Scraper {
+	s := &Scraper{}
+	for _, t := range targets {
+		if _, ok := t.Labels["instance"]; len(targets) > 1 && !ok {
+			t.Labels = maps.Clone(t.Labels)
+			if t.Labels == nil {
+				t.Labels = make(map[string]string)
+			}
+			t.Labels["instance"] = instanceOf(t.URL)
+		}
+		f := NewFetcher(t.URL)
+		f.Authorization = authorizationHeader(t.Auth)
+		s.targets = append(s.targets, t)
+		s.fetchers = append(s.fetchers, f)
+	}
+	return s
+}
+
+// SetFormat sets the exposition format of the responses of all targets, see
+// Fetcher.Format.
+func (s *Scraper) SetFormat(format string) {
+	for _, f := range s.fetchers {
+		f.Format = format
+	}
+}
+
+// authorizationHeader returns the Authorization header for the Auth of a
+// target.
+func authorizationHeader(auth string) string {
+	if auth == "" {
+		return ""
+	}
+	if user, password, ok := strings.Cut(auth, ":"); ok {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+	}
+	return "Bearer " + auth
+}
+
+// instanceOf returns the host:port of a URL, or the URL if it has none or is
+// a local process or textfile directory.
+func instanceOf(rawURL string) string {
+	if _, ok := textfileDir(rawURL); ok {
+		return rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || u.Scheme == procScheme {
+		return rawURL
+	}
+	return u.Host
+}
+
+func (s *Scraper) Fetch() (map[string]*dto.MetricFamily, error) {
+	return s.FetchContext(context.Background())
+}
+
+// FetchContext scrapes all targets, staggered over the Stagger window, and
+// records the outcome per target. Fetches aborted by ctx are not recorded.
+func (s *Scraper) FetchContext(ctx context.Context) (map[string]*dto.MetricFamily, error) {
+	families, targetErrs, err := s.fetch(ctx, s.Stagger)
+	if ctx.Err() == nil {
+		s.recordHealth(targetErrs, time.Now())
+	}
+	return families, err
+}
+
+// FetchNow scrapes all targets at once, e.g. for fast polling when zoomed.
+func (s *Scraper) FetchNow(ctx context.Context) (map[string]*dto.MetricFamily, error) {
+	families, _, err := s.fetch(ctx, 0)
+	return families, err
+}
+
+// fetch returns the merged families without those matched by -drop, passed
+// through the -transform commands,
+// the error of each target and the overall error. A failed transform fails
+// the scrape but not the targets.
+func (s *Scraper) fetch(ctx context.Context, stagger time.Duration) (map[string]*dto.MetricFamily, []error, error) {
+	families, targetErrs, err := s.fetchTargets(ctx, stagger)
+	s.dropFamilies(families)
+	if families == nil || len(s.transforms) == 0 {
+		return families, targetErrs, err
+	}
+	transformed, transformErr := s.transform(ctx, families)
+	if transformErr != nil {
+		return nil, targetErrs, transformErr
+	}
+	return transformed, targetErrs, err
+}
+
+// fetchTargets returns the merged families, the error of each target and the
+// overall error.
+func (s *Scraper) fetchTargets(ctx context.Context, stagger time.Duration) (map[string]*dto.MetricFamily, []error, error) {
+	if len(s.targets) == 1 && len(s.targets[0].Labels) == 0 {
+		families, err := s.fetchers[0].FetchContext(ctx)
+		return families, []error{err}, err
+	}
+
+	results := FetchAllStaggered(ctx, s.fetchers, len(s.fetchers), 0, stagger)
+	merged := make(map[string]*dto.MetricFamily)
+	targetErrs := make([]error, len(results))
+	var errs []error
+	for i, result := range results {
+		if result.Err != nil {
+			targetErrs[i] = result.Err
+			errs = append(errs, fmt.Errorf("%s: %w", result.Fetcher.URL, result.Err))
+			continue
+		}
+		for name, family := range result.Families {
+			for _, metric := range family.GetMetric() {
+				metric.Label = withTargetLabels(metric.GetLabel(), s.targets[i].Labels)
+			}
+			if existing, ok := merged[name]; ok {
+				existing.Metric = append(existing.Metric, family.GetMetric()...)
+			} else {
+				merged[name] = family
+			}
+		}
+	}
+	switch {
+	case len(errs) == len(results):
+		return nil, targetErrs, errors.Join(errs...)
+	case len(errs) > 0:
+		return merged, targetErrs, &TargetErrors{Failed: len(errs), Total: len(results), Err: errors.Join(errs...)}
+	}
+	return merged, targetErrs, nil
+}
+
+// withTargetLabels returns labels with the target labels added, replacing
+// exposed labels of the same name.
+func withTargetLabels(labels []*dto.LabelPair, target map[string]string) []*dto.LabelPair {
+	res := make([]*dto.LabelPair, 0, len(labels)+len(target))
+	for _, l := range labels {
+		if _, ok := target[l.GetName()]; !ok {
+			res = append(res, l)
+		}
+	}
+	for name, value := range target {
+		res = append(res, &dto.LabelPair{Name: &name, Value: &value})
+	}
+	return res
+}
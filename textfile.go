@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	promModel "github.com/prometheus/common/model"
+)
+
+// textfilePrefix starts the URL of node exporter textfile directory
+// targets, e.g. textfile:///var/lib/node_exporter/textfile, added with
+// -textfile-dir.
+const textfilePrefix = "textfile://"
+
+// textfileDir returns the directory of a textfile:// target URL.
+func textfileDir(rawURL string) (string, bool) {
+	dir, ok := strings.CutPrefix(rawURL, textfilePrefix)
+	return dir, ok && dir != ""
+}
+
+// fetchTextfiles parses and merges all *.prom files in dir, like the
+// textfile collector of the node exporter. Like it, each file also gets a
+// node_textfile_mtime_seconds series, so rewrites by e.g. cron jobs are
+// visible even if the values did not change. A file which does not parse
+// fails the scrape, naming the file.
+func fetchTextfiles(ctx context.Context, dir string) (map[string]*dto.MetricFamily, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.prom"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(paths)
+
+	merged := make(map[string]*dto.MetricFamily)
+	mtimeName, mtimeHelp := "node_textfile_mtime_seconds", "Unixtime mtime of textfiles successfully read."
+	mtimes := &dto.MetricFamily{Name: &mtimeName, Help: &mtimeHelp, Type: dto.MetricType_GAUGE.Enum()}
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		families, mtime, err := parseTextfile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		for name, family := range families {
+			if existing, ok := merged[name]; ok {
+				existing.Metric = append(existing.Metric, family.GetMetric()...)
+			} else {
+				merged[name] = family
+			}
+		}
+		fileLabel, file := "file", filepath.Base(path)
+		mtimes.Metric = append(mtimes.Metric, &dto.Metric{
+			Label: []*dto.LabelPair{{Name: &fileLabel, Value: &file}},
+			Gauge: &dto.Gauge{Value: &mtime},
+		})
+	}
+	if len(mtimes.Metric) > 0 {
+		merged[mtimeName] = mtimes
+	}
+	return flattenFamilies(merged), nil
+}
+
+// parseTextfile returns the metric families of a textfile and its
+// modification time in seconds.
+func parseTextfile(path string) (map[string]*dto.MetricFamily, float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	parser := expfmt.NewTextParser(promModel.UTF8Validation)
+	families, err := parser.TextToMetricFamilies(f)
+	if err != nil {
+		return nil, 0, err
+	}
+	return families, float64(info.ModTime().UnixNano()) / 1e9, nil
+}
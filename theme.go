@@ -0,0 +1,14 @@
+package main
+
+import "github.com/charmbracelet/lipgloss"
+
+// monochrome disables all colors, see the -monochrome flag.
+var monochrome bool
+
+// color returns the given ANSI color, or no color in monochrome mode.
+func color(c string) lipgloss.TerminalColor {
+	if monochrome {
+		return lipgloss.NoColor{}
+	}
+	return lipgloss.Color(c)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"text/template"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// titleData is the data available to the -title template.
+type titleData struct {
+	m model
+}
+
+// Host is the host:port of the scraped endpoint, of the first one followed
+// by e.g. " +2" with several targets.
+func (d titleData) Host() string {
+	if d.m.fetcher == nil || len(d.m.fetcher.targets) == 0 {
+		return d.m.cfg.URL
+	}
+	targets := d.m.fetcher.targets
+	host := instanceOf(targets[0].URL)
+	if len(targets) > 1 {
+		host += fmt.Sprintf(" +%d", len(targets)-1)
+	}
+	return host
+}
+
+// Status is a short connection state: "ok", "error" or "paused".
+func (d titleData) Status() string {
+	switch {
+	case d.m.isPaused:
+		return "paused"
+	case d.m.connectionError != nil:
+		return "error"
+	}
+	return "ok"
+}
+
+// Error is the last scrape error, if any.
+func (d titleData) Error() error {
+	return d.m.connectionError
+}
+
+// Value is the sum of the current values of all series matching the selector.
+func (d titleData) Value(sel string) string {
+	return d.sum(sel, func(series *MetricSeries) float64 {
+		return series.Values[len(series.Values)-1]
+	})
+}
+
+// Delta is the sum of the changes since the previous scrape of all series
+// matching the selector.
+func (d titleData) Delta(sel string) string {
+	return d.sum(sel, func(series *MetricSeries) float64 {
+		if len(series.Values) < 2 {
+			return math.NaN()
+		}
+		return series.Values[len(series.Values)-1] - series.Values[len(series.Values)-2]
+	})
+}
+
+func (d titleData) sum(sel string, value func(*MetricSeries) float64) string {
+	s, err := parseSelector(sel)
+	if err != nil {
+		return "?"
+	}
+	total, found := 0.0, false
+	for _, series := range d.m.store.Metrics {
+		if len(series.Values) == 0 || !s.matches(series) {
+			continue
+		}
+		if v := value(series); !math.IsNaN(v) {
+			total += v
+			found = true
+		}
+	}
+	if !found {
+		return "-"
+	}
+	return formatFloat(total)
+}
+
+// parseTitleTemplate parses the -title template. An empty template disables
+// setting the terminal title.
+func parseTitleTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	return template.New("title").Parse(text)
+}
+
+// titleCmd sets the terminal (and tmux pane) title if it changed.
+func (m *model) titleCmd() tea.Cmd {
+	if m.titleTemplate == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := m.titleTemplate.Execute(&buf, titleData{m: *m}); err != nil {
+		return nil
+	}
+	title := strings.TrimSpace(buf.String())
+	if title == m.title {
+		return nil
+	}
+	m.title = title
+	return tea.SetWindowTitle(title)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// runTransform passes the families of a scrape through a -transform command
+// and returns the families it writes back. The command gets the families in
+// the Prometheus text format on stdin and writes the transformed ones to
+// stdout in any format of -format, so it can rename, rescale, drop or
+// synthesize series in any language without changes here.
+func runTransform(ctx context.Context, command string, families map[string]*dto.MetricFamily) (map[string]*dto.MetricFamily, error) {
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var in bytes.Buffer
+	for _, name := range names {
+		if _, err := expfmt.MetricFamilyToText(&in, families[name]); err != nil {
+			return nil, fmt.Errorf("transform '%s': %v", command, err)
+		}
+	}
+
+	var out, stderr bytes.Buffer
+	c := exec.CommandContext(ctx, "sh", "-c", command)
+	c.Stdin = &in
+	c.Stdout = &out
+	c.Stderr = &stderr
+	if err := c.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("transform '%s' failed: %v: %s", command, err, msg)
+		}
+		return nil, fmt.Errorf("transform '%s' failed: %v", command, err)
+	}
+	format, _ := detectFormat("", out.Bytes())
+	transformed, err := parseExposition(out.Bytes(), format)
+	if err != nil {
+		return nil, fmt.Errorf("transform '%s': cannot parse output as %s: %w", command, format, err)
+	}
+	return transformed, nil
+}
+
+// SetTransforms sets the -transform commands the families of each scrape are
+// passed through, in order.
+func (s *Scraper) SetTransforms(commands []string) {
+	s.transforms = commands
+}
+
+// transform passes the families through the -transform commands.
+func (s *Scraper) transform(ctx context.Context, families map[string]*dto.MetricFamily) (map[string]*dto.MetricFamily, error) {
+	for _, command := range s.transforms {
+		var err error
+		if families, err = runTransform(ctx, command, families); err != nil {
+			return nil, err
+		}
+	}
+	return families, nil
+}
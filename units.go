@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Unit constants, named after the OpenMetrics base units
+const (
+	UnitBytes     = "bytes"
+	UnitSeconds   = "seconds"
+	UnitPerSecond = "per_second"
+)
+
+// inferUnit returns the unit of a metric family. A unit declared in the
+// exposition takes precedence, otherwise it is inferred from the metric name
+// suffix following the Prometheus naming conventions.
+func inferUnit(name, declared string) string {
+	if declared != "" {
+		return declared
+	}
+	base := strings.TrimSuffix(name, "_total")
+	for _, unit := range []string{UnitBytes, UnitSeconds, UnitPerSecond} {
+		if strings.HasSuffix(base, "_"+unit) {
+			return unit
+		}
+	}
+	return ""
+}
+
+// unitScaled is the unit of values already divided by the scale of their
+// column, which are formatted without prefix or suffix, see columnUnits.
+const unitScaled = "\x00scaled"
+
+// formatValue formats a value for display, using human-readable units if
+// enabled.
+func (m model) formatValue(unit string, val float64) string {
+	if unit == unitScaled {
+		if formatted := formatFloat(val); val == 0 || (formatted != "0" && formatted != "-0") {
+			return formatted
+		}
+		// Too small for the scale of the column
+		return strconv.FormatFloat(val, 'g', 2, 64)
+	}
+	if !m.cfg.HumanUnits {
+		return formatFloat(val)
+	}
+	return formatHumanUnit(val, unit)
+}
+
+// formatHumanUnit formats a value with binary prefixes for bytes, a suitable
+// time unit for seconds and SI prefixes for everything else.
+func formatHumanUnit(val float64, unit string) string {
+	factor, suffix := humanScale(unit, math.Abs(val))
+	return formatFloat(val/factor) + suffix
+}
+
+// humanScale returns the divisor and the suffix formatHumanUnit uses for
+// values of the given magnitude.
+func humanScale(unit string, abs float64) (float64, string) {
+	switch unit {
+	case UnitBytes:
+		prefixes := []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+		factor, i := 1.0, 0
+		for abs >= 1024*factor && i < len(prefixes)-1 {
+			factor *= 1024
+			i++
+		}
+		return factor, " " + prefixes[i]
+	case UnitSeconds:
+		switch {
+		case abs == 0:
+			return 1, " s"
+		case abs < 1e-6:
+			return 1e-9, " ns"
+		case abs < 1e-3:
+			return 1e-6, " µs"
+		case abs < 1:
+			return 1e-3, " ms"
+		case abs < 60:
+			return 1, " s"
+		case abs < 3600:
+			return 60, " min"
+		default:
+			return 3600, " h"
+		}
+	case UnitPerSecond:
+		factor, prefix := siScale(abs)
+		return factor, prefix + "/s"
+	default:
+		return siScale(abs)
+	}
+}
+
+// siScale returns the divisor and the SI prefix for values of the given
+// magnitude.
+func siScale(abs float64) (float64, string) {
+	prefixes := []string{"", " k", " M", " G", " T", " P", " E"}
+	factor, i := 1.0, 0
+	for abs >= 1000*factor && i < len(prefixes)-1 {
+		factor *= 1000
+		i++
+	}
+	return factor, prefixes[i]
+}
+
+// columnUnit is the unit of a value column shown in the unit row.
+type columnUnit struct {
+	label  string
+	factor float64 // Divisor of the cells, 0 if they keep their own units
+}
+
+// columnUnits returns the units of the value columns, oldest first, for the
+// unit row. If all series share a unit, each column is scaled to its largest
+// value with human units, so the cells need no suffix. Otherwise the cells
+// keep their units and the columns are labeled mixed.
+func (m model) columnUnits(series []*MetricSeries) []columnUnit {
+	numValueCols := m.valueColumns()
+	units := make([]columnUnit, numValueCols)
+	if len(series) == 0 {
+		return units
+	}
+	unit := series[0].Unit
+	for _, s := range series[1:] {
+		if s.Unit != unit {
+			for i := range units {
+				units[i].label = "mixed"
+			}
+			return units
+		}
+	}
+	if !m.cfg.HumanUnits {
+		for i := range units {
+			units[i].label = unit
+		}
+		return units
+	}
+
+	largest := make([]float64, numValueCols)
+	for i := range largest {
+		largest[i] = -1 // No values
+	}
+	for _, s := range series {
+		vals := m.columnValues(s)
+		for col := range largest {
+			if valIdx := len(vals) - numValueCols + col; valIdx >= 0 && !math.IsNaN(vals[valIdx]) {
+				largest[col] = math.Max(largest[col], math.Abs(vals[valIdx]))
+			}
+		}
+	}
+	for col, abs := range largest {
+		if abs < 0 {
+			continue
+		}
+		factor, suffix := humanScale(unit, abs)
+		units[col] = columnUnit{label: strings.TrimSpace(suffix), factor: factor}
+	}
+	return units
+}
+
+// scaledValue returns a value of the value column offset columns before the
+// current one in the scale of the unit row, or the value and its unit if the
+// column is not scaled.
+func (m model) scaledValue(unit string, val float64, offset int) (string, float64) {
+	col := len(m.colUnits) - 1 - offset
+	if col < 0 || col >= len(m.colUnits) || m.colUnits[col].factor == 0 {
+		return unit, val
+	}
+	return unitScaled, val / m.colUnits[col].factor
+}
+
+// byteSize is a flag.Value for sizes like "512MiB", "2GB" or plain bytes.
+type byteSize int64
+
+func (b *byteSize) String() string {
+	if *b == 0 {
+		return "0"
+	}
+	return formatHumanUnit(float64(*b), UnitBytes)
+}
+
+func (b *byteSize) Set(s string) error {
+	s = strings.TrimSpace(s)
+	multipliers := []struct {
+		suffix string
+		factor float64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+		{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+		{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+		{"B", 1},
+	}
+	factor := 1.0
+	for _, m := range multipliers {
+		if strings.HasSuffix(s, m.suffix) {
+			s, factor = strings.TrimSpace(strings.TrimSuffix(s, m.suffix)), m.factor
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return fmt.Errorf("invalid size %q", s)
+	}
+	*b = byteSize(v * factor)
+	return nil
+}
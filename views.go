@@ -0,0 +1,177 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxViews is the number of view presets, bound to the keys 1-9.
+const maxViews = 9
+
+// viewSettings are the flags a view preset may set. They only change what is
+// shown, not how metrics are collected.
+var viewSettings = map[string]bool{
+	"filter-metric": true,
+	"filter-label":  true,
+	"select":        true,
+	"label-mode":    true,
+	"delta-mode":    true,
+	"sort":          true,
+	"column-window": true,
+	"column-agg":    true,
+	"aggregate":     true,
+	"totals":        true,
+	"age":           true,
+	"minmax":        true,
+	"bars":          true,
+	"derived":       true,
+	"missing":       true,
+	"graph":         true,
+}
+
+// viewPreset is a named set of display settings, configured with -view.
+type viewPreset struct {
+	name     string
+	settings [][2]string // Flag names and values, in order
+}
+
+// parseView parses a view of the form `<name> <setting>=<value>...`, e.g.
+// `errors filter-metric=.*_errors_total delta-mode=next sort=age`.
+func parseView(spec string) (viewPreset, error) {
+	fields := strings.Fields(spec)
+	if len(fields) < 2 {
+		return viewPreset{}, fmt.Errorf("invalid view '%s'. Must be <name> <setting>=<value>...", spec)
+	}
+	v := viewPreset{name: fields[0]}
+	for _, field := range fields[1:] {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return viewPreset{}, fmt.Errorf("view '%s': invalid setting '%s'. Must be <setting>=<value>", v.name, field)
+		}
+		if !viewSettings[name] {
+			return viewPreset{}, fmt.Errorf("view '%s': setting '%s' can not be used in a view", v.name, name)
+		}
+		v.settings = append(v.settings, [2]string{name, value})
+	}
+	return v, nil
+}
+
+func parseViews(specs []string) ([]viewPreset, error) {
+	if len(specs) > maxViews {
+		return nil, fmt.Errorf("too many views, at most %d are supported", maxViews)
+	}
+	var views []viewPreset
+	for _, spec := range specs {
+		v, err := parseView(spec)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, v)
+	}
+	return views, nil
+}
+
+// loadViews parses the -view presets of cfg and checks that each applies.
+func loadViews(cfg Config) ([]viewPreset, error) {
+	views, err := parseViews(cfg.Views)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range views {
+		if _, err := v.apply(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return views, nil
+}
+
+// apply returns base with the settings of the view applied.
+func (v viewPreset) apply(base Config) (Config, error) {
+	var cfg Config
+	fs := flag.NewFlagSet(v.name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	defineFlags(fs, &cfg)
+	// The flags point into cfg, so this replaces the defaults with base
+	cfg = base
+	for _, s := range v.settings {
+		if err := fs.Set(s[0], s[1]); err != nil {
+			return cfg, fmt.Errorf("view '%s': %s: %v", v.name, s[0], err)
+		}
+	}
+	if err := cfg.validate(); err != nil {
+		return cfg, fmt.Errorf("view '%s': %v", v.name, err)
+	}
+	return cfg, nil
+}
+
+// selectView switches to view i (1-based) or back to the configured
+// settings with 0. Toggling the active view also switches back.
+func (m model) selectView(i int) model {
+	if i > len(m.views) {
+		m.notice = fmt.Sprintf("No view %d", i)
+		return m
+	}
+	if i == m.view {
+		i = 0
+	}
+	cfg := m.baseCfg
+	if i > 0 {
+		var err error
+		if cfg, err = m.views[i-1].apply(m.baseCfg); err != nil {
+			m.notice = err.Error()
+			return m
+		}
+	}
+	var sel *selector
+	if cfg.Select != "" {
+		var err error
+		if sel, err = parseSelector(cfg.Select); err != nil {
+			m.notice = fmt.Sprintf("invalid selector: %v", err)
+			return m
+		}
+	}
+	m.applyViewSettings(cfg, sel)
+	m.view = i
+	if i == 0 {
+		// The footer shows active views only
+		m.notice = "Back to the default view"
+	}
+	m.clampCursor()
+	if m.viewportReady {
+		m.refreshTable()
+	}
+	return m
+}
+
+// viewName returns the name of the active view.
+func (m model) viewName() string {
+	if m.view == 0 {
+		return "default"
+	}
+	return m.views[m.view-1].name
+}
+
+// applyViewSettings applies the settings which views may change.
+func (m *model) applyViewSettings(cfg Config, sel *selector) {
+	m.cfg.FilterMetric = cfg.FilterMetric
+	m.metricFilter = compileMetricFilter(cfg.FilterMetric)
+	m.labelFilter, m.labelRegex = compileLabelFilter(cfg.FilterLabel)
+	m.cfg.FilterLabel = cfg.FilterLabel
+	m.cfg.Select = cfg.Select
+	m.selector = sel
+	m.cfg.LabelMode = cfg.LabelMode
+	m.cfg.DeltaMode = cfg.DeltaMode
+	m.cfg.SortMode = cfg.SortMode
+	m.cfg.ColumnWindow = cfg.ColumnWindow
+	m.cfg.ColumnAgg = cfg.ColumnAgg
+	m.cfg.Aggregate = cfg.Aggregate
+	m.cfg.ShowTotals = cfg.ShowTotals
+	m.cfg.ShowAge = cfg.ShowAge
+	m.cfg.MinMax = cfg.MinMax
+	m.cfg.Bars = cfg.Bars
+	m.cfg.Derived = cfg.Derived
+	m.cfg.ShowMissing = cfg.ShowMissing
+	m.cfg.GraphMode = cfg.GraphMode
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+// webView serves a read-only HTML rendering of the table as last shown in
+// the terminal, including the current filters and delta mode.
+type webView struct {
+	mu   sync.RWMutex
+	page []byte
+}
+
+type webPage struct {
+	URL       string
+	Refresh   int
+	Updated   string
+	DeltaMode string
+	Headers   []string
+	Rows      [][]string
+}
+
+var webPageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>openmetrics-tui: {{.URL}}</title>
+<style>
+body { font-family: monospace; background: #1a1b26; color: #c0caf5; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #414868; padding: 0 0.5em; text-align: right; white-space: nowrap; }
+th:first-child, td:first-child { text-align: left; }
+td:last-child { color: #ff79c6; }
+</style>
+</head>
+<body>
+<p>{{.URL}} | Deltas: {{.DeltaMode}} | Updated {{.Updated}}</p>
+{{if .Headers}}<table>
+<tr>{{range .Headers}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>{{else}}<p>No metrics to display</p>{{end}}
+</body>
+</html>
+`))
+
+// startWebView listens on addr and serves the web view in the background.
+// Listening is done up front so address errors are reported before the TUI
+// starts.
+func startWebView(addr string) (*webView, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	v := &webView{page: []byte("Waiting for first scrape...")}
+	go http.Serve(ln, v)
+	return v, nil
+}
+
+func (v *webView) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(v.page)
+}
+
+// publishWebView renders the current table with all history columns to the
+// web view, if enabled. It is published on scrape rather than on every
+// refresh, as it renders all rows.
+func (m model) publishWebView() {
+	if m.web == nil {
+		return
+	}
+
+	// Render apart from the row cache, whose rows are shared with the
+	// terminal and must keep their styling
+	m.rowCache = nil
+	headers, rows := m.buildTableData()
+	// Strip terminal styling from cells
+	for i := range headers {
+		headers[i] = ansi.Strip(headers[i])
+	}
+	for _, row := range rows {
+		for i := range row {
+			row[i] = ansi.Strip(row[i])
+		}
+	}
+
+	var buf bytes.Buffer
+	err := webPageTemplate.Execute(&buf, webPage{
+		URL:       m.cfg.URL,
+		Refresh:   max(int(m.cfg.Interval.Seconds()), 1),
+		Updated:   time.Now().Format(time.RFC3339),
+		DeltaMode: m.cfg.DeltaMode,
+		Headers:   headers,
+		Rows:      rows,
+	})
+	if err != nil {
+		return
+	}
+
+	m.web.mu.Lock()
+	m.web.page = buf.Bytes()
+	m.web.mu.Unlock()
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// zoomPanelHeight is the number of lines used by the zoom panel below the table.
+const zoomPanelHeight = 2
+
+// zoomState tracks a single series which is polled at a shorter interval than
+// the rest of the table. Samples are kept in a separate mini-history and do
+// not affect the main store.
+type zoomState struct {
+	gen    int
+	sig    string
+	name   string
+	values []float64
+	limit  int
+
+	fetches inflight // The zoom fetch in flight, at most one at a time
+}
+
+type zoomTickMsg struct {
+	gen int
+}
+
+type zoomSampleMsg struct {
+	gen   int
+	value float64
+}
+
+func (z *zoomState) append(value float64) {
+	z.values = append(z.values, value)
+	if len(z.values) > z.limit {
+		z.values = z.values[1:]
+	}
+}
+
+// toggleZoom starts zooming on the selected series, or stops an active zoom.
+func (m model) toggleZoom() (tea.Model, tea.Cmd) {
+	if m.zoom != nil {
+		m.zoom = nil
+		m.resizeViewport()
+		return m, nil
+	}
+
+	series := m.selectedSeries()
+	if series == nil {
+		return m, nil
+	}
+
+	// Each zoom session gets a new generation so ticks from a previous
+	// session are ignored
+	m.zoomGen++
+	m.zoom = &zoomState{
+		gen:   m.zoomGen,
+		sig:   series.signature(),
+		name:  formatMetricName(series, false),
+		limit: max(m.cfg.ZoomHistory, 1),
+	}
+	m.resizeViewport()
+	m.ensureCursorVisible()
+	return m, tea.Batch(m.zoomFetchCmd(), m.zoomTickCmd())
+}
+
+func (m model) zoomTickCmd() tea.Cmd {
+	gen := m.zoom.gen
+	return tea.Tick(m.cfg.ZoomInterval, func(time.Time) tea.Msg {
+		return zoomTickMsg{gen: gen}
+	})
+}
+
+// zoomFetchCmd fetches the zoomed series. It returns nil while the previous
+// zoom fetch or a scrape is still in flight, so a target slower than
+// -zoom-interval is not piled up with requests.
+func (m model) zoomFetchCmd() tea.Cmd {
+	if m.zoom.fetches.busy() || m.fetches.busy() {
+		return nil
+	}
+	gen, sig, fetches := m.zoom.gen, m.zoom.sig, &m.zoom.fetches
+	ctx := fetches.start(m.ctx)
+	return func() tea.Msg {
+		defer fetches.finish(ctx)
+		// Families are returned along with the error if only some targets
+		// failed, and the zoomed series may be on one which did not
+		families, _ := m.fetcher.FetchNow(ctx)
+		if families == nil {
+			return zoomSampleMsg{gen: gen, value: math.NaN()}
+		}
+		value, _ := FindSample(families, sig) // NaN when missing
+		return zoomSampleMsg{gen: gen, value: value}
+	}
+}
+
+// renderZoomPanel renders the zoomed series name and as many of its most
+// recent samples as fit the terminal width, oldest to the left.
+func (m model) renderZoomPanel() string {
+	title := fmt.Sprintf("Zoom %s every %s (z to close)", m.zoom.name, m.cfg.ZoomInterval)
+	if note, ok := m.notes[m.zoom.sig]; ok {
+		title += " ✎ " + note
+	}
+	title = m.labelStyle.Render(truncateMessage(title, m.width))
+
+	var cells []string
+	width := 0
+	for i := len(m.zoom.values) - 1; i >= 0; i-- {
+		cell := "."
+		if !math.IsNaN(m.zoom.values[i]) {
+			cell = formatFloat(m.zoom.values[i])
+		}
+		if width+len(cell)+1 > m.width {
+			break
+		}
+		width += len(cell) + 1
+		if i == len(m.zoom.values)-1 {
+			cell = m.currentValueStyle.Render(cell)
+		}
+		cells = append([]string{cell}, cells...)
+	}
+
+	return title + "\n" + strings.Join(cells, " ")
+}